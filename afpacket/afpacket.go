@@ -0,0 +1,196 @@
+/*
+Package afpacket implements live capture source for Linux built on AF_PACKET sockets.
+It is pure Go and doesn't need libpcap, so extcap can be built fully static.
+
+Interfaces are listed with netlink and their hardware type is read from /sys/class/net.
+Packets are received through TPACKET_V3 memory mapped ring. Capture filter is compiled
+to BPF and attached to the socket, so filtering is done by the kernel. Interfaces with
+unknown hardware type are captured in cooked mode as LINUX_SLL, their packets are
+matched against the filter in user space, because the kernel sees them without link header.
+
+Usage:
+
+	app := extcap.App{Usage: "static capture"}
+	app.Register(afpacket.New())
+	app.Run(os.Args)
+*/
+package afpacket
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+
+	"github.com/kor44/extcap"
+)
+
+// ErrNotSupported is returned on platforms other than Linux
+var ErrNotSupported = errors.New("AF_PACKET capture is supported only on Linux")
+
+// Define all options
+var (
+	SnapLength = extcap.NewConfigIntegerOpt("snaplen", "Snapshot length").
+			Range(1, 262144).Default(262144).Tooltip("Maximum number of bytes captured from each packet")
+	Promiscuous = extcap.NewConfigBoolOpt("promisc", "Promiscuous mode").
+			Default(true).Tooltip("Capture all packets seen on the interface")
+	BufferSize = extcap.NewConfigIntegerOpt("buffer-size", "Buffer size (MiB)").
+			Range(1, 1024).Default(8).Tooltip("Size of kernel ring buffer")
+)
+
+// Hardware types of network interfaces (ARPHRD_*)
+const (
+	arphrdEther          = 1
+	arphrdPPP            = 512
+	arphrdTunnel         = 768
+	arphrdTunnel6        = 769
+	arphrdLoopback       = 772
+	arphrdSIT            = 776
+	arphrdIPGRE          = 778
+	arphrdIEEE80211Radio = 803
+	arphrdNone           = 65534
+)
+
+const defaultPrefix = "afpacket-"
+
+// Source captures packets from Linux network interfaces
+type Source struct {
+	// Prefix is added to names of Linux interfaces, so they don't clash with
+	// interfaces captured by Wireshark itself. Default is "afpacket-"
+	Prefix string
+
+	// SysPath is path of sysfs network class. Default is /sys/class/net
+	SysPath string
+}
+
+// New creates source with default settings
+func New() *Source {
+	return &Source{
+		Prefix:  defaultPrefix,
+		SysPath: "/sys/class/net",
+	}
+}
+
+// Interfaces implements extcap.Source interface
+func (s *Source) Interfaces() ([]extcap.CaptureInterface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get information about interfaces: %w", err)
+	}
+
+	result := make([]extcap.CaptureInterface, 0, len(ifaces))
+	for _, iface := range ifaces {
+		result = append(result, extcap.CaptureInterface{
+			Value:   s.Prefix + iface.Name,
+			Display: "AF_PACKET: " + iface.Name,
+		})
+	}
+	return result, nil
+}
+
+// DLT implements extcap.Source interface
+func (s *Source) DLT(iface string) (extcap.DLT, error) {
+	name, err := s.linuxName(iface)
+	if err != nil {
+		return extcap.DLT{}, err
+	}
+
+	linkType, _, err := s.linkType(name)
+	if err != nil {
+		return extcap.DLT{}, err
+	}
+	return extcap.DLTFromLinkType(linkType), nil
+}
+
+// ConfigOptions implements extcap.ConfigSource interface
+func (s *Source) ConfigOptions(iface string) ([]extcap.ConfigOption, error) {
+	return s.AllConfigOptions(), nil
+}
+
+// AllConfigOptions implements extcap.ConfigSource interface
+func (s *Source) AllConfigOptions() []extcap.ConfigOption {
+	return []extcap.ConfigOption{SnapLength, Promiscuous, BufferSize}
+}
+
+// StartCapture implements extcap.Source interface
+func (s *Source) StartCapture(iface string, fifo io.WriteCloser, filter string, opts map[string]interface{}) error {
+	defer fifo.Close()
+
+	name, err := s.linuxName(iface)
+	if err != nil {
+		return err
+	}
+
+	linkType, cooked, err := s.linkType(name)
+	if err != nil {
+		return err
+	}
+
+	cfg := captureConfig{
+		iface:    name,
+		linkType: linkType,
+		cooked:   cooked,
+		filter:   filter,
+		snaplen:  262144,
+		bufSize:  8 << 20,
+	}
+	if v, ok := opts[SnapLength.Call()].(int); ok && v > 0 {
+		cfg.snaplen = v
+	}
+	if v, ok := opts[Promiscuous.Call()].(bool); ok {
+		cfg.promisc = v
+	}
+	if v, ok := opts[BufferSize.Call()].(int); ok && v > 0 {
+		cfg.bufSize = v << 20
+	}
+
+	return capture(cfg, fifo)
+}
+
+// captureConfig is parameters of capture on single interface
+type captureConfig struct {
+	iface    string
+	linkType layers.LinkType
+	cooked   bool // packets are received without link header, Linux SLL header is added
+	filter   string
+	snaplen  int
+	promisc  bool
+	bufSize  int
+}
+
+func (s *Source) linuxName(iface string) (string, error) {
+	if !strings.HasPrefix(iface, s.Prefix) {
+		return "", fmt.Errorf("%w '%s'", extcap.ErrUnknownInterface, iface)
+	}
+	return strings.TrimPrefix(iface, s.Prefix), nil
+}
+
+// linkType returns link type of Linux interface. Interfaces with unknown hardware
+// type are captured in cooked mode.
+func (s *Source) linkType(name string) (layers.LinkType, bool, error) {
+	data, err := os.ReadFile(filepath.Join(s.SysPath, name, "type"))
+	if err != nil {
+		return 0, false, fmt.Errorf("Unable to get type of interface '%s': %w", name, err)
+	}
+
+	hwType, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, false, fmt.Errorf("Invalid type of interface '%s': %w", name, err)
+	}
+
+	switch hwType {
+	case arphrdEther, arphrdLoopback:
+		return layers.LinkTypeEthernet, false, nil
+	case arphrdNone, arphrdPPP, arphrdTunnel, arphrdTunnel6, arphrdSIT, arphrdIPGRE:
+		return layers.LinkTypeRaw, false, nil
+	case arphrdIEEE80211Radio:
+		return layers.LinkTypeIEEE80211Radio, false, nil
+	}
+	return layers.LinkTypeLinuxSLL, true, nil
+}
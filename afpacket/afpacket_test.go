@@ -0,0 +1,64 @@
+package afpacket
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kor44/extcap"
+)
+
+func TestLinkType(t *testing.T) {
+	s := New()
+	s.SysPath = t.TempDir()
+
+	tests := []struct {
+		name     string
+		hwType   string
+		linkType layers.LinkType
+		cooked   bool
+	}{
+		{"eth0", "1\n", layers.LinkTypeEthernet, false},
+		{"lo", "772\n", layers.LinkTypeEthernet, false},
+		{"tun0", "65534\n", layers.LinkTypeRaw, false},
+		{"wlan0mon", "803\n", layers.LinkTypeIEEE80211Radio, false},
+		{"can0", "280\n", layers.LinkTypeLinuxSLL, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(s.SysPath, tt.name)
+			require.NoError(t, os.MkdirAll(dir, 0755))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "type"), []byte(tt.hwType), 0644))
+
+			linkType, cooked, err := s.linkType(tt.name)
+			require.NoError(t, err)
+			assert.Equal(t, tt.linkType, linkType)
+			assert.Equal(t, tt.cooked, cooked)
+
+			dlt, err := s.DLT(s.Prefix + tt.name)
+			require.NoError(t, err)
+			assert.Equal(t, int(tt.linkType), dlt.Number)
+		})
+	}
+
+	_, err := s.DLT("eth0")
+	assert.ErrorIs(t, err, extcap.ErrUnknownInterface)
+
+	_, err = s.DLT(s.Prefix + "missing")
+	assert.Error(t, err)
+}
+
+func TestRegisterWithLibraryFeatures(t *testing.T) {
+	// snaplen and buffer-size of the source don't conflict with disabled middlewares and output buffer
+	app := &extcap.App{}
+	app.Register(New())
+	assert.NoError(t, app.Validate())
+
+	app = &extcap.App{Middlewares: []extcap.Middleware{extcap.Truncate}}
+	app.Register(New())
+	assert.ErrorContains(t, app.Validate(), "option 'snaplen' conflicts with extcap flag")
+}
@@ -0,0 +1,268 @@
+//go:build linux
+// +build linux
+
+package afpacket
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcapgo"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+
+	"github.com/kor44/extcap"
+	"github.com/kor44/extcap/filter"
+)
+
+const (
+	blockSize = 1 << 20
+	frameSize = 1 << 11
+
+	// Timeout after which kernel passes not filled block to user space
+	blockTimeoutMs = 100
+
+	// Offsets in tpacket_block_desc
+	blockStatusOff   = 8
+	blockNumPktsOff  = 12
+	blockFirstPktOff = 16
+
+	// Length of Linux cooked header
+	sllHeaderLen = 16
+)
+
+// ring is TPACKET_V3 receive ring of AF_PACKET socket
+type ring struct {
+	fd     int
+	data   []byte
+	blocks int
+}
+
+// htons converts value between host and network byte order
+func htons(v uint16) uint16 {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], v)
+	return *(*uint16)(unsafe.Pointer(&b[0]))
+}
+
+func capture(cfg captureConfig, fifo io.Writer) error {
+	iface, err := net.InterfaceByName(cfg.iface)
+	if err != nil {
+		return fmt.Errorf("Unable to find interface '%s': %w", cfg.iface, err)
+	}
+
+	r, err := openRing(iface.Index, cfg)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+
+	w := pcapgo.NewWriterNanos(fifo)
+	if err = w.WriteFileHeader(uint32(cfg.snaplen), cfg.linkType); err != nil {
+		return err
+	}
+
+	handler := func(ci gopacket.CaptureInfo, data []byte) error {
+		return w.WritePacket(ci, data)
+	}
+	// kernel sees cooked packets without link header, so filter is matched
+	// here against Linux cooked header as for reported DLT
+	if cfg.cooked && cfg.filter != "" {
+		f, err := filter.New(cfg.filter, cfg.linkType)
+		if err != nil {
+			return err
+		}
+		handler = func(ci gopacket.CaptureInfo, data []byte) error {
+			if !f.Match(data) {
+				return nil
+			}
+			return w.WritePacket(ci, data)
+		}
+	}
+
+	defer r.logStats()
+	return r.read(handler, cfg)
+}
+
+func openRing(ifindex int, cfg captureConfig) (*ring, error) {
+	sockType := unix.SOCK_RAW
+	if cfg.cooked {
+		sockType = unix.SOCK_DGRAM
+	}
+
+	fd, err := unix.Socket(unix.AF_PACKET, sockType, int(htons(unix.ETH_P_ALL)))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open AF_PACKET socket: %w", err)
+	}
+	r := &ring{fd: fd}
+
+	if err = r.setup(ifindex, cfg); err != nil {
+		r.close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *ring) setup(ifindex int, cfg captureConfig) error {
+	// Filter is attached before bind, so no packet is received unfiltered.
+	// Filter of cooked packets is matched in user space.
+	if !cfg.cooked {
+		if err := r.attachFilter(cfg); err != nil {
+			return err
+		}
+	}
+
+	if err := unix.SetsockoptInt(r.fd, unix.SOL_PACKET, unix.PACKET_VERSION, unix.TPACKET_V3); err != nil {
+		return fmt.Errorf("Unable to set TPACKET_V3: %w", err)
+	}
+
+	r.blocks = cfg.bufSize / blockSize
+	if r.blocks < 1 {
+		r.blocks = 1
+	}
+	req := unix.TpacketReq3{
+		Block_size:     blockSize,
+		Block_nr:       uint32(r.blocks),
+		Frame_size:     frameSize,
+		Frame_nr:       uint32(r.blocks * blockSize / frameSize),
+		Retire_blk_tov: blockTimeoutMs,
+	}
+	if err := unix.SetsockoptTpacketReq3(r.fd, unix.SOL_PACKET, unix.PACKET_RX_RING, &req); err != nil {
+		return fmt.Errorf("Unable to set up receive ring: %w", err)
+	}
+
+	// ring pages are pinned by the kernel, so they need not be locked
+	var err error
+	r.data, err = unix.Mmap(r.fd, 0, r.blocks*blockSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return fmt.Errorf("Unable to map receive ring: %w", err)
+	}
+
+	addr := unix.SockaddrLinklayer{Protocol: htons(unix.ETH_P_ALL), Ifindex: ifindex}
+	if err = unix.Bind(r.fd, &addr); err != nil {
+		return fmt.Errorf("Unable to bind to interface '%s': %w", cfg.iface, err)
+	}
+
+	if cfg.promisc {
+		mreq := unix.PacketMreq{Ifindex: int32(ifindex), Type: unix.PACKET_MR_PROMISC}
+		if err = unix.SetsockoptPacketMreq(r.fd, unix.SOL_PACKET, unix.PACKET_ADD_MEMBERSHIP, &mreq); err != nil {
+			return fmt.Errorf("Unable to set promiscuous mode: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// attachFilter compiles capture filter for link type of the interface and attaches it to the socket
+func (r *ring) attachFilter(cfg captureConfig) error {
+	program, err := filter.Compile(cfg.filter, cfg.linkType, uint32(cfg.snaplen))
+	if err != nil {
+		return err
+	}
+	raw, err := bpf.Assemble(program)
+	if err != nil {
+		return fmt.Errorf("Unable to assemble capture filter: %w", err)
+	}
+	sockFilter := make([]unix.SockFilter, len(raw))
+	for i, ins := range raw {
+		sockFilter[i] = unix.SockFilter{Code: ins.Op, Jt: ins.Jt, Jf: ins.Jf, K: ins.K}
+	}
+	prog := unix.SockFprog{Len: uint16(len(sockFilter)), Filter: &sockFilter[0]}
+	if err = unix.SetsockoptSockFprog(r.fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &prog); err != nil {
+		return fmt.Errorf("Unable to attach capture filter: %w", err)
+	}
+	return nil
+}
+
+func (r *ring) uint32At(off int) *uint32 {
+	return (*uint32)(unsafe.Pointer(&r.data[off]))
+}
+
+// read passes all received packets to handler until it returns error
+func (r *ring) read(handler func(gopacket.CaptureInfo, []byte) error, cfg captureConfig) error {
+	pollFds := []unix.PollFd{{Fd: int32(r.fd), Events: unix.POLLIN | unix.POLLERR}}
+	hdrLen := int(tpacketAlign(unix.SizeofTpacket3Hdr))
+
+	for block := 0; ; block = (block + 1) % r.blocks {
+		base := block * blockSize
+		status := r.uint32At(base + blockStatusOff)
+
+		for atomic.LoadUint32(status)&unix.TP_STATUS_USER == 0 {
+			if _, err := unix.Poll(pollFds, -1); err != nil && err != unix.EINTR {
+				return fmt.Errorf("Poll error: %w", err)
+			}
+		}
+
+		num := int(*r.uint32At(base + blockNumPktsOff))
+		off := base + int(*r.uint32At(base + blockFirstPktOff))
+		for i := 0; i < num; i++ {
+			hdr := (*unix.Tpacket3Hdr)(unsafe.Pointer(&r.data[off]))
+			start := off + int(hdr.Mac)
+			data := r.data[start : start+int(hdr.Snaplen)]
+			length := int(hdr.Len)
+
+			if cfg.cooked {
+				data = sllPacket(r.data[off+hdrLen:], data)
+				length += sllHeaderLen
+			} else {
+				data = append([]byte(nil), data...)
+			}
+			if len(data) > cfg.snaplen {
+				data = data[:cfg.snaplen]
+			}
+
+			ci := gopacket.CaptureInfo{
+				Timestamp:     time.Unix(int64(hdr.Sec), int64(hdr.Nsec)),
+				CaptureLength: len(data),
+				Length:        length,
+			}
+			if err := handler(ci, data); err != nil {
+				atomic.StoreUint32(status, unix.TP_STATUS_KERNEL)
+				return err
+			}
+
+			off += int(hdr.Next_offset)
+		}
+
+		atomic.StoreUint32(status, unix.TP_STATUS_KERNEL)
+	}
+}
+
+// sllPacket prepends Linux cooked header built from sockaddr_ll to network layer data
+func sllPacket(sockaddr []byte, data []byte) []byte {
+	sll := (*unix.RawSockaddrLinklayer)(unsafe.Pointer(&sockaddr[0]))
+
+	packet := make([]byte, sllHeaderLen, sllHeaderLen+len(data))
+	binary.BigEndian.PutUint16(packet[0:], uint16(sll.Pkttype))
+	binary.BigEndian.PutUint16(packet[2:], sll.Hatype)
+	binary.BigEndian.PutUint16(packet[4:], uint16(sll.Halen))
+	copy(packet[6:14], sll.Addr[:])
+	binary.BigEndian.PutUint16(packet[14:], htons(sll.Protocol))
+	return append(packet, data...)
+}
+
+func tpacketAlign(x int) int {
+	return (x + unix.TPACKET_ALIGNMENT - 1) &^ (unix.TPACKET_ALIGNMENT - 1)
+}
+
+// logStats writes socket statistics to debug log
+func (r *ring) logStats() {
+	stats, err := unix.GetsockoptTpacketStatsV3(r.fd, unix.SOL_PACKET, unix.PACKET_STATISTICS)
+	if err != nil {
+		return
+	}
+	extcap.Log().Infof("AF_PACKET statistics: %d packets received, %d dropped", stats.Packets, stats.Drops)
+}
+
+func (r *ring) close() {
+	if r.data != nil {
+		unix.Munmap(r.data)
+	}
+	unix.Close(r.fd)
+}
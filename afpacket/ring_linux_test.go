@@ -0,0 +1,19 @@
+//go:build linux
+// +build linux
+
+package afpacket
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestHtons(t *testing.T) {
+	// value is stored in memory in network byte order on any host
+	v := htons(unix.ETH_P_ALL)
+	assert.Equal(t, [2]byte{0x00, 0x03}, *(*[2]byte)(unsafe.Pointer(&v)))
+	assert.Equal(t, uint16(unix.ETH_P_ALL), htons(v))
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package afpacket
+
+import "io"
+
+func capture(cfg captureConfig, fifo io.Writer) error {
+	return ErrNotSupported
+}
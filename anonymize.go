@@ -0,0 +1,420 @@
+package extcap
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Anonymization options. They are added to config of every interface when Anonymizer is in App.Middlewares.
+var (
+	Anonymize = NewConfigBoolOpt("anonymize", "Anonymize addresses").Default(false).Group("Anonymization").
+			Tooltip("IP addresses are replaced preserving common prefixes, MAC addresses are replaced keeping multicast bit")
+	AnonymizeKey = NewConfigPasswordOpt("anonymize-key", "Anonymization key").Group("Anonymization").
+			Tooltip("The same key gives the same addresses in every capture. Random key is used for every capture when it is empty")
+)
+
+// Anonymizer is built-in middleware which replaces addresses of Ethernet, raw IP and exported PDU packets
+// when Anonymize option is set. IPv4 and IPv6 addresses are anonymized with prefix-preserving Crypto-PAn,
+// MAC addresses with HMAC-SHA256, also target addresses and link-layer address options of
+// ICMPv6 neighbor discovery. Checksums of IP, TCP, UDP and ICMP headers are fixed.
+// Unspecified and broadcast addresses are kept. Payload of packets is not changed.
+// Packets of other link types are passed unchanged with warning in the log.
+var Anonymizer Middleware = anonymizer{}
+
+type anonymizer struct{}
+
+func (anonymizer) Options() []ConfigOption {
+	return []ConfigOption{Anonymize, AnonymizeKey}
+}
+
+func (anonymizer) New(linkType layers.LinkType, opts map[string]interface{}) (PacketFunc, error) {
+	if on, _ := opts[Anonymize.call()].(bool); !on {
+		return nil, nil
+	}
+
+	switch linkType {
+	case layers.LinkTypeEthernet, layers.LinkTypeRaw, layers.LinkTypeIPv4, layers.LinkTypeIPv6, LinkTypeUpperPDU:
+	default:
+		logger.Warnf("Anonymization is not supported for link type %s, packets are not changed", linkType)
+		return nil, nil
+	}
+
+	value, _ := opts[AnonymizeKey.call()].(string)
+	key := []byte(value)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("Unable to generate anonymization key: %w", err)
+		}
+		logger.Infof("Anonymization key is not set, random key is used")
+	}
+	a, err := newAddrAnonymizer(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var rewrite func(data []byte)
+	switch linkType {
+	case layers.LinkTypeEthernet:
+		rewrite = a.ethernet
+	case layers.LinkTypeRaw, layers.LinkTypeIPv4, layers.LinkTypeIPv6:
+		rewrite = func(data []byte) { a.ip(data, 0) }
+	case LinkTypeUpperPDU:
+		rewrite = a.exportedPDU
+	}
+
+	return func(ci *gopacket.CaptureInfo, data []byte) ([]byte, error) {
+		data = append([]byte(nil), data...)
+		rewrite(data)
+		return data, nil
+	}, nil
+}
+
+// maxCachedAddrs limits number of anonymized IP addresses kept in memory
+const maxCachedAddrs = 1 << 16
+
+// addrAnonymizer replaces addresses in place
+type addrAnonymizer struct {
+	block  cipher.Block
+	pad    [aes.BlockSize]byte
+	macKey []byte
+
+	ipv4Cache map[[4]byte][4]byte
+	ipv6Cache map[[16]byte][16]byte
+}
+
+// newAddrAnonymizer derives Crypto-PAn AES key and pad from SHA-256 of the key, MAC addresses are keyed by the key itself
+func newAddrAnonymizer(key []byte) (*addrAnonymizer, error) {
+	sum := sha256.Sum256(key)
+	block, err := aes.NewCipher(sum[:16])
+	if err != nil {
+		return nil, err
+	}
+
+	a := &addrAnonymizer{
+		block:     block,
+		macKey:    key,
+		ipv4Cache: make(map[[4]byte][4]byte),
+		ipv6Cache: make(map[[16]byte][16]byte),
+	}
+	block.Encrypt(a.pad[:], sum[16:])
+	return a, nil
+}
+
+// cryptoPAn anonymizes address in place. Bit i of the result is bit i of the address
+// xor the first bit of AES encrypted block made of the first i bits of the address and the pad.
+func (a *addrAnonymizer) cryptoPAn(addr []byte) {
+	var input, output [aes.BlockSize]byte
+	result := make([]byte, len(addr))
+
+	for i := 0; i < len(addr)*8; i++ {
+		n, rest := i/8, i%8
+		copy(input[:n], addr[:n])
+		copy(input[n:], a.pad[n:])
+		if rest != 0 {
+			mask := byte(0xff << (8 - rest))
+			input[n] = addr[n]&mask | a.pad[n]&^mask
+		}
+		a.block.Encrypt(output[:], input[:])
+		result[n] |= (output[0] >> 7) << (7 - rest)
+	}
+
+	for i := range addr {
+		addr[i] ^= result[i]
+	}
+}
+
+func (a *addrAnonymizer) ipv4Addr(addr []byte) {
+	var orig [4]byte
+	copy(orig[:], addr)
+	if orig == [4]byte{} || orig == [4]byte{255, 255, 255, 255} {
+		return
+	}
+	if v, ok := a.ipv4Cache[orig]; ok {
+		copy(addr, v[:])
+		return
+	}
+
+	a.cryptoPAn(addr)
+	if len(a.ipv4Cache) >= maxCachedAddrs {
+		a.ipv4Cache = make(map[[4]byte][4]byte)
+	}
+	var anon [4]byte
+	copy(anon[:], addr)
+	a.ipv4Cache[orig] = anon
+}
+
+func (a *addrAnonymizer) ipv6Addr(addr []byte) {
+	var orig [16]byte
+	copy(orig[:], addr)
+	if orig == [16]byte{} {
+		return
+	}
+	if v, ok := a.ipv6Cache[orig]; ok {
+		copy(addr, v[:])
+		return
+	}
+
+	a.cryptoPAn(addr)
+	if len(a.ipv6Cache) >= maxCachedAddrs {
+		a.ipv6Cache = make(map[[16]byte][16]byte)
+	}
+	var anon [16]byte
+	copy(anon[:], addr)
+	a.ipv6Cache[orig] = anon
+}
+
+// macAddr replaces address with locally administered one, multicast bit is kept
+func (a *addrAnonymizer) macAddr(addr []byte) {
+	var zero, broadcast = true, true
+	for _, b := range addr {
+		zero = zero && b == 0
+		broadcast = broadcast && b == 0xff
+	}
+	if zero || broadcast {
+		return
+	}
+
+	mac := hmac.New(sha256.New, a.macKey)
+	mac.Write(addr)
+	sum := mac.Sum(nil)
+	group := addr[0] & 0x01
+	copy(addr, sum[:len(addr)])
+	addr[0] = addr[0]&^0x03 | 0x02 | group
+}
+
+func (a *addrAnonymizer) ethernet(data []byte) {
+	if len(data) < 14 {
+		return
+	}
+	a.macAddr(data[0:6])
+	a.macAddr(data[6:12])
+
+	etherType, off := layers.EthernetType(binary.BigEndian.Uint16(data[12:14])), 14
+	for (etherType == layers.EthernetTypeDot1Q || etherType == layers.EthernetTypeQinQ) && len(data) >= off+4 {
+		etherType, off = layers.EthernetType(binary.BigEndian.Uint16(data[off+2:off+4])), off+4
+	}
+
+	switch etherType {
+	case layers.EthernetTypeIPv4, layers.EthernetTypeIPv6:
+		a.ip(data[off:], 0)
+	case layers.EthernetTypeARP:
+		a.arp(data[off:])
+	}
+}
+
+// arp anonymizes addresses of Ethernet/IPv4 ARP
+func (a *addrAnonymizer) arp(p []byte) {
+	if len(p) < 28 || binary.BigEndian.Uint16(p[0:2]) != 1 || binary.BigEndian.Uint16(p[2:4]) != uint16(layers.EthernetTypeIPv4) ||
+		p[4] != 6 || p[5] != 4 {
+		return
+	}
+	a.macAddr(p[8:14])
+	a.ipv4Addr(p[14:18])
+	a.macAddr(p[18:24])
+	a.ipv4Addr(p[24:28])
+}
+
+// ip anonymizes IPv4 or IPv6 packet. depth is level of packet enclosed into ICMP error.
+func (a *addrAnonymizer) ip(p []byte, depth int) {
+	if len(p) == 0 {
+		return
+	}
+	switch p[0] >> 4 {
+	case 4:
+		a.ipv4(p, depth)
+	case 6:
+		a.ipv6(p, depth)
+	}
+}
+
+func (a *addrAnonymizer) ipv4(p []byte, depth int) {
+	if len(p) < 20 {
+		return
+	}
+	var old [8]byte
+	copy(old[:], p[12:20])
+	a.ipv4Addr(p[12:16])
+	a.ipv4Addr(p[16:20])
+	adjustChecksum(p[10:12], old[:], p[12:20])
+
+	headerLen := int(p[0]&0x0f) * 4
+	if headerLen < 20 || headerLen > len(p) || binary.BigEndian.Uint16(p[6:8])&0x1fff != 0 {
+		return
+	}
+	a.transport(layers.IPProtocol(p[9]), p[headerLen:], old[:], p[12:20], depth)
+}
+
+func (a *addrAnonymizer) ipv6(p []byte, depth int) {
+	if len(p) < 40 {
+		return
+	}
+	var old [32]byte
+	copy(old[:], p[8:40])
+	a.ipv6Addr(p[8:24])
+	a.ipv6Addr(p[24:40])
+
+	next, off := layers.IPProtocol(p[6]), 40
+	for {
+		switch next {
+		case layers.IPProtocolIPv6HopByHop, layers.IPProtocolIPv6Routing, layers.IPProtocolIPv6Destination:
+			if len(p) < off+2 {
+				return
+			}
+			next, off = layers.IPProtocol(p[off]), off+(int(p[off+1])+1)*8
+			continue
+		case layers.IPProtocolIPv6Fragment:
+			if len(p) < off+8 || binary.BigEndian.Uint16(p[off+2:off+4])&0xfff8 != 0 {
+				return
+			}
+			next, off = layers.IPProtocol(p[off]), off+8
+			continue
+		}
+		break
+	}
+	if off > len(p) {
+		return
+	}
+	a.transport(next, p[off:], old[:], p[8:40], depth)
+}
+
+// transport fixes checksums which cover pseudo header with addresses and anonymizes
+// packet enclosed into ICMP error message
+func (a *addrAnonymizer) transport(proto layers.IPProtocol, p []byte, oldAddrs, newAddrs []byte, depth int) {
+	switch proto {
+	case layers.IPProtocolTCP:
+		if len(p) >= 18 {
+			adjustChecksum(p[16:18], oldAddrs, newAddrs)
+		}
+	case layers.IPProtocolUDP:
+		// zero checksum of UDP over IPv4 means it is not computed
+		if len(p) >= 8 && (len(oldAddrs) == 32 || binary.BigEndian.Uint16(p[6:8]) != 0) {
+			adjustChecksum(p[6:8], oldAddrs, newAddrs)
+			if binary.BigEndian.Uint16(p[6:8]) == 0 {
+				binary.BigEndian.PutUint16(p[6:8], 0xffff)
+			}
+		}
+	case layers.IPProtocolICMPv4:
+		if len(p) >= 8 && depth == 0 && isICMPv4Error(p[0]) {
+			a.icmpError(p)
+		}
+	case layers.IPProtocolICMPv6:
+		if len(p) >= 8 {
+			adjustChecksum(p[2:4], oldAddrs, newAddrs)
+			if depth == 0 && p[0] >= 1 && p[0] <= 4 {
+				a.icmpError(p)
+			} else if depth == 0 {
+				a.neighborDiscovery(p)
+			}
+		}
+	}
+}
+
+// icmpError anonymizes packet enclosed into ICMP error message
+func (a *addrAnonymizer) icmpError(p []byte) {
+	old := append([]byte(nil), p...)
+	a.ip(p[8:], 1)
+	adjustChecksum(p[2:4], old, p)
+}
+
+// neighborDiscovery anonymizes target addresses and link-layer address options of ICMPv6
+// neighbor discovery messages (RFC 4861)
+func (a *addrAnonymizer) neighborDiscovery(p []byte) {
+	// offset of options and number of addresses before them
+	var off, addrs int
+	switch p[0] {
+	case layers.ICMPv6TypeRouterSolicitation:
+		off = 8
+	case layers.ICMPv6TypeRouterAdvertisement:
+		off = 16
+	case layers.ICMPv6TypeNeighborSolicitation, layers.ICMPv6TypeNeighborAdvertisement:
+		off, addrs = 24, 1
+	case layers.ICMPv6TypeRedirect:
+		off, addrs = 40, 2
+	default:
+		return
+	}
+	if len(p) < off {
+		return
+	}
+
+	old := append([]byte(nil), p...)
+	for i := 0; i < addrs; i++ {
+		a.ipv6Addr(p[8+16*i : 24+16*i])
+	}
+	for len(p) >= off+2 {
+		typ, length := layers.ICMPv6Opt(p[off]), int(p[off+1])*8
+		if length == 0 || len(p) < off+length {
+			break
+		}
+		// Ethernet address fills option of 8 bytes
+		if (typ == layers.ICMPv6OptSourceAddress || typ == layers.ICMPv6OptTargetAddress) && length == 8 {
+			a.macAddr(p[off+2 : off+8])
+		}
+		off += length
+	}
+	adjustChecksum(p[2:4], old, p)
+}
+
+// isICMPv4Error reports whether ICMP message of given type contains original datagram
+func isICMPv4Error(typ byte) bool {
+	switch typ {
+	case layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4TypeSourceQuench, layers.ICMPv4TypeRedirect,
+		layers.ICMPv4TypeTimeExceeded, layers.ICMPv4TypeParameterProblem:
+		return true
+	}
+	return false
+}
+
+// exportedPDU anonymizes address tags of exported PDU header
+func (a *addrAnonymizer) exportedPDU(data []byte) {
+	for off := 0; len(data) >= off+4; {
+		tag, length := binary.BigEndian.Uint16(data[off:]), int(binary.BigEndian.Uint16(data[off+2:]))
+		value := data[off+4:]
+		if tag == pduTagEnd || len(value) < length {
+			return
+		}
+		switch {
+		case (tag == pduTagIPv4Src || tag == pduTagIPv4Dst) && length >= 4:
+			a.ipv4Addr(value[:4])
+		case (tag == pduTagIPv6Src || tag == pduTagIPv6Dst) && length >= 16:
+			a.ipv6Addr(value[:16])
+		}
+		off += 4 + length
+	}
+}
+
+// adjustChecksum updates internet checksum after data covered by it is changed
+// from old to new (RFC 1624). Both are at even offset of checksummed data.
+func adjustChecksum(checksum, old, new []byte) {
+	sum := uint32(^binary.BigEndian.Uint16(checksum))
+	sum += uint32(^onesSum(old))
+	sum += uint32(onesSum(new))
+	for sum > 0xffff {
+		sum = sum&0xffff + sum>>16
+	}
+	binary.BigEndian.PutUint16(checksum, ^uint16(sum))
+}
+
+// onesSum returns one's complement sum of 16-bit words, odd byte is padded with zero
+func onesSum(data []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i:]))
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum&0xffff + sum>>16
+	}
+	return uint16(sum)
+}
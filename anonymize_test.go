@@ -0,0 +1,289 @@
+package extcap
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"math/bits"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// commonPrefix returns number of leading bits which are equal in both addresses
+func commonPrefix(a, b net.IP) int {
+	n := 0
+	for i := range a {
+		if a[i] != b[i] {
+			return n + bits.LeadingZeros8(a[i]^b[i])
+		}
+		n += 8
+	}
+	return n
+}
+
+func anonymizeIP(a *addrAnonymizer, s string) net.IP {
+	ip := net.ParseIP(s)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = append(net.IP(nil), ip4...)
+		a.ipv4Addr(ip)
+	} else {
+		ip = append(net.IP(nil), ip...)
+		a.ipv6Addr(ip)
+	}
+	return ip
+}
+
+func TestCryptoPAn(t *testing.T) {
+	a, err := newAddrAnonymizer([]byte("secret"))
+	require.NoError(t, err)
+	other, err := newAddrAnonymizer([]byte("other secret"))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		a, b   string
+		prefix int
+	}{
+		{"10.0.0.1", "10.0.0.2", 30},
+		{"192.168.1.10", "192.168.7.10", 21},
+		{"10.1.2.3", "172.16.2.3", 0},
+		{"2001:db8::1", "2001:db8:0:1::1", 63},
+		{"2001:db8::1", "fe80::1", 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.a+" "+tc.b, func(t *testing.T) {
+			x, y := anonymizeIP(a, tc.a), anonymizeIP(a, tc.b)
+			assert.Equal(t, tc.prefix, commonPrefix(x, y), "prefix is preserved")
+			assert.NotEqual(t, net.ParseIP(tc.a).String(), x.String())
+
+			// result is deterministic for the key and it does not depend on the cache
+			fresh, err := newAddrAnonymizer([]byte("secret"))
+			require.NoError(t, err)
+			assert.Equal(t, x, anonymizeIP(fresh, tc.a))
+			assert.Equal(t, x, anonymizeIP(a, tc.a))
+			assert.NotEqual(t, x, anonymizeIP(other, tc.a))
+		})
+	}
+
+	assert.Equal(t, "255.255.255.255", anonymizeIP(a, "255.255.255.255").String())
+	assert.Equal(t, "::", anonymizeIP(a, "::").String())
+}
+
+func TestCryptoPAnKnownAnswers(t *testing.T) {
+	// key and addresses of the reference implementation by Xu et al.: the first half
+	// of the key is AES key, the second half encrypted with it is the pad
+	key := []byte{21, 34, 23, 141, 51, 164, 207, 128, 19, 10, 91, 22, 73, 144, 125, 16,
+		216, 152, 143, 131, 121, 121, 101, 39, 98, 87, 76, 45, 42, 132, 34, 2}
+	block, err := aes.NewCipher(key[:16])
+	require.NoError(t, err)
+	a := &addrAnonymizer{block: block}
+	block.Encrypt(a.pad[:], key[16:])
+
+	vectors := []struct {
+		addr, anon string
+	}{
+		{"128.11.68.132", "135.242.180.132"},
+		{"129.118.74.4", "134.136.186.123"},
+		{"130.132.252.244", "133.68.164.234"},
+		{"141.223.7.43", "141.167.8.160"},
+		{"192.102.249.13", "252.138.62.131"},
+		{"207.105.49.5", "241.118.205.138"},
+		{"24.0.250.221", "100.15.198.226"},
+		{"4.3.88.225", "124.60.155.63"},
+		{"63.14.55.111", "95.9.215.7"},
+		{"64.39.15.238", "0.219.7.41"},
+	}
+	for _, v := range vectors {
+		addr := net.ParseIP(v.addr).To4()
+		a.cryptoPAn(addr)
+		assert.Equal(t, v.anon, addr.String(), v.addr)
+	}
+}
+
+func TestAnonymizeMAC(t *testing.T) {
+	a, err := newAddrAnonymizer([]byte("secret"))
+	require.NoError(t, err)
+
+	unicast, _ := net.ParseMAC("00:11:22:33:44:55")
+	a.macAddr(unicast)
+	assert.NotEqual(t, "00:11:22:33:44:55", unicast.String())
+	assert.Equal(t, byte(0x02), unicast[0]&0x03, "locally administered unicast")
+
+	multicast, _ := net.ParseMAC("01:00:5e:00:00:01")
+	a.macAddr(multicast)
+	assert.Equal(t, byte(0x03), multicast[0]&0x03, "locally administered multicast")
+
+	broadcast, _ := net.ParseMAC("ff:ff:ff:ff:ff:ff")
+	a.macAddr(broadcast)
+	assert.Equal(t, "ff:ff:ff:ff:ff:ff", broadcast.String())
+}
+
+// checkChecksums verifies checksums of all layers decoded by gopacket
+func checkChecksums(t *testing.T, data []byte, linkType layers.LinkType) gopacket.Packet {
+	packet := gopacket.NewPacket(data, linkType, gopacket.Default)
+	require.Nil(t, packet.ErrorLayer())
+
+	var pseudo []byte
+	for _, l := range packet.Layers() {
+		switch l := l.(type) {
+		case *layers.IPv4:
+			if pseudo != nil {
+				// header of original datagram in ICMP error
+				continue
+			}
+			assert.Equal(t, uint16(0xffff), onesSum(l.Contents), "IPv4 checksum")
+			pseudo = append(append([]byte(nil), l.SrcIP.To4()...), l.DstIP.To4()...)
+			pseudo = append(pseudo, 0, byte(l.Protocol), 0, 0)
+			binary.BigEndian.PutUint16(pseudo[10:], l.Length-uint16(len(l.Contents)))
+		case *layers.IPv6:
+			if pseudo != nil {
+				continue
+			}
+			pseudo = append(append([]byte(nil), l.SrcIP...), l.DstIP...)
+			pseudo = append(pseudo, 0, 0, 0, 0, 0, 0, 0, byte(l.NextHeader))
+			binary.BigEndian.PutUint16(pseudo[34:], l.Length)
+		case *layers.TCP, *layers.UDP, *layers.ICMPv6:
+			segment := append(append([]byte(nil), l.LayerContents()...), l.LayerPayload()...)
+			assert.Equal(t, uint16(0xffff), onesSum(append(pseudo, segment...)), "%s checksum", l.LayerType())
+			return packet
+		case *layers.ICMPv4:
+			segment := append(append([]byte(nil), l.LayerContents()...), l.LayerPayload()...)
+			assert.Equal(t, uint16(0xffff), onesSum(segment), "ICMPv4 checksum")
+			return packet
+		}
+	}
+	return packet
+}
+
+func TestAnonymizer(t *testing.T) {
+	opts := map[string]interface{}{Anonymize.call(): true, AnonymizeKey.call(): "secret"}
+	flows := []Flow{
+		{layers.IPProtocolUDP, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 5000, 514},
+		{layers.IPProtocolTCP, net.ParseIP("10.0.0.1"), net.ParseIP("192.168.1.1"), 40000, 8080},
+		{layers.IPProtocolUDP, net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"), 5000, 514},
+		{layers.IPProtocolTCP, net.ParseIP("2001:db8::1"), net.ParseIP("fe80::1"), 40000, 8080},
+	}
+
+	for _, linkType := range []layers.LinkType{layers.LinkTypeEthernet, layers.LinkTypeRaw} {
+		f, err := Anonymizer.New(linkType, opts)
+		require.NoError(t, err)
+
+		b, err := NewPacketBuilder(linkType)
+		require.NoError(t, err)
+		for _, flow := range flows {
+			t.Run(linkType.String()+" "+flow.key(), func(t *testing.T) {
+				frame, err := b.Build(flow, []byte("payload"))
+				require.NoError(t, err)
+				orig := append([]byte(nil), frame...)
+
+				ci := gopacket.CaptureInfo{CaptureLength: len(frame), Length: len(frame)}
+				data, err := f(&ci, frame)
+				require.NoError(t, err)
+				assert.Equal(t, orig, frame, "input is not changed")
+				require.Len(t, data, len(frame))
+
+				packet := checkChecksums(t, data, linkType)
+				src, dst := packet.NetworkLayer().NetworkFlow().Endpoints()
+				assert.NotEqual(t, flow.SrcIP.String(), src.String())
+				assert.NotEqual(t, flow.DstIP.String(), dst.String())
+				assert.Equal(t, []byte("payload"), packet.ApplicationLayer().Payload())
+				if eth, ok := packet.LinkLayer().(*layers.Ethernet); ok {
+					assert.NotEqual(t, b.srcMAC, eth.SrcMAC)
+				}
+			})
+		}
+	}
+
+	f, err := Anonymizer.New(LinkTypeUser0, opts)
+	assert.NoError(t, err)
+	assert.Nil(t, f, "unsupported link type is passed unchanged")
+
+	f, err = Anonymizer.New(layers.LinkTypeLinuxSLL, map[string]interface{}{Anonymize.call(): false})
+	assert.NoError(t, err)
+	assert.Nil(t, f, "disabled")
+}
+
+func TestAnonymizeICMPError(t *testing.T) {
+	b, err := NewPacketBuilder(layers.LinkTypeIPv4)
+	require.NoError(t, err)
+	inner, err := b.Build(
+		Flow{layers.IPProtocolUDP, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 5000, 514}, []byte("payload"))
+	require.NoError(t, err)
+
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolICMPv4, SrcIP: net.ParseIP("10.0.0.2").To4(), DstIP: net.ParseIP("10.0.0.1").To4()}
+	icmp := &layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodePort)}
+	buf := gopacket.NewSerializeBuffer()
+	require.NoError(t, gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		ip, icmp, gopacket.Payload(inner)))
+
+	f, err := Anonymizer.New(layers.LinkTypeRaw, map[string]interface{}{Anonymize.call(): true, AnonymizeKey.call(): "secret"})
+	require.NoError(t, err)
+	data, err := f(&gopacket.CaptureInfo{}, buf.Bytes())
+	require.NoError(t, err)
+
+	packet := checkChecksums(t, data, layers.LinkTypeRaw)
+	outer := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	enclosed := packet.Layer(layers.LayerTypeICMPv4).LayerPayload()
+	assert.Equal(t, outer.DstIP.To4(), net.IP(enclosed[12:16]), "source of original datagram")
+	assert.Equal(t, outer.SrcIP.To4(), net.IP(enclosed[16:20]), "destination of original datagram")
+	assert.Equal(t, uint16(0xffff), onesSum(enclosed[:20]), "checksum of original datagram")
+}
+
+func TestAnonymizeNeighborDiscovery(t *testing.T) {
+	srcMAC, _ := net.ParseMAC("00:11:22:33:44:55")
+	targetMAC, _ := net.ParseMAC("00:66:77:88:99:aa")
+	target := net.ParseIP("2001:db8::2")
+
+	ip := &layers.IPv6{Version: 6, HopLimit: 255, NextHeader: layers.IPProtocolICMPv6, SrcIP: net.ParseIP("2001:db8::1"), DstIP: net.ParseIP("ff02::1:ff00:2")}
+	icmp := &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeNeighborSolicitation, 0)}
+	require.NoError(t, icmp.SetNetworkLayerForChecksum(ip))
+	ns := &layers.ICMPv6NeighborSolicitation{TargetAddress: target, Options: layers.ICMPv6Options{
+		{Type: layers.ICMPv6OptSourceAddress, Data: srcMAC},
+		{Type: layers.ICMPv6OptTargetAddress, Data: targetMAC},
+	}}
+	buf := gopacket.NewSerializeBuffer()
+	require.NoError(t, gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, ip, icmp, ns))
+
+	f, err := Anonymizer.New(layers.LinkTypeRaw, map[string]interface{}{Anonymize.call(): true, AnonymizeKey.call(): "secret"})
+	require.NoError(t, err)
+	data, err := f(&gopacket.CaptureInfo{}, buf.Bytes())
+	require.NoError(t, err)
+
+	packet := checkChecksums(t, data, layers.LinkTypeRaw)
+	anon := packet.Layer(layers.LayerTypeICMPv6NeighborSolicitation).(*layers.ICMPv6NeighborSolicitation)
+	a, err := newAddrAnonymizer([]byte("secret"))
+	require.NoError(t, err)
+	assert.Equal(t, anonymizeIP(a, target.String()), anon.TargetAddress)
+	require.Len(t, anon.Options, 2)
+	for _, opt := range anon.Options {
+		expected := append(net.HardwareAddr(nil), srcMAC...)
+		if opt.Type == layers.ICMPv6OptTargetAddress {
+			expected = append(net.HardwareAddr(nil), targetMAC...)
+		}
+		a.macAddr(expected)
+		assert.Equal(t, []byte(expected), opt.Data, "%s", opt.Type)
+	}
+	assert.False(t, bytes.Contains(data, srcMAC))
+	assert.False(t, bytes.Contains(data, targetMAC))
+}
+
+func TestAnonymizeExportedPDU(t *testing.T) {
+	flow := &Flow{layers.IPProtocolUDP, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 5000, 514}
+	pdu := ExportPDU("syslog", flow, []byte("<13>message"))
+
+	f, err := Anonymizer.New(LinkTypeUpperPDU, map[string]interface{}{Anonymize.call(): true, AnonymizeKey.call(): "secret"})
+	require.NoError(t, err)
+	data, err := f(&gopacket.CaptureInfo{}, pdu)
+	require.NoError(t, err)
+
+	a, err := newAddrAnonymizer([]byte("secret"))
+	require.NoError(t, err)
+	expected := ExportPDU("syslog", &Flow{flow.Protocol, anonymizeIP(a, "10.0.0.1"), anonymizeIP(a, "10.0.0.2"), 5000, 514}, []byte("<13>message"))
+	assert.Equal(t, expected, data)
+	assert.False(t, bytes.Contains(data, net.ParseIP("10.0.0.1").To4()))
+}
@@ -1,12 +1,17 @@
 package extcap
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/google/gopacket/layers"
 	"github.com/urfave/cli/v2"
+
+	"github.com/kor44/extcap/filter"
 )
 
 // App is the main structure of a extcap application.
@@ -46,17 +51,126 @@ type App struct {
 	// GetAllConfigOptions retrun all possible configuration options. Optional (all interfaces have not configuration options).
 	GetAllConfigOptions func() []ConfigOption
 
-	// StartCapture starts capture process. Should be implement. opts is configuration options for capture on given interface
-	// which depends on interface
+	// StartCapture starts capture process. Should be implement. opts contains values of options returned by
+	// GetConfigOptions for the interface (GetAllConfigOptions when it is not defined), options of the library
+	// (e.g. stop conditions and middlewares) are not included. Option which is not given by the user has its
+	// default value, bool option is false. Values have type of the option: string (also for selectors,
+	// multicheck values are comma separated), int, float64 or bool.
 	StartCapture func(iface string, fifo io.WriteCloser, filter string, opts map[string]interface{}) error
 
 	// OpenPipe opens fifo pipe to write capture results. If it not defined then default is used.
 	OpenPipe func(string) (io.WriteCloser, error)
+
+	// ValidateFilter checks capture filter for given interface. It is called by Wireshark while
+	// user types the filter. Text of returned error is shown to the user. Optional: by default
+	// the filter is compiled to BPF for DLT of the interface.
+	ValidateFilter func(iface, filter string) error
+
+	// ReloadOption returns new values of selector option with given call name. Optional.
+	// It is called when user presses reload button of option created with Reload(true).
+	ReloadOption func(iface, call string) ([]SelectorValue, error)
+
+	// GetControls returns interface toolbar controls. Optional
+	GetControls func() []*Control
+
+	// Cache enables caching of interfaces, DLT and config queries. Optional
+	Cache *QueryCache
+
+	// FilterCapture enables capture filter in userspace. Packets written by StartCapture
+	// are checked against --extcap-capture-filter before they reach the fifo.
+	// Useful for sources which are not able to apply the filter themselves.
+	FilterCapture bool
+
+	// StopConditions adds options --max-packets, --max-bytes and --max-duration to config
+	// of every interface. Capture is stopped when any of them is reached: writes to the fifo
+	// fail with ErrCaptureStopped and StartCapture is expected to return.
+	StopConditions bool
+
+	// RingBuffer adds options to save copy of the capture to rotating files to config
+	// of every interface. Capture goes on when Wireshark closes the fifo.
+	RingBuffer bool
+
+	// OutputBuffer adds options of memory buffer between StartCapture and the fifo to config
+	// of every interface. When Wireshark does not keep up, StartCapture is blocked or packets
+	// are dropped according to the buffer policy. Dropped packets are reported in status bar.
+	OutputBuffer bool
+
+	// InterfaceStats makes output pcapng with interface statistics blocks. Counters reported
+	// by StartCapture with ReportStats are combined with counters of the library
+	// (packets dropped by filter and output buffer) and written periodically and at the end.
+	// Statistics blocks of pcapng written by StartCapture are not passed to the fifo, counters
+	// of interface 0 from them are used instead of counters reported with ReportStats.
+	InterfaceStats bool
+
+	// Middlewares process packets written by StartCapture in the given order before they reach
+	// the fifo, after capture filter of FilterCapture. Options of middlewares are added to config
+	// of every interface. Built-in middlewares are Truncate, Deduplicate, ShiftTime, SlicePayload
+	// and Anonymizer.
+	Middlewares []Middleware
+
+	registry *Registry
+}
+
+// Register adds capture sources to the application. Hooks which are not set
+// explicitly are dispatched to the source which provides the interface.
+func (extapp *App) Register(sources ...Source) {
+	if extapp.registry == nil {
+		extapp.registry = &Registry{}
+	}
+	extapp.registry.Register(sources...)
+}
+
+// useSources sets hooks which are not defined to registered sources
+func (extapp *App) useSources() {
+	r := extapp.registry
+	if r == nil {
+		return
+	}
+
+	if extapp.GetInterfaces == nil {
+		extapp.GetInterfaces = r.Interfaces
+	}
+	if extapp.GetDLT == nil {
+		extapp.GetDLT = r.DLT
+	}
+	if extapp.GetConfigOptions == nil {
+		extapp.GetConfigOptions = r.ConfigOptions
+	}
+	if extapp.GetAllConfigOptions == nil {
+		extapp.GetAllConfigOptions = r.AllConfigOptions
+	}
+	if extapp.StartCapture == nil {
+		extapp.StartCapture = r.StartCapture
+	}
+	if extapp.ReloadOption == nil {
+		extapp.ReloadOption = r.ReloadOption
+	}
+	if extapp.GetControls == nil {
+		extapp.GetControls = r.Controls
+	}
+	if extapp.ValidateFilter == nil {
+		extapp.ValidateFilter = r.ValidateFilter
+	}
 }
 
 // Runs main loop application
 func (extapp App) Run(arguments []string) {
+	if err := extapp.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(-1)
+	}
+
+	app := extapp.cliApp()
+	if err := app.Run(arguments); err != nil {
+		fmt.Fprintln(os.Stderr, logger.redact(err.Error()))
+		os.Exit(-1)
+	}
+}
+
+// cliApp creates command line application with extcap flags and flags of config options
+func (extapp *App) cliApp() *cli.App {
 	app := cli.NewApp()
+	extapp.useSources()
 
 	// set version information
 	if extapp.Version.Info == "" {
@@ -88,6 +202,11 @@ func (extapp App) Run(arguments []string) {
 			Usage: "list the extcap Interfaces",
 		},
 
+		&cli.StringFlag{
+			Name:  "extcap-version",
+			Usage: "version of Wireshark `<version>`",
+		},
+
 		&cli.BoolFlag{
 			Name:  "extcap-dlts",
 			Usage: "list the DLTs",
@@ -103,6 +222,11 @@ func (extapp App) Run(arguments []string) {
 			Usage: "list the additional configuration for an interface",
 		},
 
+		&cli.StringFlag{
+			Name:  "extcap-reload-option",
+			Usage: "reload values of the option `<call>`",
+		},
+
 		&cli.BoolFlag{
 			Name:  "capture",
 			Usage: "run the capture",
@@ -115,62 +239,270 @@ func (extapp App) Run(arguments []string) {
 
 		&cli.StringFlag{
 			Name:  "fifo",
-			Usage: "dump data to file or `<fifo>`",
+			Usage: "dump data to file or `<fifo>`, - is stdout",
+		},
+
+		&cli.StringFlag{
+			Name:  "config-file",
+			Usage: "read options from `<file>` with lines name=value",
+		},
+
+		&cli.StringFlag{
+			Name:  "extcap-profile",
+			Usage: "read options from YAML or JSON `<file>` with presets",
+		},
+
+		&cli.StringFlag{
+			Name:  "extcap-preset",
+			Usage: "use `<name>` preset of the profile",
+		},
+
+		&cli.StringFlag{
+			Name:  "extcap-control-in",
+			Usage: "receive toolbar control messages from `<pipe>`",
+		},
+
+		&cli.StringFlag{
+			Name:  "extcap-control-out",
+			Usage: "send toolbar control messages to `<pipe>`",
+		},
+
+		&cli.BoolFlag{
+			Name:  "debug",
+			Usage: "print additional messages",
+		},
+
+		&cli.StringFlag{
+			Name:  "debug-file",
+			Usage: "print debug messages to file `<file>`",
 		},
 
-		// { "debug", no_argument, NULL, EXTCAP_OPT_DEBUG}, \
-		// { "debug-file", required_argument, NULL, EXTCAP_OPT_DEBUG_FILE}
+		&cli.BoolFlag{
+			Name:  "debug-stderr",
+			Usage: "print debug messages to stderr",
+		},
 	}
 
 	if extapp.GetAllConfigOptions != nil {
-		opts := extapp.GetAllConfigOptions()
-		for _, opt := range opts {
-			switch opt.(type) {
-			case *ConfigStringOpt:
-				app.Flags = append(app.Flags, &cli.StringFlag{
-					Name:  opt.call(),
-					Usage: opt.display(),
-				})
-			case *ConfigBoolOpt:
-				app.Flags = append(app.Flags, &cli.BoolFlag{
-					Name:  opt.call(),
-					Usage: opt.display(),
-				})
-			case *ConfigIntegerOpt:
-				app.Flags = append(app.Flags, &cli.IntFlag{
-					Name:  opt.call(),
-					Usage: opt.display(),
-				})
-			// case *SelectorConfig:
-			default:
-				errStr := fmt.Sprintf("Unknown config option type: %T", opt)
-				panic(errStr)
-			}
+		for _, opt := range extapp.GetAllConfigOptions() {
+			flag, _ := optionFlag(opt)
+			app.Flags = append(app.Flags, flag)
 		}
 	}
+	for _, opt := range extapp.libraryOptions() {
+		flag, _ := optionFlag(opt)
+		app.Flags = append(app.Flags, flag)
+	}
 
+	app.Before = extapp.loadOptions
 	app.Action = extapp.mainAction
+	app.Commands = []*cli.Command{
+		{
+			Name:   "print-profile",
+			Usage:  "print effective values of options as profile preset",
+			Action: extapp.printProfile,
+		},
+	}
+	return app
+}
 
-	if err := app.Run(arguments); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(-1)
+// Flags handled by the library itself. Config options can't use their names.
+var libraryFlags = map[string]bool{
+	"extcap-interfaces":     true,
+	"extcap-version":        true,
+	"extcap-dlts":           true,
+	"extcap-interface":      true,
+	"extcap-config":         true,
+	"extcap-reload-option":  true,
+	"capture":               true,
+	"extcap-capture-filter": true,
+	"fifo":                  true,
+	"config-file":           true,
+	"extcap-profile":        true,
+	"extcap-preset":         true,
+	"extcap-control-in":     true,
+	"extcap-control-out":    true,
+	"debug":                 true,
+	"debug-file":            true,
+	"debug-stderr":          true,
+}
+
+// captureOptions returns values of config options of the interface passed to StartCapture.
+// Default value of the option is used when it is not set, so options shared by several
+// sources have default of the source which provides the interface.
+func (extapp *App) captureOptions(ctx *cli.Context, iface string) (map[string]interface{}, error) {
+	var ifaceOpts []ConfigOption
+	switch {
+	case extapp.GetConfigOptions != nil:
+		var err error
+		if ifaceOpts, err = extapp.GetConfigOptions(iface); err != nil {
+			return nil, err
+		}
+	case extapp.GetAllConfigOptions != nil:
+		ifaceOpts = extapp.GetAllConfigOptions()
 	}
+
+	opts := make(map[string]interface{})
+	for _, opt := range ifaceOpts {
+		if ctx.IsSet(opt.call()) {
+			opts[opt.call()] = ctx.Value(opt.call())
+		} else {
+			opts[opt.call()] = defaultValue(opt)
+		}
+	}
+	return opts, nil
 }
 
-func (extapp *App) mainAction(ctx *cli.Context) error {
+// invokedMode returns name of the mode in which application was called by Wireshark
+func invokedMode(ctx *cli.Context) string {
+	switch {
+	case ctx.IsSet("extcap-interfaces"):
+		return "interfaces"
+	case ctx.IsSet("extcap-dlts"):
+		return "dlts"
+	case ctx.IsSet("extcap-reload-option"):
+		return "reload-option"
+	case ctx.IsSet("extcap-config"):
+		return "config"
+	case ctx.IsSet("capture"):
+		return "capture"
+	case ctx.IsSet("extcap-capture-filter"):
+		return "validate-filter"
+	}
+	return "help"
+}
 
-	// Print all interfaces
-	if showIface := ctx.IsSet("extcap-interfaces"); showIface {
-		ifaces, err := extapp.GetInterfaces()
+// setupLogger configures logger according to debug flags.
+// Returned function closes the debug file.
+func setupLogger(ctx *cli.Context) (func(), error) {
+	level := LevelInfo
+	if ctx.Bool("debug") {
+		level = LevelDebug
+	}
+
+	var outputs []io.Writer
+	closeFunc := func() {}
+	if name := ctx.String("debug-file"); name != "" {
+		file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
 		if err != nil {
+			return nil, fmt.Errorf("Unable to open debug file: %w", err)
+		}
+		outputs = append(outputs, file)
+		closeFunc = func() { file.Close() }
+	}
+	if ctx.Bool("debug-stderr") {
+		outputs = append(outputs, os.Stderr)
+	}
+
+	logger.configure(level, invokedMode(ctx), outputs...)
+	return closeFunc, nil
+}
+
+// loadOptions sets options which are not given in command line from config file and profile.
+// Passwords are redacted in every mode, for capture their values are resolved.
+func (extapp *App) loadOptions(ctx *cli.Context) error {
+	if name := ctx.String("config-file"); name != "" {
+		if err := loadConfigFile(ctx, name); err != nil {
 			return err
 		}
+	}
+	if name := ctx.String("extcap-profile"); name != "" {
+		if err := extapp.loadProfile(ctx, name, ctx.String("extcap-preset")); err != nil {
+			return err
+		}
+	}
+	return extapp.resolveSecrets(ctx, ctx.Bool("capture"))
+}
 
-		fmt.Println(extapp.Version)
-		for i := range ifaces {
-			fmt.Println(ifaces[i])
+func (extapp *App) mainAction(ctx *cli.Context) (err error) {
+	closeLog, err := setupLogger(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	args := make([]string, 0, len(ctx.FlagNames()))
+	for _, name := range ctx.FlagNames() {
+		args = append(args, fmt.Sprintf("--%s=%v", name, ctx.Value(name)))
+	}
+	logger.Debugf("Arguments: %s", strings.Join(args, " "))
+	defer func() {
+		if err != nil {
+			logger.Errorf("%s", err)
 		}
+	}()
+
+	if err = extapp.setHostVersion(ctx); err != nil {
+		return err
+	}
+	logger.Debugf("Wireshark version: %s", hostVersion)
+
+	return extapp.runMode(ctx)
+}
 
+// setHostVersion sets version of Wireshark passed with --extcap-interfaces and stores it
+// in cache directory. In other modes the stored version is used.
+func (extapp *App) setHostVersion(ctx *cli.Context) (err error) {
+	var dir string
+	if extapp.Cache != nil {
+		dir = extapp.Cache.Dir
+	}
+	if dir, err = cacheDir(dir, ctx.App.Name); err != nil {
+		logger.Warnf("Wireshark version is not stored: %s", err)
+	}
+
+	switch {
+	case ctx.IsSet("extcap-version"):
+		if hostVersion, err = parseVersion(ctx.String("extcap-version")); err != nil {
+			return err
+		}
+	case ctx.IsSet("extcap-interfaces"):
+		hostVersion = legacyVersion
+	case dir != "":
+		hostVersion = storedHostVersion(dir)
+		return nil
+	default:
+		hostVersion = WiresharkVersion{}
+		return nil
+	}
+
+	if dir != "" && ctx.IsSet("extcap-interfaces") {
+		storeHostVersion(dir, hostVersion)
+	}
+	return nil
+}
+
+func (extapp *App) runMode(ctx *cli.Context) error {
+	// cached results depend on the build of application and version of Wireshark
+	build := buildID(extapp.Version.Info)
+
+	// Print all interfaces
+	if showIface := ctx.IsSet("extcap-interfaces"); showIface {
+		key := fmt.Sprintf("interfaces/%s/%s", build, hostVersion)
+		output, err := extapp.Cache.query(ctx.App.Name, key, func() (string, error) {
+			ifaces, err := extapp.GetInterfaces()
+			if err != nil {
+				return "", err
+			}
+
+			w := new(strings.Builder)
+			fmt.Fprintln(w, extapp.Version)
+			for i := range ifaces {
+				fmt.Fprintln(w, ifaces[i])
+			}
+
+			if Supports(FeatureToolbarControls) {
+				for _, ctrl := range extapp.controls() {
+					fmt.Fprintln(w, ctrl)
+				}
+			}
+			return w.String(), nil
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Print(output)
 		return nil
 	}
 
@@ -181,19 +513,24 @@ func (extapp *App) mainAction(ctx *cli.Context) error {
 		}
 
 		iface := ctx.String("extcap-interface")
-		dlt, err := extapp.GetDLT(iface)
+		output, err := extapp.Cache.query(ctx.App.Name, fmt.Sprintf("dlts/%s/%s", build, iface), func() (string, error) {
+			dlt, err := extapp.GetDLT(iface)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintln(dlt), nil
+		})
 		if err != nil {
 			return err
 		}
 
-		fmt.Println(dlt)
+		fmt.Print(output)
 		return nil
 	}
 
-	// Print config options for given interface
-	if ctx.IsSet("extcap-config") {
-		// Return immediately in the case if confg options are not supported
-		if extapp.GetConfigOptions == nil {
+	// Print new values of selector option
+	if ctx.IsSet("extcap-reload-option") {
+		if extapp.ReloadOption == nil || extapp.GetConfigOptions == nil {
 			return nil
 		}
 
@@ -202,19 +539,73 @@ func (extapp *App) mainAction(ctx *cli.Context) error {
 		}
 
 		iface := ctx.String("extcap-interface")
+		call := ctx.String("extcap-reload-option")
 		opts, err := extapp.GetConfigOptions(iface)
 		if err != nil {
 			return err
 		}
 
-		for i := range opts {
-			opts[i].setNumber(i)
-			fmt.Println(opts[i])
+		// values refer to option by its number in config output
+		number := -1
+		for i, opt := range supportedOptions(opts) {
+			if opt.call() == call {
+				number = i
+			}
+		}
+		if number < 0 {
+			return fmt.Errorf("Unknown option '%s'", call)
+		}
+
+		values, err := extapp.ReloadOption(iface, call)
+		if err != nil {
+			return err
+		}
+
+		for _, line := range formatValues(number, values) {
+			fmt.Println(line)
 		}
 
 		return nil
 	}
 
+	// Print config options for given interface
+	if ctx.IsSet("extcap-config") {
+		// Return immediately in the case if confg options are not supported
+		if extapp.GetConfigOptions == nil && len(extapp.libraryOptions()) == 0 {
+			return nil
+		}
+
+		if !ctx.IsSet("extcap-interface") {
+			return ErrNoInterfaceSpecified
+		}
+
+		iface := ctx.String("extcap-interface")
+		output, err := extapp.Cache.query(ctx.App.Name, fmt.Sprintf("config/%s/%s/%s", build, hostVersion, iface), func() (string, error) {
+			var opts []ConfigOption
+			if extapp.GetConfigOptions != nil {
+				var err error
+				if opts, err = extapp.GetConfigOptions(iface); err != nil {
+					return "", err
+				}
+			}
+			opts = append(opts, extapp.libraryOptions()...)
+
+			w := new(strings.Builder)
+			opts = supportedOptions(opts)
+			for i := range opts {
+				opts[i].setNumber(i)
+				fmt.Fprintln(w, opts[i])
+			}
+			return w.String(), nil
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Print(output)
+		return nil
+	}
+
 	// Print config options for given interface
 	if ctx.IsSet("capture") {
 		if !ctx.IsSet("extcap-interface") {
@@ -228,12 +619,22 @@ func (extapp *App) mainAction(ctx *cli.Context) error {
 		fifo := ctx.String("fifo")
 		filter := ctx.String("extcap-capture-filter")
 
-		opts := make(map[string]interface{})
-		for _, name := range ctx.FlagNames() {
-			if name == "extcap-interface" || name == "fifo" || name == "extcap-capture-filter" {
-				continue
+		if err := extapp.checkOptions(ctx, iface); err != nil {
+			return err
+		}
+		opts, err := extapp.captureOptions(ctx, iface)
+		if err != nil {
+			return err
+		}
+
+		logger.Debugf("Start capture on interface '%s' with filter '%s'", iface, filter)
+
+		if ctx.IsSet("extcap-control-in") || ctx.IsSet("extcap-control-out") {
+			err := toolbar.open(ctx.String("extcap-control-in"), ctx.String("extcap-control-out"), extapp.controls())
+			if err != nil {
+				return err
 			}
-			opts[name] = ctx.Generic(name)
+			defer toolbar.close()
 		}
 
 		openPipeFunc := extapp.OpenPipe
@@ -246,23 +647,170 @@ func (extapp *App) mainAction(ctx *cli.Context) error {
 			return err
 		}
 
-		if err = extapp.StartCapture(iface, pipe, filter, opts); err != nil {
+		var stages []stageFunc
+		filters := 0
+		if extapp.FilterCapture && filter != "" {
+			stages = append(stages, filterStage(filter))
+			filters++
+		}
+		for _, m := range extapp.Middlewares {
+			stages = append(stages, middlewareStage(ctx, m))
+		}
+
+		var ring *ringBuffer
+		if extapp.RingBuffer && ctx.String(RingFile.call()) != "" {
+			ring = newRingBuffer(
+				ctx.String(RingFile.call()),
+				int64(ctx.Int(RingSize.call()))*1024,
+				time.Duration(ctx.Int(RingInterval.call()))*time.Second,
+				ctx.Int(RingFiles.call()),
+			)
+			stages = append(stages, ring.stage())
+			pipe = &detachedPipe{WriteCloser: pipe}
+		}
+
+		var duration time.Duration
+		if extapp.StopConditions {
+			maxPackets, maxBytes := ctx.Int(MaxPackets.call()), ctx.Int(MaxBytes.call())
+			if maxPackets > 0 || maxBytes > 0 {
+				stages = append(stages, stopStage(maxPackets, maxBytes))
+			}
+			duration = time.Duration(ctx.Int(MaxDuration.call())) * time.Second
+		}
+
+		var buffer bufferConfig
+		if extapp.OutputBuffer {
+			buffer = bufferConfig{size: ctx.Int(BufferSize.call()) * 1024, policy: ctx.String(BufferPolicy.call())}
+		}
+
+		stats := newStreamStats()
+		if len(stages) == 0 && duration == 0 && buffer.size == 0 && !extapp.InterfaceStats {
+			err = extapp.StartCapture(iface, pipe, filter, opts)
+			logger.Debugf("%s", stats.summary(time.Now(), false))
 			return err
 		}
 
+		config := streamConfig{buffer: buffer, stats: stats, isb: extapp.InterfaceStats, filters: filters}
+		stream := newPacketStreamConfig(pipe, stages, config)
+		if duration > 0 {
+			stream.stopAfter(duration)
+		}
+		err = extapp.runCapture(stream, iface, filter, opts)
+		if closeErr := stream.Close(); err == nil {
+			err = closeErr
+		}
+		if ring != nil {
+			if closeErr := ring.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		logger.Debugf("%s", stats.summary(time.Now(), true))
+
+		return err
+	}
+
+	// Validate capture filter for given interface
+	if ctx.IsSet("extcap-capture-filter") {
+		if !ctx.IsSet("extcap-interface") {
+			return ErrNoInterfaceSpecified
+		}
+
+		validateFunc := extapp.ValidateFilter
+		if validateFunc == nil {
+			validateFunc = extapp.validateFilter
+		}
+
+		// Wireshark treats any output as validation error
+		iface := ctx.String("extcap-interface")
+		if err := validateFunc(iface, ctx.String("extcap-capture-filter")); err != nil {
+			fmt.Println(err)
+		}
+
 		return nil
 	}
 
 	return cli.ShowAppHelp(ctx)
 }
 
-func openPipe(name string) (io.WriteCloser, error) {
-	pipe, err := os.OpenFile(name, os.O_WRONLY, os.ModeNamedPipe)
+// reservedFlags returns names which can't be used by config options: extcap flags
+// and options of the library features enabled on the App
+func (extapp *App) reservedFlags() map[string]bool {
+	reserved := make(map[string]bool, len(libraryFlags))
+	for name := range libraryFlags {
+		reserved[name] = true
+	}
+	for _, opt := range extapp.libraryOptions() {
+		reserved[opt.call()] = true
+	}
+	return reserved
+}
+
+// libraryOptions returns options enabled on the App which are handled by the library
+func (extapp *App) libraryOptions() []ConfigOption {
+	var opts []ConfigOption
+	if extapp.StopConditions {
+		opts = append(opts, stopOptions()...)
+	}
+	if extapp.RingBuffer {
+		opts = append(opts, ringOptions()...)
+	}
+	if extapp.OutputBuffer {
+		opts = append(opts, bufferOptions()...)
+	}
+	return append(opts, middlewareOptions(extapp.Middlewares)...)
+}
+
+// runCapture runs StartCapture writing to the stream. When the stream is finished
+// (e.g. stop condition is met) StartCapture is given stopGrace to return.
+func (extapp *App) runCapture(stream *packetStream, iface, filter string, opts map[string]interface{}) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- extapp.StartCapture(iface, stream, filter, opts)
+	}()
+
+	var err error
+	select {
+	case err = <-result:
+	case <-stream.done:
+		select {
+		case err = <-result:
+		case <-time.After(stopGrace):
+			logger.Warnf("Capture did not stop in %s", stopGrace)
+		}
+	}
+
+	// writers used by StartCapture do not always wrap ErrCaptureStopped
+	if stream.isStopped() || errors.Is(err, ErrCaptureStopped) {
+		return nil
+	}
+	return err
+}
+
+// controls returns numbered toolbar controls
+func (extapp *App) controls() []*Control {
+	if extapp.GetControls == nil {
+		return nil
+	}
+
+	controls := extapp.GetControls()
+	for i := range controls {
+		controls[i].number = i
+	}
+	return controls
+}
+
+// validateFilter compiles filter to BPF for DLT of the interface
+func (extapp *App) validateFilter(iface, expr string) error {
+	dlt, err := extapp.GetDLT(iface)
 	if err != nil {
-		return nil, fmt.Errorf("Undable to open pipe: %w", err)
+		return err
 	}
+	return compileFilter(dlt, expr)
+}
 
-	return pipe, nil
+func compileFilter(dlt DLT, expr string) error {
+	_, err := filter.Compile(expr, layers.LinkType(dlt.Number), filter.DefaultSnapLength)
+	return err
 }
 
 const helpTemplate = `NAME:
@@ -281,6 +829,9 @@ AUTHOR{{with $length := len .Authors}}{{if ne 1 $length}}S{{end}}{{end}}:
    {{range $index, $author := .Authors}}{{if $index}}
    {{end}}{{$author}}{{end}}{{end}}{{if .VisibleCommands}}
 
+COMMANDS:{{range .VisibleCommands}}
+   {{.Name}}{{"\t"}}{{.Usage}}{{end}}
+
 OPTIONS:
    {{range $index, $option := .VisibleFlags}}{{if $index}}
    {{end}}{{$option}}{{end}}{{end}}{{if .Copyright}}
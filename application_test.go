@@ -0,0 +1,181 @@
+package extcap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestMain(m *testing.M) {
+	// Wireshark version and cached queries are stored in temporary directory
+	dir, err := os.MkdirTemp("", "extcap-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("XDG_CACHE_HOME", dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestCaptureOptions(t *testing.T) {
+	ifaceOpts := map[string][]ConfigOption{
+		"gen":    {NewConfigIntegerOpt("port", "Port").Default(9999), NewConfigBoolOpt("verbose", "Verbose")},
+		"listen": {NewConfigIntegerOpt("port", "Port").Default(514), NewConfigStringOpt("host", "Host")},
+	}
+	extapp := &App{
+		GetConfigOptions: func(iface string) ([]ConfigOption, error) { return ifaceOpts[iface], nil },
+		StopConditions:   true,
+	}
+
+	// flags are made of the first definition of shared option
+	flags := []cli.Flag{}
+	for _, opt := range append(append(ifaceOpts["gen"], ifaceOpts["listen"][1]), extapp.libraryOptions()...) {
+		flag, _ := optionFlag(opt)
+		flags = append(flags, flag)
+	}
+
+	testCases := []struct {
+		iface    string
+		args     []string
+		expected map[string]interface{}
+	}{
+		{"gen", nil, map[string]interface{}{"port": 9999, "verbose": false}},
+		{"listen", []string{"--host", "10.0.0.1", "--max-packets", "10"}, map[string]interface{}{"port": 514, "host": "10.0.0.1"}},
+		{"listen", []string{"--port", "1514"}, map[string]interface{}{"port": 1514, "host": ""}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.iface, func(t *testing.T) {
+			var opts map[string]interface{}
+			app := &cli.App{
+				Flags: flags,
+				Action: func(ctx *cli.Context) (err error) {
+					opts, err = extapp.captureOptions(ctx, tc.iface)
+					return err
+				},
+			}
+			require.NoError(t, app.Run(append([]string{"test"}, tc.args...)))
+			assert.Equal(t, tc.expected, opts)
+		})
+	}
+}
+
+// runApp runs application with given arguments and returns its standard output
+func runApp(t *testing.T, extapp *App, args ...string) (string, error) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- data
+	}()
+
+	err = extapp.cliApp().Run(append([]string{"test"}, args...))
+	w.Close()
+	return string(<-output), err
+}
+
+func testApp() *App {
+	return &App{
+		GetInterfaces: func() ([]CaptureInterface, error) { return []CaptureInterface{{"eth0", "Ethernet"}}, nil },
+		GetDLT:        func(string) (DLT, error) { return DLT{1, "EN10MB", "Ethernet"}, nil },
+		StartCapture:  func(string, io.WriteCloser, string, map[string]interface{}) error { return nil },
+	}
+}
+
+func TestReloadOption(t *testing.T) {
+	extapp := testApp()
+	extapp.GetConfigOptions = func(iface string) ([]ConfigOption, error) {
+		return []ConfigOption{
+			NewConfigStringOpt("host", "Host"),
+			NewConfigSelectorOpt("remote", "Remote").Values(SelectorValue{Value: "if1", Display: "Remote 1"}).Reload(true),
+		}, nil
+	}
+	extapp.ReloadOption = func(iface, call string) ([]SelectorValue, error) {
+		if iface != "eth0" || call != "remote" {
+			return nil, fmt.Errorf("Unexpected reload of '%s' on '%s'", call, iface)
+		}
+		return []SelectorValue{{Value: "if2", Display: "Remote 2"}, {Value: "if3", Display: "Remote 3", Default: true}}, nil
+	}
+
+	out, err := runApp(t, extapp, "--extcap-interface", "eth0", "--extcap-reload-option", "remote")
+	require.NoError(t, err)
+	assert.Equal(t, "value {arg=1}{value=if2}{display=Remote 2}{default=false}\nvalue {arg=1}{value=if3}{display=Remote 3}{default=true}\n", out)
+
+	_, err = runApp(t, extapp, "--extcap-interface", "eth0", "--extcap-reload-option", "missing")
+	assert.EqualError(t, err, "Unknown option 'missing'")
+
+	_, err = runApp(t, extapp, "--extcap-reload-option", "remote")
+	assert.ErrorIs(t, err, ErrNoInterfaceSpecified)
+}
+
+func TestControlPipes(t *testing.T) {
+	dir := t.TempDir()
+	in, out := filepath.Join(dir, "control-in"), filepath.Join(dir, "control-out")
+
+	// messages of Wireshark: string control is changed, button is pressed
+	buf := new(bytes.Buffer)
+	messages := &controlPipes{out: nopWriteCloser{buf}}
+	require.NoError(t, messages.send(0, ctrlCmdSet, "hello"))
+	require.NoError(t, messages.send(1, ctrlCmdSet, ""))
+	require.NoError(t, os.WriteFile(in, buf.Bytes(), 0600))
+	require.NoError(t, os.WriteFile(out, nil, 0600))
+
+	changes := make(chan string, 2)
+	message := NewControlString("Message").OnChange(func(value string) { changes <- "message " + value })
+	button := NewControlButton("Restart").OnChange(func(string) { changes <- "restart" })
+
+	extapp := testApp()
+	extapp.GetControls = func() []*Control { return []*Control{message, button} }
+	extapp.StartCapture = func(iface string, fifo io.WriteCloser, filter string, opts map[string]interface{}) error {
+		for i := 0; i < 2; i++ {
+			select {
+			case change := <-changes:
+				if err := StatusMessage(change); err != nil {
+					return err
+				}
+			case <-time.After(time.Second):
+				return errors.New("Control message is not received")
+			}
+		}
+		return message.Set("world")
+	}
+
+	output, err := runApp(t, extapp, "--extcap-interfaces", "--extcap-version", "3.6.0")
+	require.NoError(t, err)
+	assert.Contains(t, output, "control {number=0}{type=string}{display=Message}\ncontrol {number=1}{type=button}{display=Restart}\n")
+
+	_, err = runApp(t, extapp, "--capture", "--extcap-interface", "eth0", "--fifo", filepath.Join(dir, "out.pcap"),
+		"--extcap-control-in", in, "--extcap-control-out", out)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	r := bytes.NewReader(data)
+	var received []string
+	for r.Len() > 0 {
+		number, cmd, payload, err := readControlMessage(r)
+		require.NoError(t, err)
+		received = append(received, fmt.Sprintf("%d %d %s", number, cmd, payload))
+	}
+	assert.Equal(t, []string{
+		fmt.Sprintf("0 %d message hello", ctrlCmdStatusbar),
+		fmt.Sprintf("0 %d restart", ctrlCmdStatusbar),
+		fmt.Sprintf("0 %d world", ctrlCmdSet),
+	}, received)
+}
@@ -0,0 +1,196 @@
+package extcap
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+)
+
+// Policies of output buffer when it is full
+const (
+	BufferBlock      = "block"       // StartCapture waits until there is space in the buffer
+	BufferDropNewest = "drop-newest" // new packet is dropped
+	BufferDropOldest = "drop-oldest" // the oldest packets are dropped to make space for new one
+)
+
+// Output buffer options. They are added to config of every interface when App.OutputBuffer is set.
+var (
+	BufferSize = NewConfigIntegerOpt("buffer-size", "Buffer size (kB)").
+			Range(0, math.MaxInt32).Default(4096).Group("Buffer").Tooltip("Memory for packets which are not read by Wireshark yet, 0 disables buffering")
+	BufferPolicy = NewConfigSelectorOpt("buffer-policy", "When buffer is full").Values(
+		SelectorValue{Value: BufferBlock, Display: "Wait"},
+		SelectorValue{Value: BufferDropNewest, Display: "Drop new packets"},
+		SelectorValue{Value: BufferDropOldest, Display: "Drop old packets"},
+	).Default(BufferBlock).Group("Buffer").Tooltip("What to do when Wireshark does not keep up with the capture")
+)
+
+func bufferOptions() []ConfigOption {
+	return []ConfigOption{BufferSize, BufferPolicy}
+}
+
+// dropReportInterval limits how often drops are reported to Wireshark
+const dropReportInterval = time.Second
+
+// bufferConfig is size in bytes and policy of output buffer
+type bufferConfig struct {
+	size   int
+	policy string
+}
+
+type bufferedPacket struct {
+	ci   gopacket.CaptureInfo
+	data []byte
+}
+
+// bufferedWriter queues packets in memory and writes them in separate goroutine,
+// so slow reader of the FIFO does not block the capture
+type bufferedWriter struct {
+	w      packetWriter
+	config bufferConfig
+
+	mu         sync.Mutex
+	cond       *sync.Cond
+	queue      []bufferedPacket
+	size       int
+	closed     bool
+	err        error
+	dropped    uint64
+	droppedLen uint64
+	reported   time.Time
+
+	done chan struct{}
+}
+
+func newBufferedWriter(w packetWriter, config bufferConfig) *bufferedWriter {
+	b := &bufferedWriter{
+		w:      w,
+		config: config,
+		done:   make(chan struct{}),
+	}
+	b.cond = sync.NewCond(&b.mu)
+
+	go b.run()
+	return b
+}
+
+// WritePacket adds packet to the queue. Packet larger than the buffer is accepted when the queue is empty.
+func (b *bufferedWriter) WritePacket(ci gopacket.CaptureInfo, data []byte) error {
+	b.mu.Lock()
+
+	full := func() bool { return b.size > 0 && b.size+len(data) > b.config.size }
+	switch b.config.policy {
+	case BufferDropNewest:
+		if full() {
+			b.drop(len(data))
+		}
+	case BufferDropOldest:
+		for full() {
+			b.drop(len(b.queue[0].data))
+			b.size -= len(b.queue[0].data)
+			b.queue = b.queue[1:]
+		}
+	default:
+		for full() && b.err == nil {
+			b.cond.Wait()
+		}
+	}
+
+	err := b.err
+	if err == nil && !full() {
+		b.queue = append(b.queue, bufferedPacket{ci, data})
+		b.size += len(data)
+		b.cond.Broadcast()
+	}
+	report := b.dropped > 0 && time.Since(b.reported) >= dropReportInterval
+	if report {
+		b.reported = time.Now()
+	}
+	msg := b.dropMessage()
+	b.mu.Unlock()
+
+	if report {
+		logger.Warnf("%s", msg)
+		StatusMessage(msg)
+	}
+	return err
+}
+
+// drop counts dropped packet, mu should be held
+func (b *bufferedWriter) drop(length int) {
+	b.dropped++
+	b.droppedLen += uint64(length)
+}
+
+func (b *bufferedWriter) dropMessage() string {
+	return fmt.Sprintf("Output is too slow, %d packets (%d bytes) are dropped", b.dropped, b.droppedLen)
+}
+
+// droppedPackets returns number of dropped packets
+func (b *bufferedWriter) droppedPackets() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.dropped
+}
+
+// Flush implements packetWriter interface. Packets are flushed by writing goroutine.
+func (b *bufferedWriter) Flush() error {
+	return nil
+}
+
+// Close waits until all queued packets are written
+func (b *bufferedWriter) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.cond.Broadcast()
+	b.mu.Unlock()
+
+	<-b.done
+
+	b.mu.Lock()
+	dropped, msg, err := b.dropped, b.dropMessage(), b.err
+	b.mu.Unlock()
+
+	if dropped > 0 {
+		logger.Infof("%s", msg)
+		StatusMessage(msg)
+	}
+	return err
+}
+
+func (b *bufferedWriter) run() {
+	defer close(b.done)
+
+	for {
+		b.mu.Lock()
+		for len(b.queue) == 0 && !b.closed {
+			b.cond.Wait()
+		}
+		if len(b.queue) == 0 {
+			b.mu.Unlock()
+			return
+		}
+		p := b.queue[0]
+		b.queue = b.queue[1:]
+		b.size -= len(p.data)
+		b.cond.Broadcast()
+		b.mu.Unlock()
+
+		err := b.w.WritePacket(p.ci, p.data)
+		if err == nil {
+			err = b.w.Flush()
+		}
+		if err != nil {
+			b.mu.Lock()
+			b.err = err
+			b.queue = nil
+			b.size = 0
+			b.cond.Broadcast()
+			b.mu.Unlock()
+			return
+		}
+	}
+}
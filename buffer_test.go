@@ -0,0 +1,80 @@
+package extcap
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowWriter waits for release before writing of every packet
+type slowWriter struct {
+	started chan struct{}
+	release chan struct{}
+
+	mu      sync.Mutex
+	written []byte
+}
+
+func newSlowWriter() *slowWriter {
+	return &slowWriter{started: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (w *slowWriter) WritePacket(ci gopacket.CaptureInfo, data []byte) error {
+	w.started <- struct{}{}
+	<-w.release
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.written = append(w.written, data...)
+	return nil
+}
+
+func (w *slowWriter) Flush() error { return nil }
+
+func TestBufferedWriter(t *testing.T) {
+	testCases := []struct {
+		policy   string
+		expected []byte
+		dropped  uint64
+	}{
+		{BufferDropNewest, []byte{0, 1, 2, 3}, 6},
+		{BufferDropOldest, []byte{0, 7, 8, 9}, 6},
+		{BufferBlock, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.policy, func(t *testing.T) {
+			w := newSlowWriter()
+			b := newBufferedWriter(w, bufferConfig{size: 3, policy: tc.policy})
+
+			// the first packet is being written, three fit the buffer
+			require.NoError(t, b.WritePacket(gopacket.CaptureInfo{}, []byte{0}))
+			<-w.started
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 1; i < 10; i++ {
+					assert.NoError(t, b.WritePacket(gopacket.CaptureInfo{}, []byte{byte(i)}))
+				}
+			}()
+
+			select {
+			case <-done:
+				assert.NotEqual(t, BufferBlock, tc.policy, "writing is not blocked")
+			case <-time.After(50 * time.Millisecond):
+				assert.Equal(t, BufferBlock, tc.policy, "writing is blocked")
+			}
+
+			close(w.release)
+			<-done
+			require.NoError(t, b.Close())
+			assert.Equal(t, tc.expected, w.written)
+			assert.Equal(t, tc.dropped, b.droppedPackets())
+		})
+	}
+}
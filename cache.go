@@ -0,0 +1,175 @@
+package extcap
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrQueryTimeout is returned when query hook doesn't finish in time and there is no cached result
+var ErrQueryTimeout = errors.New("Query timed out")
+
+// QueryCache caches output of interfaces, DLT and config queries on disk.
+// Wireshark queries extcap at every startup and interface refresh, so slow hooks
+// (e.g. talking to remote controllers) freeze Wireshark start screen.
+type QueryCache struct {
+	// Dir is directory for cache files. By default it is extcap/<application name>
+	// in user cache directory.
+	Dir string
+
+	// TTL is time during which cached result is used without calling hooks.
+	// If it is 0, hooks are always called and cache is used only when they time out.
+	TTL time.Duration
+
+	// Timeout is hard limit of hook call. When it expires, stale cached result is
+	// returned with a warning. If it is 0, hooks are not limited.
+	Timeout time.Duration
+
+	now func() time.Time // clock of cache entries, time.Now if nil
+}
+
+type cacheEntry struct {
+	Created time.Time
+	Output  string
+}
+
+// buildID identifies build of the application: its version and modification time of
+// the executable, so results cached by other builds are not used
+func buildID(version string) string {
+	exe, err := os.Executable()
+	if err != nil {
+		return version
+	}
+	info, err := os.Stat(exe)
+	if err != nil {
+		return version
+	}
+	return fmt.Sprintf("%s-%d", version, info.ModTime().UnixNano())
+}
+
+func (c *QueryCache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// cacheDir returns dir or default cache directory of the application if dir is empty
+func cacheDir(dir, appName string) (string, error) {
+	if dir != "" {
+		return dir, nil
+	}
+	userDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(userDir, "extcap", appName), nil
+}
+
+func (c *QueryCache) path(appName, key string) (string, error) {
+	dir, err := cacheDir(c.Dir, appName)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json"), nil
+}
+
+func (c *QueryCache) load(path string) (cacheEntry, bool) {
+	var entry cacheEntry
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return entry, false
+	}
+	if err = json.Unmarshal(data, &entry); err != nil {
+		logger.Warnf("Invalid cache file %s: %s", path, err)
+		return entry, false
+	}
+	return entry, true
+}
+
+// store writes entry to temporary file and renames it, so concurrent readers never see partial file
+func (c *QueryCache) store(path string, entry cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// query returns output of fn for given key using cache. Nil cache calls fn directly.
+func (c *QueryCache) query(appName, key string, fn func() (string, error)) (string, error) {
+	if c == nil {
+		return fn()
+	}
+
+	path, err := c.path(appName, key)
+	if err != nil {
+		logger.Warnf("Query cache is disabled: %s", err)
+		return fn()
+	}
+
+	entry, cached := c.load(path)
+	if cached && c.clock().Sub(entry.Created) < c.TTL {
+		logger.Debugf("Cached result of '%s' from %s is used", key, entry.Created.Format(time.RFC3339))
+		return entry.Output, nil
+	}
+
+	type result struct {
+		output string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		output, err := fn()
+		done <- result{output, err}
+	}()
+
+	var timeout <-chan time.Time
+	if c.Timeout > 0 {
+		timer := time.NewTimer(c.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return "", r.err
+		}
+		if err := c.store(path, cacheEntry{Created: c.clock(), Output: r.output}); err != nil {
+			logger.Warnf("Unable to cache result of '%s': %s", key, err)
+		}
+		return r.output, nil
+	case <-timeout:
+		if !cached {
+			return "", fmt.Errorf("%w: '%s' took more than %s", ErrQueryTimeout, key, c.Timeout)
+		}
+		logger.Warnf("'%s' took more than %s, stale result from %s is used", key, c.Timeout, entry.Created.Format(time.RFC3339))
+		return entry.Output, nil
+	}
+}
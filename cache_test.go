@@ -0,0 +1,69 @@
+package extcap
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryCache(t *testing.T) {
+	calls := 0
+	fast := func() (string, error) {
+		calls++
+		return "fresh", nil
+	}
+	// slow hook is finished only at the end of the test
+	release := make(chan struct{})
+	defer close(release)
+	slow := func() (string, error) {
+		<-release
+		return "slow", nil
+	}
+	failed := func() (string, error) {
+		return "", errors.New("failed")
+	}
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := &QueryCache{Dir: t.TempDir(), TTL: time.Hour, Timeout: 10 * time.Millisecond}
+	c.now = func() time.Time { return now }
+
+	// no cache and timeout
+	_, err := c.query("app", "interfaces", slow)
+	assert.ErrorIs(t, err, ErrQueryTimeout)
+
+	out, err := c.query("app", "interfaces", fast)
+	require.NoError(t, err)
+	assert.Equal(t, "fresh", out)
+
+	// result is cached within TTL
+	now = now.Add(59 * time.Minute)
+	out, err = c.query("app", "interfaces", fast)
+	require.NoError(t, err)
+	assert.Equal(t, "fresh", out)
+	assert.Equal(t, 1, calls)
+
+	// expired result is used only on timeout
+	now = now.Add(time.Minute)
+	out, err = c.query("app", "interfaces", slow)
+	require.NoError(t, err)
+	assert.Equal(t, "fresh", out)
+
+	_, err = c.query("app", "interfaces", failed)
+	assert.Error(t, err)
+
+	out, err = c.query("app", "interfaces", fast)
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	// other keys are cached separately
+	_, err = c.query("app", "dlts/eth0", slow)
+	assert.ErrorIs(t, err, ErrQueryTimeout)
+}
+
+func TestBuildID(t *testing.T) {
+	assert.Equal(t, buildID("1.0"), buildID("1.0"))
+	assert.NotEqual(t, buildID("1.0"), buildID("1.1"))
+}
@@ -0,0 +1,42 @@
+package extcap
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"github.com/kor44/extcap/filter"
+)
+
+// filterStage drops packets which don't match capture filter expression. Filter is
+// compiled for link type of the interface of the packet, so pcapng stream may have
+// interfaces with different link types.
+func filterStage(expr string) stageFunc {
+	return func(info streamInfo) (PacketFunc, error) {
+		first, err := filter.New(expr, info.linkType)
+		if err != nil {
+			return nil, err
+		}
+		filters := map[layers.LinkType]*filter.Filter{info.linkType: first}
+
+		return func(ci *gopacket.CaptureInfo, data []byte) ([]byte, error) {
+			f := first
+			if ci.InterfaceIndex != 0 {
+				intf, err := info.iface(ci.InterfaceIndex)
+				if err != nil {
+					return nil, err
+				}
+				var ok bool
+				if f, ok = filters[intf.LinkType]; !ok {
+					if f, err = filter.New(expr, intf.LinkType); err != nil {
+						return nil, err
+					}
+					filters[intf.LinkType] = f
+				}
+			}
+			if !f.Match(data) {
+				return nil, nil
+			}
+			return data, nil
+		}, nil
+	}
+}
@@ -0,0 +1,278 @@
+/*
+Package command implements capture source which runs a command (e.g. "tcpdump -w -"
+or vendor CLI, locally or through ssh) and streams its pcap or pcapng stdout to the FIFO.
+
+Arguments of the command may contain placeholders which are replaced before start:
+
+	{interface}  name of capture interface
+	{filter}     capture filter
+	{<call>}     value of config option with given call name
+
+Argument which consists of single placeholder with empty value is omitted.
+Stderr of the command goes to the debug log and status bar of the toolbar.
+When capture stops, the whole process group of the command is killed. It is done also
+when the extcap receives SIGTERM or SIGINT, e.g. when Wireshark stops the capture.
+
+Usage:
+
+	app := extcap.App{Usage: "remote tcpdump"}
+	app.Register(command.New("remote-eth0", layers.LinkTypeEthernet,
+		"ssh", "{host}", "tcpdump", "-i", "eth0", "-U", "-w", "-", "{filter}").
+		Options(extcap.NewConfigStringOpt("host", "Host").Required(true)))
+	app.Run(os.Args)
+*/
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"syscall"
+	"time"
+
+	"github.com/google/gopacket/layers"
+
+	"github.com/kor44/extcap"
+)
+
+// ErrInvalidHeader is returned when command output is neither pcap nor pcapng
+var ErrInvalidHeader = errors.New("Command output is not pcap or pcapng")
+
+// Magic numbers of capture files
+var magics = [][]byte{
+	{0xa1, 0xb2, 0xc3, 0xd4}, // pcap
+	{0xd4, 0xc3, 0xb2, 0xa1},
+	{0xa1, 0xb2, 0x3c, 0x4d}, // pcap with nanoseconds
+	{0x4d, 0x3c, 0xb2, 0xa1},
+	{0x0a, 0x0d, 0x0d, 0x0a}, // pcapng
+}
+
+// killTimeout is time between SIGTERM and SIGKILL sent to the process group
+const killTimeout = 2 * time.Second
+
+var placeholder = regexp.MustCompile(`\{([a-zA-Z0-9_-]+)\}`)
+
+// Source runs command for capture on the interface
+type Source struct {
+	iface    string
+	display  string
+	linkType layers.LinkType
+	args     []string
+	options  []extcap.ConfigOption
+}
+
+// New creates source for interface with given name. The command writes packets of given link type.
+func New(iface string, linkType layers.LinkType, name string, args ...string) *Source {
+	return &Source{
+		iface:    iface,
+		display:  iface,
+		linkType: linkType,
+		args:     append([]string{name}, args...),
+	}
+}
+
+// Display sets description of the interface
+func (s *Source) Display(display string) *Source {
+	s.display = display
+	return s
+}
+
+// Options sets config options, their values can be used in command arguments
+func (s *Source) Options(opts ...extcap.ConfigOption) *Source {
+	s.options = append(s.options, opts...)
+	return s
+}
+
+// Interfaces implements extcap.Source interface
+func (s *Source) Interfaces() ([]extcap.CaptureInterface, error) {
+	return []extcap.CaptureInterface{{Value: s.iface, Display: s.display}}, nil
+}
+
+// DLT implements extcap.Source interface
+func (s *Source) DLT(iface string) (extcap.DLT, error) {
+	if iface != s.iface {
+		return extcap.DLT{}, fmt.Errorf("%w '%s'", extcap.ErrUnknownInterface, iface)
+	}
+	return extcap.DLTFromLinkType(s.linkType), nil
+}
+
+// ConfigOptions implements extcap.ConfigSource interface
+func (s *Source) ConfigOptions(iface string) ([]extcap.ConfigOption, error) {
+	return s.options, nil
+}
+
+// AllConfigOptions implements extcap.ConfigSource interface
+func (s *Source) AllConfigOptions() []extcap.ConfigOption {
+	return s.options
+}
+
+// StartCapture implements extcap.Source interface
+func (s *Source) StartCapture(iface string, fifo io.WriteCloser, filter string, opts map[string]interface{}) error {
+	defer fifo.Close()
+
+	if iface != s.iface {
+		return fmt.Errorf("%w '%s'", extcap.ErrUnknownInterface, iface)
+	}
+
+	ctx, stop := stopContext(fifo)
+	defer stop()
+
+	args := expandArgs(s.args, iface, filter, opts)
+	extcap.Log().Infof("Run command: %q", args)
+	return run(ctx, exec.Command(args[0], args[1:]...), fifo)
+}
+
+// stopContext returns context which is canceled when the extcap receives SIGTERM or SIGINT
+// or when the FIFO writer given to StartCapture is finished by stop condition
+func stopContext(fifo io.Writer) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if d, ok := fifo.(interface{ Done() <-chan struct{} }); ok {
+		go func() {
+			select {
+			case <-d.Done():
+				stop()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	return ctx, stop
+}
+
+// expandArgs replaces placeholders in arguments
+func expandArgs(args []string, iface, filter string, opts map[string]interface{}) []string {
+	values := map[string]string{
+		"interface": iface,
+		"filter":    filter,
+	}
+	for name, v := range opts {
+		if v != nil {
+			values[name] = fmt.Sprint(v)
+		}
+	}
+
+	result := make([]string, 0, len(args))
+	for i, arg := range args {
+		expanded := placeholder.ReplaceAllStringFunc(arg, func(m string) string {
+			if v, ok := values[m[1:len(m)-1]]; ok {
+				return v
+			}
+			return m
+		})
+
+		if i > 0 && expanded == "" && placeholder.FindString(arg) == arg {
+			continue
+		}
+		result = append(result, expanded)
+	}
+	return result
+}
+
+// run starts command and copies its stdout to w until the command exits, writing fails
+// or ctx is canceled. Process group of the command is killed in the last two cases.
+func run(ctx context.Context, cmd *exec.Cmd, w io.Writer) error {
+	setProcessGroup(cmd)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	if err = cmd.Start(); err != nil {
+		return fmt.Errorf("Unable to start command: %w", err)
+	}
+
+	stderrDone := make(chan string)
+	go func() {
+		stderrDone <- ForwardStderr(stderr)
+	}()
+
+	// process group is killed when ctx is canceled, process is not waited until then
+	copied, watched := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(watched)
+		select {
+		case <-ctx.Done():
+			extcap.Log().Infof("Capture is stopped, command is terminated")
+			killProcessGroup(cmd, killTimeout)
+		case <-copied:
+		}
+	}()
+
+	err = CopyCapture(w, stdout)
+	close(copied)
+	<-watched
+	if err != nil {
+		killProcessGroup(cmd, killTimeout)
+	}
+
+	lastLine := <-stderrDone
+	waitErr := cmd.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err != nil {
+		if errors.Is(err, ErrInvalidHeader) && lastLine != "" {
+			err = fmt.Errorf("%w: %s", err, lastLine)
+		}
+		return err
+	}
+	if waitErr != nil {
+		if lastLine != "" {
+			return fmt.Errorf("Command failed: %w: %s", waitErr, lastLine)
+		}
+		return fmt.Errorf("Command failed: %w", waitErr)
+	}
+	return nil
+}
+
+// CopyCapture checks that r starts with pcap or pcapng header and copies it to w.
+// Other sources running capture tools (e.g. remotely) use it too.
+func CopyCapture(w io.Writer, r io.Reader) error {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err == io.EOF && len(magic) == 0 {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidHeader, err)
+	}
+
+	valid := false
+	for _, m := range magics {
+		valid = valid || bytes.Equal(magic, m)
+	}
+	if !valid {
+		return fmt.Errorf("%w: unknown magic %x", ErrInvalidHeader, magic)
+	}
+
+	_, err = br.WriteTo(w)
+	return err
+}
+
+// ForwardStderr writes stderr lines of capture tool to the log and the status bar.
+// It returns the last line, which usually explains failure.
+func ForwardStderr(r io.Reader) string {
+	var last string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		last = line
+		extcap.Log().Infof("stderr: %s", line)
+		extcap.StatusMessage(line)
+	}
+	return last
+}
@@ -0,0 +1,66 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandArgs(t *testing.T) {
+	args := []string{"ssh", "{host}", "tcpdump", "-i", "{interface}", "-s", "{snaplen}", "-w", "-", "{filter}", "{unknown}"}
+
+	tests := []struct {
+		name     string
+		filter   string
+		opts     map[string]interface{}
+		expected []string
+	}{
+		{"All values", "port 80", map[string]interface{}{"host": "router", "snaplen": 96},
+			[]string{"ssh", "router", "tcpdump", "-i", "eth0", "-s", "96", "-w", "-", "port 80", "{unknown}"}},
+		{"Empty values are omitted", "", map[string]interface{}{"host": "", "snaplen": 0},
+			[]string{"ssh", "tcpdump", "-i", "eth0", "-s", "0", "-w", "-", "{unknown}"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, expandArgs(args, "eth0", tt.filter, tt.opts))
+		})
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell is required")
+	}
+
+	out := new(bytes.Buffer)
+	err := run(context.Background(), exec.Command("sh", "-c", `printf '\241\262\303\324data'; echo progress >&2`), out)
+	require.NoError(t, err)
+	assert.Equal(t, "\xa1\xb2\xc3\xd4data", out.String())
+
+	err = run(context.Background(), exec.Command("sh", "-c", `echo 'tcpdump: eth0: No such device' >&2; echo usage`), new(bytes.Buffer))
+	assert.ErrorIs(t, err, ErrInvalidHeader)
+	assert.ErrorContains(t, err, "No such device")
+
+	err = run(context.Background(), exec.Command("sh", "-c", `echo 'permission denied' >&2; exit 1`), new(bytes.Buffer))
+	assert.ErrorContains(t, err, "permission denied")
+
+	// child process is killed when writing fails
+	start := time.Now()
+	err = run(context.Background(), exec.Command("sh", "-c", `printf '\012\015\015\012'; sleep 30`), failingWriter{})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
@@ -0,0 +1,29 @@
+//go:build !windows
+// +build !windows
+
+package command
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// setProcessGroup starts command in its own process group, so children of the command
+// (e.g. ssh started by a script) are killed together with it
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup sends SIGTERM to the process group and SIGKILL if it is still alive after timeout
+func killProcessGroup(cmd *exec.Cmd, timeout time.Duration) {
+	pgid := -cmd.Process.Pid
+	if err := syscall.Kill(pgid, syscall.SIGTERM); err != nil {
+		return
+	}
+
+	go func() {
+		time.Sleep(timeout)
+		syscall.Kill(pgid, syscall.SIGKILL)
+	}()
+}
@@ -0,0 +1,80 @@
+//go:build !windows
+// +build !windows
+
+package command
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nopWriteCloser struct {
+	*bytes.Buffer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// doneWriter is FIFO writer finished by stop condition
+type doneWriter struct {
+	nopWriteCloser
+	done chan struct{}
+}
+
+func (w doneWriter) Done() <-chan struct{} { return w.done }
+
+// startIdle starts capture with idle command and returns pid of the command
+func startIdle(t *testing.T, fifo io.WriteCloser) (int, chan error) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	src := New("idle", layers.LinkTypeEthernet, "sh", "-c", "echo $$ > {pidfile}; printf '\\012\\015\\015\\012'; exec sleep 30")
+
+	result := make(chan error, 1)
+	go func() {
+		result <- src.StartCapture("idle", fifo, "", map[string]interface{}{"pidfile": pidFile})
+	}()
+
+	var pid int
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(pidFile)
+		if err != nil || !strings.HasSuffix(string(data), "\n") {
+			return false
+		}
+		pid, err = strconv.Atoi(strings.TrimSpace(string(data)))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	return pid, result
+}
+
+// waitStopped checks that capture is finished and the command is killed
+func waitStopped(t *testing.T, pid int, result chan error) {
+	select {
+	case err := <-result:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("capture doesn't stop")
+	}
+	assert.Equal(t, syscall.ESRCH, syscall.Kill(pid, 0), "command is killed")
+}
+
+func TestStopOnSignal(t *testing.T) {
+	pid, result := startIdle(t, nopWriteCloser{new(bytes.Buffer)})
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+	waitStopped(t, pid, result)
+}
+
+func TestStopOnDone(t *testing.T) {
+	fifo := doneWriter{nopWriteCloser{new(bytes.Buffer)}, make(chan struct{})}
+	pid, result := startIdle(t, fifo)
+	close(fifo.done)
+	waitStopped(t, pid, result)
+}
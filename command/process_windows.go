@@ -0,0 +1,15 @@
+//go:build windows
+// +build windows
+
+package command
+
+import (
+	"os/exec"
+	"time"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd, timeout time.Duration) {
+	cmd.Process.Kill()
+}
@@ -22,6 +22,8 @@ type ConfigOption interface {
 	display() string
 	tooltip() string
 	setNumber(int)
+	validate() []error
+	isRequired() bool
 }
 
 // common for all options
@@ -37,12 +39,21 @@ type cfg struct {
 func (c *cfg) call() string {
 	return c.callValue
 }
+
+// Call returns name of the option in command line (without leading dashes).
+// It is key of the option value passed to StartCapture.
+func (c *cfg) Call() string {
+	return c.callValue
+}
 func (c *cfg) display() string {
 	return c.displayVal
 }
 func (c *cfg) tooltip() string {
 	return c.tooltipVal
 }
+func (c *cfg) isRequired() bool {
+	return c.required
+}
 
 func (c *cfg) string(optType string, params [][2]string) string {
 	w := new(strings.Builder)
@@ -56,8 +67,8 @@ func (c *cfg) string(optType string, params [][2]string) string {
 		fmt.Fprintf(w, "{required=true}")
 	}
 
-	if c.group != "" {
-		fmt.Fprintf(w, "{group=%s", c.group)
+	if c.group != "" && Supports(FeatureOptionGroups) {
+		fmt.Fprintf(w, "{group=%s}", c.group)
 	}
 
 	for i := range params {
@@ -71,6 +82,17 @@ func (c *cfg) setNumber(i int) {
 	c.number = i
 }
 
+// validate checks definition common for all options
+func (c *cfg) validate() []error {
+	var errs []error
+	if c.callValue == "" {
+		errs = append(errs, fmt.Errorf("option '%s' has empty call name", c.displayVal))
+	} else if strings.HasPrefix(c.callValue, "-") || strings.ContainsAny(c.callValue, " =\t") {
+		errs = append(errs, fmt.Errorf("option '%s' has invalid call name", c.callValue))
+	}
+	return errs
+}
+
 // Integer option
 type ConfigIntegerOpt struct {
 	cfg
@@ -91,12 +113,8 @@ func NewConfigIntegerOpt(call, display string) *ConfigIntegerOpt {
 	return opt
 }
 
-// WithRange sets min and max value for option
+// WithRange sets min and max value for option. Max value should be greater min value
 func (c *ConfigIntegerOpt) Range(min, max int) *ConfigIntegerOpt {
-	if min >= max {
-		panic("in range max value should be greater min value")
-	}
-
 	c.min = min
 	c.max = max
 
@@ -130,6 +148,16 @@ func (c *ConfigIntegerOpt) Tooltip(tooltip string) *ConfigIntegerOpt {
 	return c
 }
 
+func (c *ConfigIntegerOpt) validate() []error {
+	errs := c.cfg.validate()
+	if c.rangeSet && c.min >= c.max {
+		errs = append(errs, fmt.Errorf("option '%s': in range max value %d should be greater min value %d", c.callValue, c.max, c.min))
+	} else if c.rangeSet && c.defaultSet && (c.defaultValue < c.min || c.defaultValue > c.max) {
+		errs = append(errs, fmt.Errorf("option '%s': default value %d is out of range %d-%d", c.callValue, c.defaultValue, c.min, c.max))
+	}
+	return errs
+}
+
 // String implement stringer interface
 // Example output
 //    arg {number=0}{call=--delay}{display=Time delay}{tooltip=Time delay between packages}{type=integer}{range=1,15}{required=true}
@@ -139,6 +167,10 @@ func (c *ConfigIntegerOpt) String() string {
 		params = append(params, [2]string{"range", fmt.Sprintf("%d,%d", c.min, c.max)})
 	}
 
+	if c.defaultSet {
+		params = append(params, [2]string{"default", fmt.Sprintf("%d", c.defaultValue)})
+	}
+
 	return c.string("integer", params)
 }
 
@@ -147,9 +179,10 @@ type ConfigStringOpt struct {
 	cfg
 	placeholder  string
 	validation   *regexp.Regexp
-	required     bool
 	defaultValue string
 	defaultSet   bool
+
+	validationErr error
 }
 
 // Create new STRING option
@@ -180,12 +213,28 @@ func (c *ConfigStringOpt) Required(val bool) *ConfigStringOpt {
 	return c
 }
 
+// Group sets option's group
+func (c *ConfigStringOpt) Group(group string) *ConfigStringOpt {
+	c.group = group
+	return c
+}
+
 // Validation sets option validation
 func (c *ConfigStringOpt) Validation(str string) *ConfigStringOpt {
-	c.validation = regexp.MustCompile(str)
+	c.validation, c.validationErr = regexp.Compile(str)
 	return c
 }
 
+func (c *ConfigStringOpt) validate() []error {
+	errs := c.cfg.validate()
+	if c.validationErr != nil {
+		errs = append(errs, fmt.Errorf("option '%s': invalid validation: %w", c.callValue, c.validationErr))
+	} else if c.validation != nil && c.defaultSet && !c.validation.MatchString(c.defaultValue) {
+		errs = append(errs, fmt.Errorf("option '%s': default value '%s' doesn't match validation", c.callValue, c.defaultValue))
+	}
+	return errs
+}
+
 // SetTooltip sets option tooltip
 func (c *ConfigStringOpt) Tooltip(tooltip string) *ConfigStringOpt {
 	c.tooltipVal = tooltip
@@ -205,14 +254,85 @@ func (c *ConfigStringOpt) String() string {
 		params = append(params, [2]string{"validation", c.validation.String()})
 	}
 
+	if c.defaultSet && c.defaultValue != "" {
+		params = append(params, [2]string{"default", c.defaultValue})
+	}
+
 	return c.string("string", params)
 }
 
+// ConfigPasswordOpt impplement ConfigOption interface. Wireshark hides entered value
+type ConfigPasswordOpt struct {
+	cfg
+	placeholder string
+	sources     []secretSource
+}
+
+// Create new PASSWORD option
+func NewConfigPasswordOpt(call, display string) *ConfigPasswordOpt {
+	opt := &ConfigPasswordOpt{}
+	opt.callValue = call
+	opt.displayVal = display
+
+	return opt
+}
+
+// Placeholder sets text shown in empty field
+func (c *ConfigPasswordOpt) Placeholder(str string) *ConfigPasswordOpt {
+	c.placeholder = str
+	return c
+}
+
+// FromEnv takes value from environment variable when it is not given by user
+func (c *ConfigPasswordOpt) FromEnv(name string) *ConfigPasswordOpt {
+	c.sources = append(c.sources, envSecret(name))
+	return c
+}
+
+// FromFile takes value from file when it is not given by user. File should be accessible only by owner.
+func (c *ConfigPasswordOpt) FromFile(path string) *ConfigPasswordOpt {
+	c.sources = append(c.sources, fileSecret(path))
+	return c
+}
+
+// FromProvider takes value from secret provider when it is not given by user
+func (c *ConfigPasswordOpt) FromProvider(p SecretProvider, key string) *ConfigPasswordOpt {
+	c.sources = append(c.sources, providerSecret(p, key))
+	return c
+}
+
+// Required sets option required
+func (c *ConfigPasswordOpt) Required(val bool) *ConfigPasswordOpt {
+	c.required = val
+	return c
+}
+
+// Group sets option's group
+func (c *ConfigPasswordOpt) Group(group string) *ConfigPasswordOpt {
+	c.group = group
+	return c
+}
+
+// SetTooltip sets option tooltip
+func (c *ConfigPasswordOpt) Tooltip(tooltip string) *ConfigPasswordOpt {
+	c.tooltipVal = tooltip
+	return c
+}
+
+// String implements string interface
+// arg {number=0}{call=--password}{display=Password}{type=password}
+func (c *ConfigPasswordOpt) String() string {
+	params := [][2]string{}
+	if c.placeholder != "" {
+		params = append(params, [2]string{"placeholder", c.placeholder})
+	}
+
+	return c.string("password", params)
+}
+
 // ConfigBoolOpt impplement ConfigOption interface
 type ConfigBoolOpt struct {
 	cfg
-	validation   *regexp.Regexp
-	required     bool
 	defaultValue bool
 	defaultSet   bool
 }
@@ -245,6 +365,12 @@ func (c *ConfigBoolOpt) Required(val bool) *ConfigBoolOpt {
 	return c
 }
 
+// Group sets option's group
+func (c *ConfigBoolOpt) Group(group string) *ConfigBoolOpt {
+	c.group = group
+	return c
+}
+
 // String implements string interface
 // arg {number=2}{call=--verify}{display=Verify}{tooltip=Verify package content}{type=boolflag}
 func (c *ConfigBoolOpt) String() string {
@@ -257,8 +383,327 @@ func (c *ConfigBoolOpt) String() string {
 	return c.string("boolflag", params)
 }
 
-// Need implement
-// fileselect
-// selector
-// radio
-// multicheck
+// ConfigDoubleOpt impplement ConfigOption interface for floating point option
+type ConfigDoubleOpt struct {
+	cfg
+	min          float64
+	max          float64
+	defaultValue float64
+
+	rangeSet   bool
+	defaultSet bool
+}
+
+// Create new DOUBLE option
+func NewConfigDoubleOpt(call, display string) *ConfigDoubleOpt {
+	opt := &ConfigDoubleOpt{}
+	opt.callValue = call
+	opt.displayVal = display
+
+	return opt
+}
+
+// Range sets min and max value for option. Max value should be greater min value
+func (c *ConfigDoubleOpt) Range(min, max float64) *ConfigDoubleOpt {
+	c.min = min
+	c.max = max
+
+	c.rangeSet = true
+
+	return c
+}
+
+// Default sets default value for DOUBLE option
+func (c *ConfigDoubleOpt) Default(val float64) *ConfigDoubleOpt {
+	c.defaultValue = val
+	c.defaultSet = true
+	return c
+}
+
+// Required sets option required
+func (c *ConfigDoubleOpt) Required(val bool) *ConfigDoubleOpt {
+	c.required = val
+	return c
+}
+
+// Group sets option's group
+func (c *ConfigDoubleOpt) Group(group string) *ConfigDoubleOpt {
+	c.group = group
+	return c
+}
+
+// SetTooltip sets option tooltip
+func (c *ConfigDoubleOpt) Tooltip(tooltip string) *ConfigDoubleOpt {
+	c.tooltipVal = tooltip
+	return c
+}
+
+func (c *ConfigDoubleOpt) validate() []error {
+	errs := c.cfg.validate()
+	if c.rangeSet && c.min >= c.max {
+		errs = append(errs, fmt.Errorf("option '%s': in range max value %g should be greater min value %g", c.callValue, c.max, c.min))
+	} else if c.rangeSet && c.defaultSet && (c.defaultValue < c.min || c.defaultValue > c.max) {
+		errs = append(errs, fmt.Errorf("option '%s': default value %g is out of range %g-%g", c.callValue, c.defaultValue, c.min, c.max))
+	}
+	return errs
+}
+
+// String implement stringer interface
+// Example output
+//    arg {number=0}{call=--speed}{display=Speed}{type=double}{range=0.1,10}{default=1}
+func (c *ConfigDoubleOpt) String() string {
+	params := [][2]string{}
+	if c.rangeSet {
+		params = append(params, [2]string{"range", fmt.Sprintf("%g,%g", c.min, c.max)})
+	}
+
+	if c.defaultSet {
+		params = append(params, [2]string{"default", fmt.Sprintf("%g", c.defaultValue)})
+	}
+
+	return c.string("double", params)
+}
+
+// ConfigFileSelectOpt impplement ConfigOption interface for file selection dialog
+type ConfigFileSelectOpt struct {
+	cfg
+	mustExist    bool
+	fileExt      string
+	defaultValue string
+	defaultSet   bool
+}
+
+// Create new FILESELECT option
+func NewConfigFileSelectOpt(call, display string) *ConfigFileSelectOpt {
+	opt := &ConfigFileSelectOpt{}
+	opt.callValue = call
+	opt.displayVal = display
+
+	return opt
+}
+
+// MustExist allows to select only existing files
+func (c *ConfigFileSelectOpt) MustExist(val bool) *ConfigFileSelectOpt {
+	c.mustExist = val
+	return c
+}
+
+// FileExt sets filter of file dialog, e.g. "Capture files (*.pcap *.pcapng)"
+func (c *ConfigFileSelectOpt) FileExt(ext string) *ConfigFileSelectOpt {
+	c.fileExt = ext
+	return c
+}
+
+// Default sets default file
+func (c *ConfigFileSelectOpt) Default(val string) *ConfigFileSelectOpt {
+	c.defaultValue = val
+	c.defaultSet = true
+	return c
+}
+
+// Required sets option required
+func (c *ConfigFileSelectOpt) Required(val bool) *ConfigFileSelectOpt {
+	c.required = val
+	return c
+}
+
+// Group sets option's group
+func (c *ConfigFileSelectOpt) Group(group string) *ConfigFileSelectOpt {
+	c.group = group
+	return c
+}
+
+// SetTooltip sets option tooltip
+func (c *ConfigFileSelectOpt) Tooltip(tooltip string) *ConfigFileSelectOpt {
+	c.tooltipVal = tooltip
+	return c
+}
+
+// String implements string interface
+// arg {number=0}{call=--file}{display=Capture file}{type=fileselect}{mustexist=true}{fileext=Capture files (*.pcap *.pcapng)}
+func (c *ConfigFileSelectOpt) String() string {
+	params := [][2]string{}
+	if c.mustExist {
+		params = append(params, [2]string{"mustexist", "true"})
+	}
+
+	if c.fileExt != "" {
+		params = append(params, [2]string{"fileext", c.fileExt})
+	}
+
+	if c.defaultSet && c.defaultValue != "" {
+		params = append(params, [2]string{"default", c.defaultValue})
+	}
+
+	return c.string("fileselect", params)
+}
+
+// SelectorValue is single value of selector, radio or multicheck option
+type SelectorValue struct {
+	Value   string
+	Display string
+	Default bool
+}
+
+// string formats value for option with given number
+// value {arg=3}{value=if1}{display=Remote1}{default=true}
+func (v SelectorValue) string(arg int) string {
+	return fmt.Sprintf("value {arg=%d}{value=%s}{display=%s}{default=%t}", arg, v.Value, v.Display, v.Default)
+}
+
+// ConfigSelectorOpt impplement ConfigOption interface for selector, radio and multicheck options
+type ConfigSelectorOpt struct {
+	cfg
+	optType      string
+	values       []SelectorValue
+	reload       bool
+	defaultValue string
+	defaultSet   bool
+}
+
+// Create new SELECTOR option (drop-down list)
+func NewConfigSelectorOpt(call, display string) *ConfigSelectorOpt {
+	return newConfigSelectorOpt("selector", call, display)
+}
+
+// Create new RADIO option
+func NewConfigRadioOpt(call, display string) *ConfigSelectorOpt {
+	return newConfigSelectorOpt("radio", call, display)
+}
+
+// Create new MULTICHECK option. Selected values are passed comma separated
+func NewConfigMultiCheckOpt(call, display string) *ConfigSelectorOpt {
+	return newConfigSelectorOpt("multicheck", call, display)
+}
+
+func newConfigSelectorOpt(optType, call, display string) *ConfigSelectorOpt {
+	opt := &ConfigSelectorOpt{optType: optType}
+	opt.callValue = call
+	opt.displayVal = display
+
+	return opt
+}
+
+// Values adds values to option
+func (c *ConfigSelectorOpt) Values(values ...SelectorValue) *ConfigSelectorOpt {
+	c.values = append(c.values, values...)
+	return c
+}
+
+// Default sets default value. It should be among option values
+func (c *ConfigSelectorOpt) Default(val string) *ConfigSelectorOpt {
+	c.defaultValue = val
+	c.defaultSet = true
+	return c
+}
+
+// Reload allows user to reload values of the option from Wireshark dialog
+func (c *ConfigSelectorOpt) Reload(val bool) *ConfigSelectorOpt {
+	c.reload = val
+	return c
+}
+
+// Required sets option required
+func (c *ConfigSelectorOpt) Required(val bool) *ConfigSelectorOpt {
+	c.required = val
+	return c
+}
+
+// Group sets option's group
+func (c *ConfigSelectorOpt) Group(group string) *ConfigSelectorOpt {
+	c.group = group
+	return c
+}
+
+// SetTooltip sets option tooltip
+func (c *ConfigSelectorOpt) Tooltip(tooltip string) *ConfigSelectorOpt {
+	c.tooltipVal = tooltip
+	return c
+}
+
+// String implements string interface. Values are printed on separate lines after the option
+// arg {number=3}{call=--remote}{display=Remote Channel}{type=selector}{tooltip=Remote Channel Selector}
+// value {arg=3}{value=if1}{display=Remote1}{default=true}
+// value {arg=3}{value=if2}{display=Remote2}{default=false}
+func (c *ConfigSelectorOpt) String() string {
+	params := [][2]string{}
+	if c.reload {
+		params = append(params, [2]string{"reload", "true"})
+	}
+
+	values := c.values
+	if c.defaultSet {
+		values = make([]SelectorValue, len(c.values))
+		for i, v := range c.values {
+			v.Default = v.Value == c.defaultValue
+			values[i] = v
+		}
+	}
+
+	lines := []string{c.string(c.optType, params)}
+	lines = append(lines, formatValues(c.number, values)...)
+
+	return strings.Join(lines, "\n")
+}
+
+func (c *ConfigSelectorOpt) validate() []error {
+	errs := c.cfg.validate()
+	if len(c.values) == 0 && !c.reload {
+		errs = append(errs, fmt.Errorf("option '%s' has no values", c.callValue))
+	}
+
+	found, defaults := false, 0
+	seen := make(map[string]bool)
+	for _, v := range c.values {
+		if seen[v.Value] {
+			errs = append(errs, fmt.Errorf("option '%s': duplicate value '%s'", c.callValue, v.Value))
+		}
+		seen[v.Value] = true
+		found = found || v.Value == c.defaultValue
+		if v.Default {
+			defaults++
+		}
+	}
+
+	if c.defaultSet && !found {
+		errs = append(errs, fmt.Errorf("option '%s': default value '%s' is not among values", c.callValue, c.defaultValue))
+	}
+	if c.optType != "multicheck" && (defaults > 1 || (c.defaultSet && defaults > 0 && !c.isDefault(c.defaultValue))) {
+		errs = append(errs, fmt.Errorf("option '%s' has several default values", c.callValue))
+	}
+	return errs
+}
+
+// defaultString returns default values, several defaults of multicheck are comma separated
+func (c *ConfigSelectorOpt) defaultString() string {
+	if c.defaultSet {
+		return c.defaultValue
+	}
+
+	var defaults []string
+	for _, v := range c.values {
+		if v.Default {
+			defaults = append(defaults, v.Value)
+		}
+	}
+	return strings.Join(defaults, ",")
+}
+
+// isDefault reports if value is marked as default in values
+func (c *ConfigSelectorOpt) isDefault(val string) bool {
+	for _, v := range c.values {
+		if v.Value == val {
+			return v.Default
+		}
+	}
+	return false
+}
+
+// formatValues returns value sentences of option with given number
+func formatValues(arg int, values []SelectorValue) []string {
+	lines := make([]string, len(values))
+	for i := range values {
+		lines[i] = values[i].string(arg)
+	}
+	return lines
+}
@@ -0,0 +1,336 @@
+package extcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Control represents interface toolbar control which will be shown in Wireshark GUI
+// Output examples
+// control {number=0}{type=string}{display=Message}{tooltip=Package message content}{placeholder=Enter package message content here ...}
+// control {number=1}{type=selector}{display=Time delay}{tooltip=Time delay between packages}
+// control {number=2}{type=boolean}{display=Verify}{default=true}{tooltip=Verify package content}
+// control {number=3}{type=button}{display=Turn on}{tooltip=Turn on or off}
+// control {number=4}{type=button}{role=logger}{display=Log}{tooltip=Show capture log}
+// value {control=1}{value=1}{display=1 sec}
+// value {control=1}{value=2}{display=2 sec}{default=true}
+type Control struct {
+	number       int
+	ctrlType     string
+	role         string
+	displayVal   string
+	tooltipVal   string
+	placeholder  string
+	validation   string
+	defaultValue string
+	values       []SelectorValue
+	onChange     func(value string)
+}
+
+// Create new BOOLEAN control (checkbox)
+func NewControlBoolean(display string) *Control {
+	return &Control{ctrlType: "boolean", displayVal: display}
+}
+
+// Create new BUTTON control. onChange handler is called when button is pressed
+func NewControlButton(display string) *Control {
+	return &Control{ctrlType: "button", displayVal: display}
+}
+
+// Create new LOGGER button. It opens window with log messages added with Add
+func NewControlLogger(display string) *Control {
+	return &Control{ctrlType: "button", role: "logger", displayVal: display}
+}
+
+// Create new SELECTOR control (drop-down list)
+func NewControlSelector(display string) *Control {
+	return &Control{ctrlType: "selector", displayVal: display}
+}
+
+// Create new STRING control (text field)
+func NewControlString(display string) *Control {
+	return &Control{ctrlType: "string", displayVal: display}
+}
+
+// Tooltip sets control tooltip
+func (c *Control) Tooltip(tooltip string) *Control {
+	c.tooltipVal = tooltip
+	return c
+}
+
+// Placeholder sets placeholder of STRING control
+func (c *Control) Placeholder(str string) *Control {
+	c.placeholder = str
+	return c
+}
+
+// Validation sets regular expression to validate value of STRING control
+func (c *Control) Validation(str string) *Control {
+	c.validation = str
+	return c
+}
+
+// Default sets default value of BOOLEAN or STRING control
+func (c *Control) Default(val string) *Control {
+	c.defaultValue = val
+	return c
+}
+
+// Values adds values to SELECTOR control
+func (c *Control) Values(values ...SelectorValue) *Control {
+	c.values = append(c.values, values...)
+	return c
+}
+
+// OnChange sets handler which is called during capture when user changes control value
+func (c *Control) OnChange(handler func(value string)) *Control {
+	c.onChange = handler
+	return c
+}
+
+// String implements stringer interface. Values of SELECTOR are printed on separate lines
+func (c *Control) String() string {
+	w := new(strings.Builder)
+	fmt.Fprintf(w, "control {number=%d}{type=%s}", c.number, c.ctrlType)
+	if c.role != "" {
+		fmt.Fprintf(w, "{role=%s}", c.role)
+	}
+	fmt.Fprintf(w, "{display=%s}", c.displayVal)
+	if c.tooltipVal != "" {
+		fmt.Fprintf(w, "{tooltip=%s}", c.tooltipVal)
+	}
+	if c.placeholder != "" {
+		fmt.Fprintf(w, "{placeholder=%s}", c.placeholder)
+	}
+	if c.validation != "" {
+		fmt.Fprintf(w, "{validation=%s}", c.validation)
+	}
+	if c.defaultValue != "" {
+		fmt.Fprintf(w, "{default=%s}", c.defaultValue)
+	}
+
+	for _, v := range c.values {
+		fmt.Fprintf(w, "\nvalue {control=%d}{value=%s}{display=%s}", c.number, v.Value, v.Display)
+		if v.Default {
+			fmt.Fprintf(w, "{default=true}")
+		}
+	}
+
+	return w.String()
+}
+
+// Set sets control value during capture. For LOGGER control it replaces log content.
+// Value of BOOLEAN control is "true" or "false".
+func (c *Control) Set(value string) error {
+	if c.ctrlType == "boolean" {
+		if value == "true" {
+			value = "\x01"
+		} else {
+			value = "\x00"
+		}
+	}
+	return toolbar.send(c.number, ctrlCmdSet, value)
+}
+
+// decodeValue converts value received from Wireshark to string
+func (c *Control) decodeValue(payload []byte) string {
+	if c.ctrlType == "boolean" {
+		return fmt.Sprintf("%t", len(payload) > 0 && payload[0] != 0)
+	}
+	return string(payload)
+}
+
+// Add adds value to SELECTOR control or appends message to LOGGER control
+func (c *Control) Add(value, display string) error {
+	payload := value
+	if c.ctrlType == "selector" {
+		payload = value + "\x00" + display
+	}
+	return toolbar.send(c.number, ctrlCmdAdd, payload)
+}
+
+// Remove removes value of SELECTOR control. Empty value removes all values
+func (c *Control) Remove(value string) error {
+	return toolbar.send(c.number, ctrlCmdRemove, value)
+}
+
+// Enable enables control
+func (c *Control) Enable() error {
+	return toolbar.send(c.number, ctrlCmdEnable, "")
+}
+
+// Disable disables control
+func (c *Control) Disable() error {
+	return toolbar.send(c.number, ctrlCmdDisable, "")
+}
+
+// Commands of control protocol
+const (
+	ctrlCmdInitialized byte = iota
+	ctrlCmdSet
+	ctrlCmdAdd
+	ctrlCmdRemove
+	ctrlCmdEnable
+	ctrlCmdDisable
+	ctrlCmdStatusbar
+	ctrlCmdInformation
+	ctrlCmdWarning
+	ctrlCmdError
+)
+
+// Maximum payload length of control message (length field is 3 bytes and includes number and command)
+const maxControlPayload = 1<<24 - 1 - 2
+
+// ErrNoControlPipe is returned when capture was started without --extcap-control-in/--extcap-control-out
+var ErrNoControlPipe = errors.New("Control pipe is not opened")
+
+// StatusMessage shows message in Wireshark status bar
+func StatusMessage(msg string) error {
+	return toolbar.send(0, ctrlCmdStatusbar, msg)
+}
+
+// InfoMessage shows information message box
+func InfoMessage(msg string) error {
+	return toolbar.send(0, ctrlCmdInformation, msg)
+}
+
+// WarningMessage shows warning message box
+func WarningMessage(msg string) error {
+	return toolbar.send(0, ctrlCmdWarning, msg)
+}
+
+// ErrorMessage shows error message box
+func ErrorMessage(msg string) error {
+	return toolbar.send(0, ctrlCmdError, msg)
+}
+
+// controlPipes exchanges messages with Wireshark interface toolbar during capture
+type controlPipes struct {
+	mu       sync.Mutex
+	out      io.WriteCloser
+	in       io.ReadCloser
+	controls []*Control
+}
+
+var toolbar = &controlPipes{}
+
+func (p *controlPipes) send(number int, cmd byte, payload string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.out == nil {
+		return ErrNoControlPipe
+	}
+	if len(payload) > maxControlPayload {
+		payload = payload[:maxControlPayload]
+	}
+
+	// sync pipe indication, 3 bytes length, control number, command, payload
+	msg := make([]byte, 6, 6+len(payload))
+	msg[0] = 'T'
+	length := uint32(len(payload) + 2)
+	msg[1], msg[2], msg[3] = byte(length>>16), byte(length>>8), byte(length)
+	msg[4], msg[5] = byte(number), cmd
+	msg = append(msg, payload...)
+
+	_, err := p.out.Write(msg)
+	return err
+}
+
+// open opens control pipes. Messages received from Wireshark are dispatched to
+// controls in background. Wireshark opens control-in pipe for writing only after
+// control-out is opened, so it is opened in background too.
+func (p *controlPipes) open(in, out string, controls []*Control) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.controls = controls
+
+	if out != "" {
+		file, err := os.OpenFile(out, os.O_WRONLY, os.ModeNamedPipe)
+		if err != nil {
+			return fmt.Errorf("Unable to open control pipe: %w", err)
+		}
+		p.out = file
+	}
+
+	if in != "" {
+		go p.readLoop(in)
+	}
+
+	return nil
+}
+
+func (p *controlPipes) readLoop(name string) {
+	file, err := os.Open(name)
+	if err != nil {
+		logger.Errorf("Unable to open control pipe: %s", err)
+		return
+	}
+
+	p.mu.Lock()
+	p.in = file
+	p.mu.Unlock()
+
+	r := bufio.NewReader(file)
+	for {
+		number, cmd, payload, err := readControlMessage(r)
+		if err != nil {
+			if err != io.EOF {
+				logger.Errorf("Unable to read control pipe: %s", err)
+			}
+			return
+		}
+
+		logger.Debugf("Control message: number %d, command %d, payload '%s'", number, cmd, payload)
+		if cmd != ctrlCmdSet || number >= len(p.controls) {
+			continue
+		}
+		if ctrl := p.controls[number]; ctrl.onChange != nil {
+			ctrl.onChange(ctrl.decodeValue(payload))
+		}
+	}
+}
+
+func readControlMessage(r io.Reader) (number int, cmd byte, payload []byte, err error) {
+	header := make([]byte, 6)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return 0, 0, nil, err
+	}
+	if header[0] != 'T' {
+		return 0, 0, nil, fmt.Errorf("Invalid control message sync byte 0x%02x", header[0])
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4]) & 0xffffff
+	if length < 2 {
+		return 0, 0, nil, fmt.Errorf("Invalid control message length %d", length)
+	}
+
+	payload = make([]byte, length-2)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return 0, 0, nil, err
+	}
+
+	return int(header[4]), header[5], payload, nil
+}
+
+// close closes control pipes
+func (p *controlPipes) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.out != nil {
+		p.out.Close()
+		p.out = nil
+	}
+	if p.in != nil {
+		p.in.Close()
+		p.in = nil
+	}
+}
@@ -0,0 +1,45 @@
+package extcap
+
+import (
+	"fmt"
+
+	"github.com/google/gopacket/layers"
+)
+
+// LinkTypeUpperPDU is link type of exported PDUs (DLT_WIRESHARK_UPPER_PDU)
+const LinkTypeUpperPDU layers.LinkType = 252
+
+// LinkTypeUser0 is the first of user defined link types (DLT_USER0 ... DLT_USER15)
+const LinkTypeUser0 layers.LinkType = 147
+
+// Well known link types: name as it is known by libpcap (without DLT_ prefix) and description
+var dltNames = map[layers.LinkType][2]string{
+	layers.LinkTypeNull:           {"NULL", "BSD loopback"},
+	layers.LinkTypeEthernet:       {"EN10MB", "Ethernet"},
+	layers.LinkTypeRaw:            {"RAW", "Raw IP"},
+	layers.LinkTypeLinuxSLL:       {"LINUX_SLL", "Linux cooked"},
+	layers.LinkTypeIEEE802_11:     {"IEEE802_11", "IEEE 802.11 wireless"},
+	layers.LinkTypeIEEE80211Radio: {"IEEE802_11_RADIO", "802.11 plus radiotap header"},
+	layers.LinkTypeIPv4:           {"IPV4", "Raw IPv4"},
+	layers.LinkTypeIPv6:           {"IPV6", "Raw IPv6"},
+	LinkTypeUpperPDU:              {"WIRESHARK_UPPER_PDU", "Wireshark Upper PDU export"},
+}
+
+// DLTFromLinkType returns DLT description for given link type
+func DLTFromLinkType(linkType layers.LinkType) DLT {
+	dlt := DLT{Number: int(linkType)}
+
+	switch names, ok := dltNames[linkType]; {
+	case ok:
+		dlt.Name = names[0]
+		dlt.Display = names[1]
+	case linkType >= LinkTypeUser0 && linkType <= LinkTypeUser0+15:
+		dlt.Name = fmt.Sprintf("USER%d", linkType-LinkTypeUser0)
+		dlt.Display = fmt.Sprintf("User %d", linkType-LinkTypeUser0)
+	default:
+		dlt.Name = fmt.Sprintf("LINKTYPE_%d", linkType)
+		dlt.Display = linkType.String()
+	}
+
+	return dlt
+}
@@ -8,4 +8,8 @@ var (
 
 	// ErrNoPipeProvided is returned when start capture and not provide pipe name to write
 	ErrNoPipeProvided = errors.New("No FIFO pipe provided")
+
+	// ErrCaptureStopped is returned by writes to the fifo after stop condition is met.
+	// StartCapture may return it as is, it is not reported as error.
+	ErrCaptureStopped = errors.New("Capture stopped")
 )
@@ -0,0 +1,78 @@
+package extcap
+
+import (
+	"encoding/binary"
+
+	"github.com/google/gopacket/layers"
+)
+
+// Tags of exported PDU header (see epan/exported_pdu.h in Wireshark sources)
+const (
+	pduTagEnd       = 0
+	pduTagProtoName = 12
+	pduTagIPv4Src   = 20
+	pduTagIPv4Dst   = 21
+	pduTagIPv6Src   = 22
+	pduTagIPv6Dst   = 23
+	pduTagPortType  = 24
+	pduTagSrcPort   = 25
+	pduTagDstPort   = 26
+)
+
+// Port types of exported PDU header
+const (
+	pduPortTypeTCP = 2
+	pduPortTypeUDP = 3
+)
+
+// ExportPDU wraps payload into exported PDU header (LinkTypeUpperPDU), so Wireshark passes
+// it directly to the dissector with given name (e.g. "syslog", "cflow", "sflow").
+// Flow is optional, when it is set, addresses and ports are shown as for the real packet.
+func ExportPDU(dissector string, flow *Flow, payload []byte) []byte {
+	buf := make([]byte, 0, 64+len(dissector)+len(payload))
+	buf = appendPDUTag(buf, pduTagProtoName, []byte(dissector))
+
+	if flow != nil {
+		if src, dst := flow.SrcIP.To4(), flow.DstIP.To4(); src != nil && dst != nil {
+			buf = appendPDUTag(buf, pduTagIPv4Src, src)
+			buf = appendPDUTag(buf, pduTagIPv4Dst, dst)
+		} else if src, dst := flow.SrcIP.To16(), flow.DstIP.To16(); src != nil && dst != nil {
+			buf = appendPDUTag(buf, pduTagIPv6Src, src)
+			buf = appendPDUTag(buf, pduTagIPv6Dst, dst)
+		}
+
+		var portType uint32
+		switch flow.Protocol {
+		case layers.IPProtocolTCP:
+			portType = pduPortTypeTCP
+		case layers.IPProtocolUDP:
+			portType = pduPortTypeUDP
+		}
+		if portType != 0 {
+			buf = appendPDUUint32(buf, pduTagPortType, portType)
+			buf = appendPDUUint32(buf, pduTagSrcPort, uint32(flow.SrcPort))
+			buf = appendPDUUint32(buf, pduTagDstPort, uint32(flow.DstPort))
+		}
+	}
+
+	buf = appendPDUTag(buf, pduTagEnd, nil)
+	return append(buf, payload...)
+}
+
+// appendPDUTag appends tag in TLV format. Value is padded with zeros to multiple of 4 bytes
+// like Wireshark does it.
+func appendPDUTag(buf []byte, tag uint16, value []byte) []byte {
+	padded := (len(value) + 3) &^ 3
+	var hdr [4]byte
+	binary.BigEndian.PutUint16(hdr[0:], tag)
+	binary.BigEndian.PutUint16(hdr[2:], uint16(padded))
+	buf = append(buf, hdr[:]...)
+	buf = append(buf, value...)
+	return append(buf, make([]byte, padded-len(value))...)
+}
+
+func appendPDUUint32(buf []byte, tag uint16, value uint32) []byte {
+	var v [4]byte
+	binary.BigEndian.PutUint32(v[:], value)
+	return appendPDUTag(buf, tag, v[:])
+}
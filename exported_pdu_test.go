@@ -0,0 +1,44 @@
+package extcap
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportPDU(t *testing.T) {
+	payload := []byte("<13>test")
+
+	data := ExportPDU("syslog", nil, payload)
+	assert.Equal(t, []byte{
+		0, 12, 0, 8, 's', 'y', 's', 'l', 'o', 'g', 0, 0,
+		0, 0, 0, 0,
+	}, data[:16])
+	assert.Equal(t, payload, data[16:])
+
+	flow := &Flow{
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.ParseIP("192.0.2.1"),
+		DstIP:    net.ParseIP("192.0.2.2"),
+		SrcPort:  40000,
+		DstPort:  514,
+	}
+	data = ExportPDU("cflow", flow, payload)
+	assert.Equal(t, []byte{
+		0, 12, 0, 8, 'c', 'f', 'l', 'o', 'w', 0, 0, 0,
+		0, 20, 0, 4, 192, 0, 2, 1,
+		0, 21, 0, 4, 192, 0, 2, 2,
+		0, 24, 0, 4, 0, 0, 0, 3,
+		0, 25, 0, 4, 0, 0, 0x9c, 0x40,
+		0, 26, 0, 4, 0, 0, 0x02, 0x02,
+		0, 0, 0, 0,
+	}, data[:len(data)-len(payload)])
+
+	flow.SrcIP = net.ParseIP("2001:db8::1")
+	flow.DstIP = net.ParseIP("2001:db8::2")
+	data = ExportPDU("cflow", flow, payload)
+	assert.Equal(t, []byte{0, 22, 0, 16}, data[12:16])
+	assert.Equal(t, []byte{0, 23, 0, 16}, data[32:36])
+}
@@ -7,7 +7,14 @@ For minimal application should be implemented following functions:
 	GetDLT:
 	StartCapture:
 
+Instead of setting these functions, capture backends may implement Source interface (and optional
+ConfigSource, ReloadSource, ControlSource and FilterValidator) and be added with App.Register.
+Several independent sources can be registered in one application, each contributing its own interfaces.
+
 Full working example can be found in examples folder
 
+Wireshark passes --debug and --debug-file flags when extcap debugging is enabled in preferences.
+Messages written with Log() go to the debug file, and to stderr when --debug-stderr is given.
+
 */
 package extcap
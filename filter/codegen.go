@@ -0,0 +1,155 @@
+package filter
+
+import (
+	"errors"
+
+	"golang.org/x/net/bpf"
+)
+
+// Boolean expression tree. Leaves are tests of single packet field, so registers
+// are never shared between tests and every leaf can be compiled independently.
+type node interface{}
+
+type andNode struct{ left, right node }
+type orNode struct{ left, right node }
+type notNode struct{ n node }
+type constNode bool
+
+// testNode loads packet field into A register and compares it with value.
+type testNode struct {
+	pre  []bpf.Instruction // set up X register for indirect load
+	load bpf.Instruction
+	mask uint32 // applied to loaded value when not 0
+	cond bpf.JumpTest
+	val  uint32
+}
+
+func and(nodes ...node) node {
+	var result node = constNode(true)
+	for _, n := range nodes {
+		switch {
+		case n == constNode(false) || result == constNode(false):
+			result = constNode(false)
+		case n == constNode(true):
+		case result == constNode(true):
+			result = n
+		default:
+			result = andNode{result, n}
+		}
+	}
+	return result
+}
+
+func or(nodes ...node) node {
+	var result node = constNode(false)
+	for _, n := range nodes {
+		switch {
+		case n == constNode(true) || result == constNode(true):
+			result = constNode(true)
+		case n == constNode(false):
+		case result == constNode(false):
+			result = n
+		default:
+			result = orNode{result, n}
+		}
+	}
+	return result
+}
+
+func not(n node) node {
+	if c, ok := n.(constNode); ok {
+		return !c
+	}
+	return notNode{n}
+}
+
+var errTooComplex = errors.New("expression is too complex")
+
+// instruction with symbolic jump targets
+type insn struct {
+	ins    bpf.Instruction
+	jt, jf int // labels of conditional jump
+	ja     int // label of unconditional jump
+}
+
+type generator struct {
+	insns  []insn
+	labels []int // label -> instruction index
+}
+
+func (g *generator) newLabel() int {
+	g.labels = append(g.labels, -1)
+	return len(g.labels) - 1
+}
+
+func (g *generator) place(label int) {
+	g.labels[label] = len(g.insns)
+}
+
+func (g *generator) emit(ins bpf.Instruction) {
+	g.insns = append(g.insns, insn{ins: ins, jt: -1, jf: -1, ja: -1})
+}
+
+func (g *generator) compile(n node, t, f int) {
+	switch n := n.(type) {
+	case constNode:
+		target := f
+		if n {
+			target = t
+		}
+		g.insns = append(g.insns, insn{ins: bpf.Jump{}, jt: -1, jf: -1, ja: target})
+	case andNode:
+		next := g.newLabel()
+		g.compile(n.left, next, f)
+		g.place(next)
+		g.compile(n.right, t, f)
+	case orNode:
+		next := g.newLabel()
+		g.compile(n.left, t, next)
+		g.place(next)
+		g.compile(n.right, t, f)
+	case notNode:
+		g.compile(n.n, f, t)
+	case testNode:
+		for _, ins := range n.pre {
+			g.emit(ins)
+		}
+		g.emit(n.load)
+		if n.mask != 0 {
+			g.emit(bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: n.mask})
+		}
+		g.insns = append(g.insns, insn{ins: bpf.JumpIf{Cond: n.cond, Val: n.val}, jt: t, jf: f, ja: -1})
+	}
+}
+
+// generate produces program which returns snaplen if expression is true and 0 otherwise
+func generate(root node, snaplen uint32) ([]bpf.Instruction, error) {
+	g := &generator{}
+	accept, reject := g.newLabel(), g.newLabel()
+
+	g.compile(root, accept, reject)
+	g.place(accept)
+	g.emit(bpf.RetConstant{Val: snaplen})
+	g.place(reject)
+	g.emit(bpf.RetConstant{Val: 0})
+
+	program := make([]bpf.Instruction, len(g.insns))
+	for i, in := range g.insns {
+		switch {
+		case in.ja >= 0:
+			program[i] = bpf.Jump{Skip: uint32(g.labels[in.ja] - i - 1)}
+		case in.jt >= 0:
+			skipTrue, skipFalse := g.labels[in.jt]-i-1, g.labels[in.jf]-i-1
+			if skipTrue > 255 || skipFalse > 255 {
+				return nil, errTooComplex
+			}
+			jump := in.ins.(bpf.JumpIf)
+			jump.SkipTrue, jump.SkipFalse = uint8(skipTrue), uint8(skipFalse)
+			program[i] = jump
+		default:
+			program[i] = in.ins
+		}
+	}
+
+	return program, nil
+}
@@ -0,0 +1,98 @@
+/*
+Package filter compiles tcpdump-style capture filter expressions into classic BPF
+and runs them in userspace. It is pure Go: neither libpcap nor root privileges are needed.
+
+Supported subset of pcap-filter(7) syntax:
+
+	ether|ip|ip6|arp|tcp|udp|sctp|icmp|icmp6
+	[ip|ip6] [src|dst|src or dst|src and dst] host <address>
+	[ip|ip6] [src|dst|src or dst|src and dst] net <network>[/<length>]
+	[tcp|udp|sctp] [src|dst|src or dst|src and dst] port <port>
+	[tcp|udp|sctp] [src|dst|src or dst|src and dst] portrange <port>-<port>
+	ether [src|dst|src or dst|src and dst] host <mac>
+	ip proto <protocol>, ip6 proto <protocol>, ether proto <protocol>
+	less <length>, greater <length>
+
+Primitives are combined with and (&&), or (||), not (!) and parentheses.
+As in tcpdump, identifier without qualifiers repeats qualifiers of the previous primitive,
+e.g. "host 10.0.0.1 or 10.0.0.2".
+
+Supported link types are Ethernet, Linux SLL, Raw IP, IPv4 and IPv6.
+*/
+package filter
+
+import (
+	"fmt"
+
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/bpf"
+)
+
+// DefaultSnapLength is returned by compiled program for matched packets
+const DefaultSnapLength = 262144
+
+// Filter is compiled capture filter
+type Filter struct {
+	expr    string
+	program []bpf.Instruction
+	vm      *bpf.VM
+}
+
+// New compiles expression for given link type and prepares it to run.
+// Empty expression matches all packets.
+func New(expr string, linkType layers.LinkType) (*Filter, error) {
+	program, err := Compile(expr, linkType, DefaultSnapLength)
+	if err != nil {
+		return nil, err
+	}
+
+	vm, err := bpf.NewVM(program)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid BPF program for filter '%s': %w", expr, err)
+	}
+
+	return &Filter{expr: expr, program: program, vm: vm}, nil
+}
+
+// Match reports if packet data are accepted by filter
+func (f *Filter) Match(data []byte) bool {
+	n, err := f.vm.Run(data)
+	return err == nil && n > 0
+}
+
+// Instructions returns compiled BPF program, e.g. to attach it to socket
+func (f *Filter) Instructions() []bpf.Instruction {
+	return f.program
+}
+
+// String returns source expression of the filter
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// Compile translates expression into classic BPF program for given link type.
+// Program returns snaplen for matched packets and 0 for others.
+func Compile(expr string, linkType layers.LinkType, snaplen uint32) ([]bpf.Instruction, error) {
+	link, ok := links[linkType]
+	if !ok {
+		return nil, fmt.Errorf("Link type %s is not supported by capture filter", linkType)
+	}
+
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, link: link}
+	root, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid capture filter '%s': %w", expr, err)
+	}
+
+	program, err := generate(root, snaplen)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to compile capture filter '%s': %w", expr, err)
+	}
+
+	return program, nil
+}
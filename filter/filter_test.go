@@ -0,0 +1,139 @@
+package filter
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ethernetPacket(t *testing.T, src, dst string, proto layers.IPProtocol, sport, dport uint16) []byte {
+	srcIP, dstIP := net.ParseIP(src), net.ParseIP(dst)
+
+	eth := &layers.Ethernet{
+		SrcMAC: net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01},
+		DstMAC: net.HardwareAddr{0x02, 0, 0, 0, 0, 0x02},
+	}
+	var netLayer gopacket.NetworkLayer
+	var ipLayer gopacket.SerializableLayer
+	if srcIP.To4() != nil {
+		eth.EthernetType = layers.EthernetTypeIPv4
+		ip := &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: proto, SrcIP: srcIP.To4(), DstIP: dstIP.To4()}
+		netLayer, ipLayer = ip, ip
+	} else {
+		eth.EthernetType = layers.EthernetTypeIPv6
+		ip := &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: proto, SrcIP: srcIP, DstIP: dstIP}
+		netLayer, ipLayer = ip, ip
+	}
+
+	var transport gopacket.SerializableLayer
+	switch proto {
+	case layers.IPProtocolTCP:
+		tcp := &layers.TCP{SrcPort: layers.TCPPort(sport), DstPort: layers.TCPPort(dport)}
+		tcp.SetNetworkLayerForChecksum(netLayer)
+		transport = tcp
+	case layers.IPProtocolUDP:
+		udp := &layers.UDP{SrcPort: layers.UDPPort(sport), DstPort: layers.UDPPort(dport)}
+		udp.SetNetworkLayerForChecksum(netLayer)
+		transport = udp
+	default:
+		transport = gopacket.Payload([]byte{8, 0, 0, 0})
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		eth, ipLayer, transport, gopacket.Payload([]byte("data")))
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+func TestFilterMatch(t *testing.T) {
+	tcp4 := ethernetPacket(t, "10.0.0.1", "192.168.1.10", layers.IPProtocolTCP, 40000, 80)
+	udp4 := ethernetPacket(t, "10.0.0.2", "192.168.1.10", layers.IPProtocolUDP, 5353, 53)
+	tcp6 := ethernetPacket(t, "2001:db8::1", "2001:db8:1::2", layers.IPProtocolTCP, 40000, 443)
+	icmp4 := ethernetPacket(t, "10.0.0.1", "10.0.0.3", layers.IPProtocolICMPv4, 0, 0)
+
+	testCases := []struct {
+		expr    string
+		matches []bool // tcp4, udp4, tcp6, icmp4
+	}{
+		{"", []bool{true, true, true, true}},
+		{"tcp", []bool{true, false, true, false}},
+		{"udp or icmp", []bool{false, true, false, true}},
+		{"ip", []bool{true, true, false, true}},
+		{"ip6", []bool{false, false, true, false}},
+		{"port 80", []bool{true, false, false, false}},
+		{"tcp port http or 443", []bool{true, false, true, false}},
+		{"dst port 53", []bool{false, true, false, false}},
+		{"src port 53", []bool{false, false, false, false}},
+		{"portrange 40-60", []bool{false, true, false, false}},
+		{"host 10.0.0.1", []bool{true, false, false, true}},
+		{"src host 10.0.0.1 or 10.0.0.2", []bool{true, true, false, true}},
+		{"dst net 192.168.0.0/16", []bool{true, true, false, false}},
+		{"net 10", []bool{true, true, false, true}},
+		{"net 2001:db8:1::/48", []bool{false, false, true, false}},
+		{"ip6 host 2001:db8::1", []bool{false, false, true, false}},
+		{"not tcp and not icmp", []bool{false, true, false, false}},
+		{"!(host 10.0.0.1 || ip6)", []bool{false, true, false, false}},
+		{"ip proto udp", []bool{false, true, false, false}},
+		{"ether proto ip6", []bool{false, false, true, false}},
+		{"ether src 02:00:00:00:00:01", []bool{true, true, true, true}},
+		{"ether dst 02:00:00:00:00:01", []bool{false, false, false, false}},
+		{"greater 70", []bool{false, false, true, false}},
+		{"less 60", []bool{true, true, false, true}},
+	}
+
+	packets := [][]byte{tcp4, udp4, tcp6, icmp4}
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			f, err := New(tc.expr, layers.LinkTypeEthernet)
+			require.NoError(t, err)
+			for i, data := range packets {
+				assert.Equal(t, tc.matches[i], f.Match(data), "packet %d", i)
+			}
+		})
+	}
+}
+
+func TestFilterLinkTypes(t *testing.T) {
+	frame := ethernetPacket(t, "10.0.0.1", "192.168.1.10", layers.IPProtocolUDP, 5000, 514)
+	raw := frame[14:]
+
+	for _, linkType := range []layers.LinkType{layers.LinkTypeRaw, layers.LinkTypeIPv4} {
+		f, err := New("udp port syslog and src 10.0.0.1", linkType)
+		require.NoError(t, err)
+		assert.True(t, f.Match(raw), linkType.String())
+	}
+
+	f, err := New("ip6", layers.LinkTypeIPv4)
+	require.NoError(t, err)
+	assert.False(t, f.Match(raw))
+}
+
+func TestFilterErrors(t *testing.T) {
+	testCases := []struct {
+		expr     string
+		linkType layers.LinkType
+	}{
+		{"tcp and", layers.LinkTypeEthernet},
+		{"(tcp", layers.LinkTypeEthernet},
+		{"port", layers.LinkTypeEthernet},
+		{"port 70000", layers.LinkTypeEthernet},
+		{"host 10.0.0.256", layers.LinkTypeEthernet},
+		{"foo", layers.LinkTypeEthernet},
+		{"tcp & udp", layers.LinkTypeEthernet},
+		{"ip6 host 10.0.0.1", layers.LinkTypeEthernet},
+		{"ether host 02:00:00:00:00:01", layers.LinkTypeRaw},
+		{"tcp", layers.LinkTypeIEEE802_11},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			_, err := New(tc.expr, tc.linkType)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,378 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+)
+
+func tokenize(expr string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == '!':
+			tokens = append(tokens, string(c))
+			i++
+		case strings.HasPrefix(expr[i:], "&&"):
+			tokens = append(tokens, "and")
+			i += 2
+		case strings.HasPrefix(expr[i:], "||"):
+			tokens = append(tokens, "or")
+			i += 2
+		case c == '&' || c == '|':
+			return nil, fmt.Errorf("unexpected '%c' at position %d", c, i)
+		default:
+			j := i
+			for j < len(expr) && !strings.ContainsRune(" \t\n\r()!&|", rune(expr[j])) {
+				j++
+			}
+			tokens = append(tokens, strings.ToLower(expr[i:j]))
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+var (
+	protoQualifiers = map[string]bool{
+		"ether": true, "ip": true, "ip6": true, "arp": true,
+		"tcp": true, "udp": true, "sctp": true, "icmp": true, "icmp6": true,
+	}
+	typeQualifiers = map[string]bool{"host": true, "net": true, "port": true, "portrange": true}
+
+	ipProtocolNames = map[string]layers.IPProtocol{
+		"icmp": layers.IPProtocolICMPv4, "icmp6": layers.IPProtocolICMPv6, "igmp": layers.IPProtocolIGMP,
+		"tcp": layers.IPProtocolTCP, "udp": layers.IPProtocolUDP, "sctp": layers.IPProtocolSCTP,
+		"gre": layers.IPProtocolGRE, "esp": layers.IPProtocolESP, "ah": layers.IPProtocolAH,
+	}
+	etherProtocolNames = map[string]layers.EthernetType{
+		"ip": layers.EthernetTypeIPv4, "ip6": layers.EthernetTypeIPv6, "arp": layers.EthernetTypeARP,
+		"vlan": layers.EthernetTypeDot1Q, "mpls": layers.EthernetTypeMPLSUnicast, "lldp": layers.EthernetTypeLinkLayerDiscovery,
+	}
+	portNames = map[string]uint16{
+		"ftp-data": 20, "ftp": 21, "ssh": 22, "telnet": 23, "smtp": 25, "domain": 53, "dns": 53,
+		"bootps": 67, "bootpc": 68, "tftp": 69, "http": 80, "pop3": 110, "ntp": 123, "imap": 143,
+		"snmp": 161, "snmptrap": 162, "bgp": 179, "ldap": 389, "https": 443, "syslog": 514,
+		"ldaps": 636, "imaps": 993, "pop3s": 995, "radius": 1812, "sip": 5060,
+	}
+)
+
+var errUnexpectedEnd = errors.New("unexpected end of expression")
+
+type qualifiers struct {
+	proto string
+	dir   string
+	typ   string
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+	link   link
+	last   *qualifiers // qualifiers of previous primitive
+}
+
+func (p *parser) peek(offset int) string {
+	if p.pos+offset < len(p.tokens) {
+		return p.tokens[p.pos+offset]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	tok := p.peek(0)
+	p.pos++
+	return tok
+}
+
+func (p *parser) parse() (node, error) {
+	if len(p.tokens) == 0 {
+		return constNode(true), nil
+	}
+
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s'", p.peek(0))
+	}
+	return n, nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek(0) == "or" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = or(left, right)
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek(0) == "and" {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = and(left, right)
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	switch p.peek(0) {
+	case "not", "!":
+		p.next()
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return not(n), nil
+	case "(":
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, errors.New("missing ')'")
+		}
+		return n, nil
+	case "":
+		return nil, errUnexpectedEnd
+	}
+	return p.parsePrimitive()
+}
+
+// endOfPrimitive reports if token can't continue primitive
+func endOfPrimitive(tok string) bool {
+	return tok == "" || tok == ")" || tok == "and" || tok == "or"
+}
+
+func (p *parser) parsePrimitive() (node, error) {
+	switch tok := p.peek(0); tok {
+	case "less", "greater":
+		p.next()
+		val, err := strconv.ParseUint(p.next(), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' requires length", tok)
+		}
+		return length(tok == "greater", uint32(val)), nil
+	}
+
+	q := qualifiers{}
+	if protoQualifiers[p.peek(0)] {
+		q.proto = p.next()
+
+		if endOfPrimitive(p.peek(0)) {
+			return p.protocol(q.proto)
+		}
+		if p.peek(0) == "proto" {
+			p.next()
+			return p.protoNumber(q.proto, p.next())
+		}
+	}
+
+	if tok := p.peek(0); tok == "src" || tok == "dst" {
+		q.dir = p.next()
+		if op := p.peek(0); (op == "or" || op == "and") && (p.peek(1) == "src" || p.peek(1) == "dst") && p.peek(1) != q.dir {
+			q.dir = "src " + op + " dst"
+			p.pos += 2
+		}
+	}
+
+	if typeQualifiers[p.peek(0)] {
+		q.typ = p.next()
+	}
+
+	if q == (qualifiers{}) {
+		// identifier without qualifiers repeats previous ones
+		if p.last != nil {
+			q = *p.last
+		}
+	} else if q.typ == "" {
+		q.typ = "host"
+	}
+
+	id := p.next()
+	if endOfPrimitive(id) {
+		return nil, errUnexpectedEnd
+	}
+	if q.typ == "" {
+		if net.ParseIP(id) == nil {
+			return nil, fmt.Errorf("unknown primitive '%s'", id)
+		}
+		q.typ = "host"
+	}
+
+	p.last = &q
+	return p.primitive(q, id)
+}
+
+func (p *parser) protocol(proto string) (node, error) {
+	l := p.link
+	switch proto {
+	case "ether":
+		return constNode(true), nil
+	case "ip":
+		return l.isIPv4(), nil
+	case "ip6":
+		return l.isIPv6(), nil
+	case "arp":
+		return l.isARP(), nil
+	case "icmp":
+		return l.ipv4Proto(layers.IPProtocolICMPv4), nil
+	case "icmp6":
+		return l.ipv6Proto(layers.IPProtocolICMPv6), nil
+	}
+	return l.ipProto(transportProtocols[proto]), nil
+}
+
+func (p *parser) protoNumber(proto, id string) (node, error) {
+	if endOfPrimitive(id) {
+		return nil, errUnexpectedEnd
+	}
+
+	switch proto {
+	case "ip", "ip6":
+		num, ok := ipProtocolNames[id]
+		if !ok {
+			n, err := strconv.ParseUint(id, 0, 8)
+			if err != nil {
+				return nil, fmt.Errorf("unknown IP protocol '%s'", id)
+			}
+			num = layers.IPProtocol(n)
+		}
+		if proto == "ip" {
+			return p.link.ipv4Proto(num), nil
+		}
+		return p.link.ipv6Proto(num), nil
+	case "ether":
+		num, ok := etherProtocolNames[id]
+		if !ok {
+			n, err := strconv.ParseUint(id, 0, 16)
+			if err != nil {
+				return nil, fmt.Errorf("unknown Ethernet protocol '%s'", id)
+			}
+			num = layers.EthernetType(n)
+		}
+		if p.link.etherTypeOff < 0 {
+			return nil, fmt.Errorf("Ethernet protocol is not supported for %s link type", p.link.name)
+		}
+		return p.link.etherType(num), nil
+	}
+	return nil, fmt.Errorf("'proto' can't be used with '%s'", proto)
+}
+
+func (p *parser) primitive(q qualifiers, id string) (node, error) {
+	switch q.typ {
+	case "host":
+		if q.proto == "ether" {
+			mac, err := net.ParseMAC(id)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Ethernet address '%s'", id)
+			}
+			return p.link.etherHost(q.dir, mac)
+		}
+		ip := net.ParseIP(id)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid host address '%s'", id)
+		}
+		return p.link.host(q.proto, q.dir, ip)
+	case "net":
+		network, err := parseNet(id)
+		if err != nil {
+			return nil, err
+		}
+		return p.link.net(q.proto, q.dir, network)
+	case "port":
+		port, err := parsePort(id)
+		if err != nil {
+			return nil, err
+		}
+		return p.link.portRange(q.proto, q.dir, port, port)
+	}
+
+	// portrange
+	bounds := strings.SplitN(id, "-", 2)
+	if len(bounds) != 2 {
+		return nil, fmt.Errorf("invalid port range '%s'", id)
+	}
+	low, err := parsePort(bounds[0])
+	if err != nil {
+		return nil, err
+	}
+	high, err := parsePort(bounds[1])
+	if err != nil {
+		return nil, err
+	}
+	if low > high {
+		low, high = high, low
+	}
+	return p.link.portRange(q.proto, q.dir, low, high)
+}
+
+func parsePort(id string) (uint16, error) {
+	if port, ok := portNames[id]; ok {
+		return port, nil
+	}
+	port, err := strconv.ParseUint(id, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid port '%s'", id)
+	}
+	return uint16(port), nil
+}
+
+// parseNet parses network in CIDR notation or IPv4 network with omitted
+// trailing octets, e.g. "10" is 10.0.0.0/8 and "192.168" is 192.168.0.0/16
+func parseNet(id string) (*net.IPNet, error) {
+	if strings.Contains(id, "/") {
+		_, network, err := net.ParseCIDR(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network '%s'", id)
+		}
+		return network, nil
+	}
+
+	if ip := net.ParseIP(id); ip != nil {
+		bits := 128
+		if ip.To4() != nil {
+			bits = 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	octets := strings.Split(id, ".")
+	if len(octets) > 3 {
+		return nil, fmt.Errorf("invalid network '%s'", id)
+	}
+	ip := make(net.IP, 4)
+	for i, octet := range octets {
+		n, err := strconv.ParseUint(octet, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network '%s'", id)
+		}
+		ip[i] = byte(n)
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(len(octets)*8, 32)}, nil
+}
@@ -0,0 +1,240 @@
+package filter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/bpf"
+)
+
+// link describes where network layer starts for given link type
+type link struct {
+	name         string
+	netOff       uint32
+	etherTypeOff int  // offset of ethertype, -1 if link type has not it
+	macs         bool // link header has Ethernet addresses
+	version      bool // IP version is detected by first nibble of network header
+	onlyIPv4     bool
+	onlyIPv6     bool
+}
+
+var links = map[layers.LinkType]link{
+	layers.LinkTypeEthernet: {name: "Ethernet", netOff: 14, etherTypeOff: 12, macs: true},
+	layers.LinkTypeLinuxSLL: {name: "Linux SLL", netOff: 16, etherTypeOff: 14},
+	layers.LinkTypeRaw:      {name: "Raw", netOff: 0, etherTypeOff: -1, version: true},
+	layers.LinkTypeIPv4:     {name: "IPv4", netOff: 0, etherTypeOff: -1, onlyIPv4: true},
+	layers.LinkTypeIPv6:     {name: "IPv6", netOff: 0, etherTypeOff: -1, onlyIPv6: true},
+}
+
+func loadAbs(off uint32, size int) bpf.Instruction {
+	return bpf.LoadAbsolute{Off: off, Size: size}
+}
+
+func test(off uint32, size int, val uint32) node {
+	return testNode{load: loadAbs(off, size), cond: bpf.JumpEqual, val: val}
+}
+
+func testMasked(off uint32, size int, mask, val uint32) node {
+	return testNode{load: loadAbs(off, size), mask: mask, cond: bpf.JumpEqual, val: val}
+}
+
+func (l link) etherType(etherType layers.EthernetType) node {
+	if l.etherTypeOff < 0 {
+		return constNode(false)
+	}
+	return test(uint32(l.etherTypeOff), 2, uint32(etherType))
+}
+
+func (l link) isIPv4() node {
+	switch {
+	case l.onlyIPv4:
+		return constNode(true)
+	case l.onlyIPv6:
+		return constNode(false)
+	case l.version:
+		return testMasked(0, 1, 0xf0, 0x40)
+	}
+	return l.etherType(layers.EthernetTypeIPv4)
+}
+
+func (l link) isIPv6() node {
+	switch {
+	case l.onlyIPv6:
+		return constNode(true)
+	case l.onlyIPv4:
+		return constNode(false)
+	case l.version:
+		return testMasked(0, 1, 0xf0, 0x60)
+	}
+	return l.etherType(layers.EthernetTypeIPv6)
+}
+
+func (l link) isARP() node {
+	return l.etherType(layers.EthernetTypeARP)
+}
+
+// ipv4Proto checks protocol field of IPv4 header, so all fragments of the packet match
+func (l link) ipv4Proto(proto layers.IPProtocol) node {
+	return and(l.isIPv4(), test(l.netOff+9, 1, uint32(proto)))
+}
+
+func (l link) ipv6Proto(proto layers.IPProtocol) node {
+	return and(l.isIPv6(), test(l.netOff+6, 1, uint32(proto)))
+}
+
+func (l link) ipProto(proto layers.IPProtocol) node {
+	return or(l.ipv4Proto(proto), l.ipv6Proto(proto))
+}
+
+// combine applies test to source and/or destination according to direction
+func combine(dir string, src, dst node) node {
+	switch dir {
+	case "src":
+		return src
+	case "dst":
+		return dst
+	case "src and dst":
+		return and(src, dst)
+	}
+	return or(src, dst)
+}
+
+func (l link) host(proto, dir string, ip net.IP) (node, error) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return l.net4(proto, dir, ip4, net.CIDRMask(32, 32))
+	}
+	return l.net6(proto, dir, ip.To16(), net.CIDRMask(128, 128))
+}
+
+func (l link) net(proto, dir string, network *net.IPNet) (node, error) {
+	if ip4 := network.IP.To4(); ip4 != nil {
+		return l.net4(proto, dir, ip4, network.Mask)
+	}
+	return l.net6(proto, dir, network.IP.To16(), network.Mask)
+}
+
+func (l link) net4(proto, dir string, ip net.IP, mask net.IPMask) (node, error) {
+	if proto != "" && proto != "ip" && proto != "arp" {
+		return nil, fmt.Errorf("IPv4 address can't be used with '%s'", proto)
+	}
+
+	addr := binary.BigEndian.Uint32(ip)
+	m := binary.BigEndian.Uint32(mask)
+	field := func(off uint32) node {
+		if m == 0xffffffff {
+			return test(off, 4, addr)
+		}
+		return testMasked(off, 4, m, addr&m)
+	}
+
+	var ipNode, arpNode node = constNode(false), constNode(false)
+	if proto != "arp" {
+		ipNode = and(l.isIPv4(), combine(dir, field(l.netOff+12), field(l.netOff+16)))
+	}
+	if proto != "ip" {
+		arpNode = and(l.isARP(), combine(dir, field(l.netOff+14), field(l.netOff+24)))
+	}
+	return or(ipNode, arpNode), nil
+}
+
+func (l link) net6(proto, dir string, ip net.IP, mask net.IPMask) (node, error) {
+	if proto != "" && proto != "ip6" {
+		return nil, fmt.Errorf("IPv6 address can't be used with '%s'", proto)
+	}
+
+	field := func(off uint32) node {
+		var words []node
+		for i := 0; i < 4; i++ {
+			m := binary.BigEndian.Uint32(mask[i*4:])
+			addr := binary.BigEndian.Uint32(ip[i*4:])
+			switch m {
+			case 0:
+			case 0xffffffff:
+				words = append(words, test(off+uint32(i*4), 4, addr))
+			default:
+				words = append(words, testMasked(off+uint32(i*4), 4, m, addr&m))
+			}
+		}
+		return and(words...)
+	}
+
+	return and(l.isIPv6(), combine(dir, field(l.netOff+8), field(l.netOff+24))), nil
+}
+
+var transportProtocols = map[string]layers.IPProtocol{
+	"tcp":  layers.IPProtocolTCP,
+	"udp":  layers.IPProtocolUDP,
+	"sctp": layers.IPProtocolSCTP,
+}
+
+// portRange checks transport ports in range [low, high]
+func (l link) portRange(proto, dir string, low, high uint16) (node, error) {
+	var protos []layers.IPProtocol
+	switch proto {
+	case "":
+		protos = []layers.IPProtocol{layers.IPProtocolTCP, layers.IPProtocolUDP, layers.IPProtocolSCTP}
+	case "tcp", "udp", "sctp":
+		protos = []layers.IPProtocol{transportProtocols[proto]}
+	default:
+		return nil, fmt.Errorf("port can't be used with '%s'", proto)
+	}
+
+	// load of port relative to X register set by setup
+	field := func(setup []bpf.Instruction, off uint32) node {
+		load := bpf.LoadIndirect{Off: off, Size: 2}
+		if low == high {
+			return testNode{pre: setup, load: load, cond: bpf.JumpEqual, val: uint32(low)}
+		}
+		return and(
+			testNode{pre: setup, load: load, cond: bpf.JumpGreaterOrEqual, val: uint32(low)},
+			not(testNode{pre: setup, load: load, cond: bpf.JumpGreaterThan, val: uint32(high)}),
+		)
+	}
+
+	// IPv4: X = header length, first fragment only
+	v4setup := []bpf.Instruction{bpf.LoadMemShift{Off: l.netOff}}
+	v4protos := make([]node, len(protos))
+	v6protos := make([]node, len(protos))
+	for i, p := range protos {
+		v4protos[i] = test(l.netOff+9, 1, uint32(p))
+		v6protos[i] = test(l.netOff+6, 1, uint32(p))
+	}
+	notFragment := not(testNode{load: loadAbs(l.netOff+6, 2), cond: bpf.JumpBitsSet, val: 0x1fff})
+	v4 := and(l.isIPv4(), or(v4protos...), notFragment,
+		combine(dir, field(v4setup, l.netOff), field(v4setup, l.netOff+2)))
+
+	// IPv6: extension headers are not followed, as in libpcap
+	v6setup := []bpf.Instruction{bpf.LoadConstant{Dst: bpf.RegX, Val: 40}}
+	v6 := and(l.isIPv6(), or(v6protos...),
+		combine(dir, field(v6setup, l.netOff), field(v6setup, l.netOff+2)))
+
+	return or(v4, v6), nil
+}
+
+func (l link) etherHost(dir string, mac net.HardwareAddr) (node, error) {
+	if !l.macs {
+		return nil, fmt.Errorf("Ethernet addresses are not supported for %s link type", l.name)
+	}
+	if len(mac) != 6 {
+		return nil, fmt.Errorf("invalid Ethernet address %s", mac)
+	}
+
+	field := func(off uint32) node {
+		return and(
+			test(off+2, 4, binary.BigEndian.Uint32(mac[2:])),
+			test(off, 2, uint32(binary.BigEndian.Uint16(mac))),
+		)
+	}
+	return combine(dir, field(6), field(0)), nil
+}
+
+// length compares packet length with given value
+func length(greater bool, val uint32) node {
+	load := bpf.LoadExtension{Num: bpf.ExtLen}
+	if greater {
+		return testNode{load: load, cond: bpf.JumpGreaterOrEqual, val: val}
+	}
+	return not(testNode{load: load, cond: bpf.JumpGreaterThan, val: val})
+}
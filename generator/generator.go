@@ -0,0 +1,241 @@
+/*
+Package generator implements capture source which emits synthetic packets built from
+payload template. It is used for demos, for testing of custom dissectors in CI and for
+smoke test of the FIFO path of extcap built on this library.
+
+Payload is written with one of user link types, as exported PDU or wrapped into
+Ethernet/IPv4/UDP headers. See parseTemplate for supported placeholders, e.g.
+
+	hello %seq %hex(00ff) %rand(4) %randint(1-100)
+
+Usage:
+
+	app := extcap.App{Usage: "generator"}
+	app.Register(generator.New())
+	app.Run(os.Args)
+*/
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	"github.com/kor44/extcap"
+)
+
+// Values of Output option except user DLTs "user0" ... "user15"
+const (
+	OutputUDP         = "udp"
+	OutputExportedPDU = "exported-pdu"
+)
+
+// Define all options
+var (
+	Template = extcap.NewConfigStringOpt("template", "Payload template").
+			Default("packet %seq").Tooltip("Text with placeholders %seq, %seq32, %rand(N), %randint(A-B), %hex(XX), %% is percent sign")
+	Rate = extcap.NewConfigDoubleOpt("rate", "Rate (packets/s)").
+		Range(0, 1000000).Default(1).Tooltip("0 generates packets as fast as possible")
+	Count = extcap.NewConfigIntegerOpt("count", "Packet count").
+		Range(0, 1000000000).Default(0).Tooltip("Capture stops after this number of packets, 0 is unlimited")
+	Output = extcap.NewConfigSelectorOpt("output", "Output DLT").Values(outputValues()...).
+		Default("user0").Tooltip("How payload is encapsulated")
+	Port = extcap.NewConfigIntegerOpt("port", "UDP port").
+		Range(1, 65535).Default(9999).Tooltip("Destination port for UDP output")
+	Dissector = extcap.NewConfigStringOpt("dissector", "Dissector").
+			Default("data").Tooltip("Wireshark dissector for exported PDU output")
+	Seed = extcap.NewConfigIntegerOpt("seed", "Random seed").
+		Default(0).Tooltip("Seed for random fields, 0 is random seed")
+)
+
+func outputValues() []extcap.SelectorValue {
+	values := []extcap.SelectorValue{
+		{Value: OutputUDP, Display: "Ethernet/IPv4/UDP"},
+		{Value: OutputExportedPDU, Display: "Exported PDU"},
+	}
+	for i := 0; i < 16; i++ {
+		values = append(values, extcap.SelectorValue{
+			Value:   fmt.Sprintf("user%d", i),
+			Display: fmt.Sprintf("DLT_USER%d (%d)", i, int(extcap.LinkTypeUser0)+i),
+		})
+	}
+	return values
+}
+
+const (
+	defaultInterface = "generator"
+	snapLength       = 262144
+)
+
+// Source generates packets
+type Source struct {
+	// Interface is name of the interface. Default is "generator"
+	Interface string
+}
+
+// New creates source with default settings
+func New() *Source {
+	return &Source{Interface: defaultInterface}
+}
+
+// Interfaces implements extcap.Source interface
+func (s *Source) Interfaces() ([]extcap.CaptureInterface, error) {
+	return []extcap.CaptureInterface{{Value: s.Interface, Display: "Traffic generator"}}, nil
+}
+
+// DLT implements extcap.Source interface. Output DLT is chosen in options, so USER0 is reported.
+func (s *Source) DLT(iface string) (extcap.DLT, error) {
+	if iface != s.Interface {
+		return extcap.DLT{}, fmt.Errorf("%w '%s'", extcap.ErrUnknownInterface, iface)
+	}
+	return extcap.DLTFromLinkType(extcap.LinkTypeUser0), nil
+}
+
+// ConfigOptions implements extcap.ConfigSource interface
+func (s *Source) ConfigOptions(iface string) ([]extcap.ConfigOption, error) {
+	return s.AllConfigOptions(), nil
+}
+
+// AllConfigOptions implements extcap.ConfigSource interface
+func (s *Source) AllConfigOptions() []extcap.ConfigOption {
+	return []extcap.ConfigOption{Template, Rate, Count, Output, Port, Dissector, Seed}
+}
+
+// StartCapture implements extcap.Source interface
+func (s *Source) StartCapture(iface string, fifo io.WriteCloser, filter string, opts map[string]interface{}) error {
+	defer fifo.Close()
+
+	if iface != s.Interface {
+		return fmt.Errorf("%w '%s'", extcap.ErrUnknownInterface, iface)
+	}
+
+	cfg := config{template: "packet %seq", rate: 1, output: "user0", port: 9999, dissector: "data"}
+	if v, ok := opts[Template.Call()].(string); ok && v != "" {
+		cfg.template = v
+	}
+	if v, ok := opts[Rate.Call()].(float64); ok {
+		cfg.rate = v
+	}
+	if v, ok := opts[Count.Call()].(int); ok {
+		cfg.count = v
+	}
+	if v, ok := opts[Output.Call()].(string); ok && v != "" {
+		cfg.output = v
+	}
+	if v, ok := opts[Port.Call()].(int); ok && v > 0 {
+		cfg.port = v
+	}
+	if v, ok := opts[Dissector.Call()].(string); ok && v != "" {
+		cfg.dissector = v
+	}
+	if v, ok := opts[Seed.Call()].(int); ok {
+		cfg.seed = int64(v)
+	}
+
+	return generate(fifo, cfg)
+}
+
+type config struct {
+	template  string
+	rate      float64 // packets per second, 0 means no delays
+	count     int     // 0 means unlimited
+	output    string
+	port      int
+	dissector string
+	seed      int64 // 0 means random seed
+}
+
+// encoder wraps payload for the output link type
+type encoder func(payload []byte) ([]byte, error)
+
+func newEncoder(cfg config) (layers.LinkType, encoder, error) {
+	switch cfg.output {
+	case OutputExportedPDU:
+		return extcap.LinkTypeUpperPDU, func(payload []byte) ([]byte, error) {
+			return extcap.ExportPDU(cfg.dissector, nil, payload), nil
+		}, nil
+	case OutputUDP:
+		b, err := extcap.NewPacketBuilder(layers.LinkTypeEthernet)
+		if err != nil {
+			return 0, nil, err
+		}
+		flow := extcap.Flow{
+			Protocol: layers.IPProtocolUDP,
+			SrcIP:    net.IPv4(192, 0, 2, 1),
+			DstIP:    net.IPv4(192, 0, 2, 2),
+			SrcPort:  40000,
+			DstPort:  uint16(cfg.port),
+		}
+		return layers.LinkTypeEthernet, func(payload []byte) ([]byte, error) {
+			return b.Build(flow, payload)
+		}, nil
+	}
+
+	n, err := strconv.Atoi(strings.TrimPrefix(cfg.output, "user"))
+	if !strings.HasPrefix(cfg.output, "user") || err != nil || n < 0 || n > 15 {
+		return 0, nil, fmt.Errorf("Invalid output '%s'", cfg.output)
+	}
+	return extcap.LinkTypeUser0 + layers.LinkType(n), func(payload []byte) ([]byte, error) {
+		return payload, nil
+	}, nil
+}
+
+// generate writes packets until count is reached or writing fails
+func generate(w io.Writer, cfg config) error {
+	tmpl, err := parseTemplate(cfg.template)
+	if err != nil {
+		return err
+	}
+	linkType, encode, err := newEncoder(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.rate < 0 {
+		return errors.New("Rate should not be negative")
+	}
+
+	seed := cfg.seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rnd := rand.New(rand.NewSource(seed))
+
+	pw := pcapgo.NewWriterNanos(w)
+	if err = pw.WriteFileHeader(snapLength, linkType); err != nil {
+		return err
+	}
+
+	extcap.Log().Infof("Generate %s packets with rate %g, seed %d", linkType, cfg.rate, seed)
+	start := time.Now()
+	for seq := uint64(1); cfg.count == 0 || seq <= uint64(cfg.count); seq++ {
+		if cfg.rate > 0 {
+			next := start.Add(time.Duration(float64(seq-1) / cfg.rate * float64(time.Second)))
+			if delay := time.Until(next); delay > 0 {
+				time.Sleep(delay)
+			}
+		}
+
+		data, err := encode(tmpl.payload(seq, rnd))
+		if err != nil {
+			return err
+		}
+		ci := gopacket.CaptureInfo{
+			Timestamp:     time.Now(),
+			CaptureLength: len(data),
+			Length:        len(data),
+		}
+		if err = pw.WritePacket(ci, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kor44/extcap"
+)
+
+func TestTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		expected []byte
+	}{
+		{"packet %seq", []byte("packet 7")},
+		{"%seq32%hex(00ff)", []byte{0, 0, 0, 7, 0, 0xff}},
+		{"100%% %seq", []byte("100% 7")},
+		{"%randint(5-5) end", []byte("5 end")},
+		{"{seq} %seq.", []byte("{seq} 7.")},
+		{"%seq1", []byte("71")},
+		{"%randint(-3--3)", []byte("-3")},
+		{"%randint(-1-0)%seq", []byte("-17")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			tmpl, err := parseTemplate(tt.template)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, tmpl.payload(7, rand.New(rand.NewSource(1))))
+		})
+	}
+
+	// random fields are reproducible with the same seed
+	tmpl, err := parseTemplate("%rand(8)")
+	require.NoError(t, err)
+	first := tmpl.payload(1, rand.New(rand.NewSource(42)))
+	assert.Len(t, first, 8)
+	assert.Equal(t, first, tmpl.payload(1, rand.New(rand.NewSource(42))))
+
+	for _, invalid := range []string{"%rand(8", "%unknown", "%rand(x)", "%randint(5-1)", "%randint(-1--5)", "%randint(5)", "%randint(-5)", "%hex(zz)", "%"} {
+		_, err = parseTemplate(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestConfigOutput(t *testing.T) {
+	// Wireshark ends value of option parameter at the first "}"
+	param := regexp.MustCompile(`^(arg|value) (\{[a-z]+=[^{}]*\})+$`)
+	for _, opt := range New().AllConfigOptions() {
+		for _, line := range strings.Split(fmt.Sprint(opt), "\n") {
+			assert.Regexp(t, param, line)
+		}
+	}
+	assert.Contains(t, fmt.Sprint(Template), "{default=packet %seq}")
+}
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		output   string
+		linkType layers.LinkType
+	}{
+		{"user3", extcap.LinkTypeUser0 + 3},
+		{OutputExportedPDU, extcap.LinkTypeUpperPDU},
+		{OutputUDP, layers.LinkTypeEthernet},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.output, func(t *testing.T) {
+			out := new(bytes.Buffer)
+			start := time.Now()
+			cfg := config{template: "msg %seq", rate: 100, count: 3, output: tt.output, port: 9999, dissector: "data"}
+			require.NoError(t, generate(out, cfg))
+			assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+			r, err := pcapgo.NewReader(out)
+			require.NoError(t, err)
+			assert.Equal(t, tt.linkType, r.LinkType())
+
+			for seq := 1; seq <= 3; seq++ {
+				data, _, err := r.ReadPacketData()
+				require.NoError(t, err)
+				if tt.output == OutputUDP {
+					// short Ethernet frames are padded, so payload is taken from UDP layer
+					p := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+					udp, ok := p.Layer(layers.LayerTypeUDP).(*layers.UDP)
+					require.True(t, ok)
+					assert.Equal(t, layers.UDPPort(9999), udp.DstPort)
+					data = udp.Payload
+				}
+				assert.True(t, bytes.HasSuffix(data, []byte("msg "+string(rune('0'+seq)))))
+			}
+			_, _, err = r.ReadPacketData()
+			assert.Error(t, err)
+		})
+	}
+
+	assert.Error(t, generate(new(bytes.Buffer), config{template: "x", output: "user16"}))
+}
@@ -0,0 +1,135 @@
+package generator
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// field produces part of the payload for packet with given sequence number
+type field func(seq uint64, rnd *rand.Rand) []byte
+
+// template is compiled payload template
+type template []field
+
+// parseTemplate compiles payload template. Placeholders don't use braces, because
+// Wireshark ends default value and tooltip of the option at the first "}". Supported placeholders:
+//
+//	%seq            sequence number, decimal
+//	%seq32          sequence number, 4 bytes big endian
+//	%rand(N)        N random bytes
+//	%randint(A-B)   random integer from A to B, decimal, e.g. %randint(-10--1)
+//	%hex(0A0B)      bytes given in hex
+//	%%              literal "%"
+func parseTemplate(text string) (template, error) {
+	var t template
+	for text != "" {
+		i := strings.IndexByte(text, '%')
+		if i < 0 {
+			t = append(t, literal([]byte(text)))
+			break
+		}
+		if i > 0 {
+			t = append(t, literal([]byte(text[:i])))
+		}
+		text = text[i+1:]
+
+		if strings.HasPrefix(text, "%") {
+			t = append(t, literal([]byte("%")))
+			text = text[1:]
+			continue
+		}
+
+		// name is letters, so digits may follow placeholder; argument is in parentheses
+		n := 0
+		for n < len(text) && text[n] >= 'a' && text[n] <= 'z' {
+			n++
+		}
+		if text[:n] == "seq" && strings.HasPrefix(text[n:], "32") {
+			n += 2
+		}
+		name, arg := text[:n], ""
+		text = text[n:]
+		if strings.HasPrefix(text, "(") {
+			end := strings.IndexByte(text, ')')
+			if end < 0 {
+				return nil, fmt.Errorf("Unclosed argument of placeholder '%%%s' in template", name)
+			}
+			arg, text = text[1:end], text[end+1:]
+		}
+
+		f, err := placeholder(name, arg)
+		if err != nil {
+			return nil, err
+		}
+		t = append(t, f)
+	}
+	return t, nil
+}
+
+func literal(data []byte) field {
+	return func(uint64, *rand.Rand) []byte { return data }
+}
+
+func placeholder(name, arg string) (field, error) {
+	switch name {
+	case "seq":
+		return func(seq uint64, _ *rand.Rand) []byte {
+			return strconv.AppendUint(nil, seq, 10)
+		}, nil
+	case "seq32":
+		return func(seq uint64, _ *rand.Rand) []byte {
+			b := make([]byte, 4)
+			binary.BigEndian.PutUint32(b, uint32(seq))
+			return b
+		}, nil
+	case "rand":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("Invalid length of random field: '%s'", arg)
+		}
+		return func(_ uint64, rnd *rand.Rand) []byte {
+			b := make([]byte, n)
+			rnd.Read(b)
+			return b
+		}, nil
+	case "randint":
+		// separator is the first "-" after sign of the lower bound
+		sep := -1
+		if arg != "" {
+			if sep = strings.IndexByte(arg[1:], '-'); sep >= 0 {
+				sep++
+			}
+		}
+		if sep < 0 {
+			return nil, fmt.Errorf("Invalid range of random integer: '%s'", arg)
+		}
+		min, err1 := strconv.ParseInt(arg[:sep], 10, 64)
+		max, err2 := strconv.ParseInt(arg[sep+1:], 10, 64)
+		if err1 != nil || err2 != nil || min > max || max-min+1 <= 0 {
+			return nil, fmt.Errorf("Invalid range of random integer: '%s'", arg)
+		}
+		return func(_ uint64, rnd *rand.Rand) []byte {
+			return strconv.AppendInt(nil, min+rnd.Int63n(max-min+1), 10)
+		}, nil
+	case "hex":
+		data, err := hex.DecodeString(arg)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid hex field: %w", err)
+		}
+		return literal(data), nil
+	}
+	return nil, fmt.Errorf("Unknown placeholder '%%%s' in template", name)
+}
+
+// payload returns payload of packet with given sequence number
+func (t template) payload(seq uint64, rnd *rand.Rand) []byte {
+	var data []byte
+	for _, f := range t {
+		data = append(data, f(seq, rnd)...)
+	}
+	return data
+}
@@ -0,0 +1,91 @@
+package extcap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// nopCloser is stdout passed to StartCapture, it stays open when capture is closed
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// openPipe opens output of the capture. Besides FIFO created by Wireshark it may be
+// "-" for stdout or regular file, which is created or truncated (headless mode).
+func openPipe(name string) (io.WriteCloser, error) {
+	if name == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+
+	flag := os.O_WRONLY
+	if info, err := os.Stat(name); err != nil || info.Mode().IsRegular() {
+		flag |= os.O_CREATE | os.O_TRUNC
+	}
+	pipe, err := os.OpenFile(name, flag, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Undable to open pipe: %w", err)
+	}
+
+	return pipe, nil
+}
+
+// loadConfigFile sets flags from config file. Each line of the file is "name = value",
+// where name is call of config option or extcap flag, e.g.
+//
+//	# record syslog of the router
+//	extcap-interface = udpdump
+//	fifo = /var/lib/capture/syslog.pcap
+//	port = 514
+//
+// Empty lines and lines starting with # are ignored. Value may be double quoted.
+// Flags given in command line take precedence over the file.
+func loadConfigFile(ctx *cli.Context, name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("Unable to open config file: %w", err)
+	}
+	defer file.Close()
+
+	known := make(map[string]bool)
+	for _, flag := range ctx.App.Flags {
+		known[flag.Names()[0]] = true
+	}
+
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" {
+			return fmt.Errorf("Invalid line %d in config file '%s'", number, name)
+		}
+		if !known[key] || key == "config-file" {
+			return fmt.Errorf("Unknown option '%s' in config file '%s'", key, name)
+		}
+		if strings.HasPrefix(value, `"`) {
+			if value, err = strconv.Unquote(value); err != nil {
+				return fmt.Errorf("Invalid value of option '%s' in config file '%s': %w", key, name, err)
+			}
+		}
+
+		if ctx.IsSet(key) {
+			continue
+		}
+		if err = ctx.Set(key, value); err != nil {
+			return fmt.Errorf("Invalid value of option '%s' in config file '%s': %w", key, name, err)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,129 @@
+package extcap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestOpenPipe(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "out.pcap")
+
+	// created
+	pipe, err := openPipe(name)
+	require.NoError(t, err)
+	_, err = pipe.Write([]byte("first"))
+	require.NoError(t, err)
+	require.NoError(t, pipe.Close())
+
+	// truncated
+	pipe, err = openPipe(name)
+	require.NoError(t, err)
+	_, err = pipe.Write([]byte("new"))
+	require.NoError(t, err)
+	require.NoError(t, pipe.Close())
+
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+
+	// stdout is not closed with the pipe
+	pipe, err = openPipe("-")
+	require.NoError(t, err)
+	assert.Equal(t, nopCloser{os.Stdout}, pipe)
+	require.NoError(t, pipe.Close())
+	_, err = os.Stdout.Stat()
+	assert.NoError(t, err)
+
+	_, err = openPipe(filepath.Join(name, "missing", "out.pcap"))
+	assert.Error(t, err)
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		expected map[string]interface{}
+		err      string
+	}{
+		{"values", "# comment\n\nextcap-interface = eth0\nport=514\nmessage = \"a = b\"\nverbose = true\n",
+			map[string]interface{}{"extcap-interface": "eth0", "port": 514, "message": "a = b", "verbose": true}, ""},
+		{"command line has precedence", "port = 514\nmessage = file",
+			map[string]interface{}{"port": 1000, "message": "file"}, ""},
+		{"unknown option", "speed = 1", nil, "Unknown option 'speed'"},
+		{"invalid line", "port", nil, "Invalid line 1"},
+		{"invalid value", "port = abc", nil, "Invalid value of option 'port'"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "capture.conf")
+			require.NoError(t, os.WriteFile(name, []byte(tc.text), 0644))
+
+			args := []string{"test", "--config-file", name}
+			if tc.name == "command line has precedence" {
+				args = append(args, "--port", "1000")
+			}
+
+			var values map[string]interface{}
+			app := &cli.App{
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "config-file"},
+					&cli.StringFlag{Name: "extcap-interface"},
+					&cli.IntFlag{Name: "port"},
+					&cli.StringFlag{Name: "message"},
+					&cli.BoolFlag{Name: "verbose"},
+				},
+				Action: func(ctx *cli.Context) error {
+					if err := loadConfigFile(ctx, ctx.String("config-file")); err != nil {
+						return err
+					}
+					values = make(map[string]interface{})
+					for key := range tc.expected {
+						assert.True(t, ctx.IsSet(key), key)
+						values[key] = ctx.Value(key)
+					}
+					return nil
+				},
+			}
+
+			err := app.Run(args)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, values)
+		})
+	}
+}
+
+func TestCheckValue(t *testing.T) {
+	testCases := []struct {
+		opt   ConfigOption
+		value interface{}
+		valid bool
+	}{
+		{NewConfigIntegerOpt("delay", "Delay").Range(1, 15), 15, true},
+		{NewConfigIntegerOpt("delay", "Delay").Range(1, 15), 16, false},
+		{NewConfigDoubleOpt("speed", "Speed").Range(0.1, 10), 0.05, false},
+		{NewConfigStringOpt("server", "Server").Validation(`^\d+$`), "abc", false},
+		{NewConfigStringOpt("server", "Server").Validation(`^\d+$`), "", true},
+		{NewConfigStringOpt("server", "Server").Required(true), "", false},
+		{NewConfigFileSelectOpt("file", "File").MustExist(true), "/nonexistent/file", false},
+		{NewConfigFileSelectOpt("file", "File"), "/nonexistent/file", true},
+	}
+
+	for _, tc := range testCases {
+		err := checkValue(tc.opt, tc.value)
+		if tc.valid {
+			assert.NoError(t, err, tc.opt)
+		} else {
+			assert.Error(t, err, tc.opt)
+		}
+	}
+}
@@ -0,0 +1,390 @@
+/*
+Package listener implements capture source which receives data pushed by devices
+(syslog, NetFlow, IPFIX, sFlow or any raw UDP/TCP export).
+
+Every received datagram or framed TCP message is wrapped into exported PDU with its
+real peer addresses and ports and passed to the selected Wireshark dissector, so device
+exports can be watched live without running tcpdump on the collector.
+
+Usage:
+
+	app := extcap.App{Usage: "syslog listener"}
+	app.Register(listener.New())
+	app.Run(os.Args)
+*/
+package listener
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+
+	"github.com/kor44/extcap"
+)
+
+// Values of Protocol and Framing options
+const (
+	ProtocolUDP = "udp"
+	ProtocolTCP = "tcp"
+
+	FramingLine       = "line"
+	FramingOctetCount = "octet-count"
+)
+
+// Define all options
+var (
+	BindAddress = extcap.NewConfigStringOpt("bind-address", "Bind address").
+			Default("0.0.0.0").Tooltip("Local address to listen on")
+	Port = extcap.NewConfigIntegerOpt("port", "Port").
+		Range(1, 65535).Default(514).Tooltip("Local port to listen on")
+	Protocol = extcap.NewConfigRadioOpt("protocol", "Protocol").Values(
+		extcap.SelectorValue{Value: ProtocolUDP, Display: "UDP"},
+		extcap.SelectorValue{Value: ProtocolTCP, Display: "TCP"},
+	).Default(ProtocolUDP)
+	Framing = extcap.NewConfigSelectorOpt("framing", "TCP framing").Values(
+		extcap.SelectorValue{Value: FramingLine, Display: "Newline terminated"},
+		extcap.SelectorValue{Value: FramingOctetCount, Display: "Octet counting (RFC 6587)"},
+	).Default(FramingLine).Tooltip("How messages are separated in TCP stream")
+	Dissector = extcap.NewConfigStringOpt("dissector", "Dissector").
+			Default("syslog").Tooltip("Wireshark dissector for received messages, e.g. syslog, cflow, sflow")
+)
+
+// maxMessageSize limits size of single message
+const maxMessageSize = 65535
+
+const defaultInterface = "listener"
+
+// Source listens for data pushed by devices
+type Source struct {
+	// Interface is name of the interface. Default is "listener"
+	Interface string
+}
+
+// New creates source with default settings
+func New() *Source {
+	return &Source{Interface: defaultInterface}
+}
+
+// Interfaces implements extcap.Source interface
+func (s *Source) Interfaces() ([]extcap.CaptureInterface, error) {
+	return []extcap.CaptureInterface{{Value: s.Interface, Display: "UDP/TCP listener"}}, nil
+}
+
+// DLT implements extcap.Source interface
+func (s *Source) DLT(iface string) (extcap.DLT, error) {
+	if iface != s.Interface {
+		return extcap.DLT{}, fmt.Errorf("%w '%s'", extcap.ErrUnknownInterface, iface)
+	}
+	return extcap.DLTFromLinkType(extcap.LinkTypeUpperPDU), nil
+}
+
+// ConfigOptions implements extcap.ConfigSource interface
+func (s *Source) ConfigOptions(iface string) ([]extcap.ConfigOption, error) {
+	return s.AllConfigOptions(), nil
+}
+
+// AllConfigOptions implements extcap.ConfigSource interface
+func (s *Source) AllConfigOptions() []extcap.ConfigOption {
+	return []extcap.ConfigOption{BindAddress, Port, Protocol, Framing, Dissector}
+}
+
+// StartCapture implements extcap.Source interface
+func (s *Source) StartCapture(iface string, fifo io.WriteCloser, filter string, opts map[string]interface{}) error {
+	defer fifo.Close()
+
+	if iface != s.Interface {
+		return fmt.Errorf("%w '%s'", extcap.ErrUnknownInterface, iface)
+	}
+
+	address, port, protocol := "0.0.0.0", 514, ProtocolUDP
+	framing, dissector := FramingLine, "syslog"
+	if v, ok := opts[BindAddress.Call()].(string); ok && v != "" {
+		address = v
+	}
+	if v, ok := opts[Port.Call()].(int); ok && v > 0 {
+		port = v
+	}
+	if v, ok := opts[Protocol.Call()].(string); ok && v != "" {
+		protocol = v
+	}
+	if v, ok := opts[Framing.Call()].(string); ok && v != "" {
+		framing = v
+	}
+	if v, ok := opts[Dissector.Call()].(string); ok && v != "" {
+		dissector = v
+	}
+
+	w, err := newPDUWriter(fifo, dissector)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(address, strconv.Itoa(port))
+	extcap.Log().Infof("Listen on %s/%s, messages are passed to '%s'", addr, protocol, dissector)
+
+	switch protocol {
+	case ProtocolUDP:
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return err
+		}
+		return serveUDP(conn, w)
+	case ProtocolTCP:
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		return serveTCP(l, w, framing)
+	}
+	return fmt.Errorf("Unknown protocol '%s'", protocol)
+}
+
+// pduWriter writes messages as exported PDUs. It is safe for concurrent use.
+type pduWriter struct {
+	mu        sync.Mutex
+	w         *pcapgo.Writer
+	dissector string
+}
+
+func newPDUWriter(fifo io.Writer, dissector string) (*pduWriter, error) {
+	w := pcapgo.NewWriterNanos(fifo)
+	if err := w.WriteFileHeader(maxMessageSize+1024, extcap.LinkTypeUpperPDU); err != nil {
+		return nil, err
+	}
+	return &pduWriter{w: w, dissector: dissector}, nil
+}
+
+func (p *pduWriter) write(flow *extcap.Flow, msg []byte) error {
+	data := extcap.ExportPDU(p.dissector, flow, msg)
+	ci := gopacket.CaptureInfo{
+		Timestamp:     time.Now(),
+		CaptureLength: len(data),
+		Length:        len(data),
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.w.WritePacket(ci, data)
+}
+
+// newFlow returns flow for given protocol and addresses
+func newFlow(protocol layers.IPProtocol, src, dst net.Addr) *extcap.Flow {
+	flow := &extcap.Flow{Protocol: protocol}
+	switch src := src.(type) {
+	case *net.UDPAddr:
+		flow.SrcIP, flow.SrcPort = src.IP, uint16(src.Port)
+	case *net.TCPAddr:
+		flow.SrcIP, flow.SrcPort = src.IP, uint16(src.Port)
+	}
+	switch dst := dst.(type) {
+	case *net.UDPAddr:
+		flow.DstIP, flow.DstPort = dst.IP, uint16(dst.Port)
+	case *net.TCPAddr:
+		flow.DstIP, flow.DstPort = dst.IP, uint16(dst.Port)
+	}
+	return flow
+}
+
+// serveUDP writes every received datagram until writing to the FIFO fails
+func serveUDP(conn net.PacketConn, w *pduWriter) error {
+	defer conn.Close()
+
+	readFrom := newDatagramReader(conn)
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, peer, local, err := readFrom(buf)
+		if err != nil {
+			return err
+		}
+		if err = w.write(newFlow(layers.IPProtocolUDP, peer, local), buf[:n]); err != nil {
+			return err
+		}
+	}
+}
+
+// datagramReader reads datagram and returns its source and destination addresses
+type datagramReader func(buf []byte) (n int, src, dst net.Addr, err error)
+
+// newDatagramReader returns reader of the connection. When it listens on wildcard address,
+// real destination address of datagram is taken from IP_PKTINFO control message.
+// If control messages are not supported, destination is local address of the connection.
+func newDatagramReader(conn net.PacketConn) datagramReader {
+	local := conn.LocalAddr()
+	readLocal := func(buf []byte) (int, net.Addr, net.Addr, error) {
+		n, src, err := conn.ReadFrom(buf)
+		return n, src, local, err
+	}
+
+	addr, ok := local.(*net.UDPAddr)
+	if !ok || !addr.IP.IsUnspecified() {
+		return readLocal
+	}
+	dst := func(ip net.IP) net.Addr {
+		if ip == nil {
+			return local
+		}
+		return &net.UDPAddr{IP: ip, Port: addr.Port}
+	}
+
+	// local address of dual-stack socket listening on 0.0.0.0 is [::]
+	var err error
+	if addr.IP.To4() != nil {
+		p := ipv4.NewPacketConn(conn)
+		if err = p.SetControlMessage(ipv4.FlagDst, true); err == nil {
+			return func(buf []byte) (int, net.Addr, net.Addr, error) {
+				n, cm, src, err := p.ReadFrom(buf)
+				if cm == nil {
+					return n, src, local, err
+				}
+				return n, src, dst(cm.Dst), err
+			}
+		}
+	} else {
+		p := ipv6.NewPacketConn(conn)
+		if err = p.SetControlMessage(ipv6.FlagDst, true); err == nil {
+			return func(buf []byte) (int, net.Addr, net.Addr, error) {
+				n, cm, src, err := p.ReadFrom(buf)
+				if cm == nil {
+					return n, src, local, err
+				}
+				return n, src, dst(cm.Dst), err
+			}
+		}
+	}
+	extcap.Log().Warnf("Destination address of datagrams is unknown, %s is used: %s", local, err)
+	return readLocal
+}
+
+// serveTCP accepts connections and writes their messages until writing to the FIFO fails.
+// Then the listener and all open connections are closed, so their readers are finished.
+func serveTCP(l net.Listener, w *pduWriter, framing string) error {
+	var readMessage func(*bufio.Reader) ([]byte, error)
+	switch framing {
+	case FramingLine:
+		readMessage = readLine
+	case FramingOctetCount:
+		readMessage = readOctetCounted
+	default:
+		l.Close()
+		return fmt.Errorf("Unknown framing '%s'", framing)
+	}
+
+	var (
+		mu       sync.Mutex
+		stopped  bool
+		writeErr error
+		conns    = make(map[net.Conn]struct{})
+	)
+	stop := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if stopped {
+			return
+		}
+		stopped, writeErr = true, err
+		l.Close()
+		for conn := range conns {
+			conn.Close()
+		}
+	}
+	// track returns false if serving is stopped
+	track := func(conn net.Conn) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if !stopped {
+			conns[conn] = struct{}{}
+		}
+		return !stopped
+	}
+	untrack := func(conn net.Conn) {
+		mu.Lock()
+		delete(conns, conn)
+		mu.Unlock()
+		conn.Close()
+	}
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			stop(err)
+			mu.Lock()
+			defer mu.Unlock()
+			return writeErr
+		}
+		if !track(conn) {
+			conn.Close()
+			continue
+		}
+
+		go func() {
+			defer untrack(conn)
+
+			peer := conn.RemoteAddr().String()
+			extcap.Log().Debugf("Connection from %s", peer)
+			flow := newFlow(layers.IPProtocolTCP, conn.RemoteAddr(), conn.LocalAddr())
+			r := bufio.NewReaderSize(conn, maxMessageSize)
+			for {
+				msg, err := readMessage(r)
+				if err != nil {
+					if err != io.EOF {
+						extcap.Log().Warnf("Connection from %s: %s", peer, err)
+					}
+					return
+				}
+				if err = w.write(flow, msg); err != nil {
+					stop(err)
+					return
+				}
+			}
+		}()
+	}
+}
+
+// readLine returns message terminated by newline, trailing CR LF is removed
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for len(line) > 0 && (line[len(line)-1] == '\n' || line[len(line)-1] == '\r') {
+		line = line[:len(line)-1]
+	}
+	return line, nil
+}
+
+// readOctetCounted returns message framed as "MSG-LEN SP SYSLOG-MSG" (RFC 6587)
+func readOctetCounted(r *bufio.Reader) ([]byte, error) {
+	prefix, err := r.ReadString(' ')
+	if err != nil {
+		if err == io.EOF && prefix != "" {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	size, err := strconv.Atoi(prefix[:len(prefix)-1])
+	if err != nil || size <= 0 || size > maxMessageSize {
+		return nil, errors.New("Invalid message length")
+	}
+
+	msg := make([]byte, size)
+	if _, err = io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
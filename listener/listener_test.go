@@ -0,0 +1,159 @@
+package listener
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kor44/extcap"
+)
+
+// syncBuffer collects capture, writes fail after limit of packets is reached
+type syncBuffer struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	writes int
+	limit  int
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.writes >= b.limit {
+		return 0, io.ErrClosedPipe
+	}
+	b.writes++
+	return b.buf.Write(p)
+}
+
+func readMessages(t *testing.T, data []byte) [][]byte {
+	r, err := pcapgo.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, extcap.LinkTypeUpperPDU, r.LinkType())
+
+	var msgs [][]byte
+	for {
+		data, _, err := r.ReadPacketData()
+		if err != nil {
+			return msgs
+		}
+		msgs = append(msgs, data)
+	}
+}
+
+func TestServeUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	// file header, then two packets (header and data each)
+	out := &syncBuffer{limit: 5}
+	w, err := newPDUWriter(out, "syslog")
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() { done <- serveUDP(conn, w) }()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	for _, msg := range []string{"<13>first", "<13>second", "<13>third"} {
+		_, err = client.Write([]byte(msg))
+		require.NoError(t, err)
+	}
+
+	select {
+	case err = <-done:
+		assert.ErrorContains(t, err, io.ErrClosedPipe.Error())
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener doesn't stop")
+	}
+
+	msgs := readMessages(t, out.buf.Bytes())
+	require.Len(t, msgs, 2)
+	flow := newFlow(layers.IPProtocolUDP, client.LocalAddr(), conn.LocalAddr())
+	assert.Equal(t, extcap.ExportPDU("syslog", flow, []byte("<13>first")), msgs[0])
+}
+
+func TestDatagramReader(t *testing.T) {
+	for _, address := range []string{"0.0.0.0:0", "127.0.0.1:0"} {
+		conn, err := net.ListenPacket("udp", address)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		// destination is address of the datagram, not wildcard address
+		port := conn.LocalAddr().(*net.UDPAddr).Port
+		client, err := net.Dial("udp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		require.NoError(t, err)
+		defer client.Close()
+		_, err = client.Write([]byte("<13>first"))
+		require.NoError(t, err)
+
+		buf := make([]byte, maxMessageSize)
+		n, src, dst, err := newDatagramReader(conn)(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "<13>first", string(buf[:n]), address)
+		assert.True(t, src.(*net.UDPAddr).IP.Equal(client.LocalAddr().(*net.UDPAddr).IP), address)
+		assert.True(t, dst.(*net.UDPAddr).IP.Equal(net.IPv4(127, 0, 0, 1)), address)
+		assert.Equal(t, port, dst.(*net.UDPAddr).Port, address)
+	}
+}
+
+func TestServeTCP(t *testing.T) {
+	tests := []struct {
+		framing string
+		stream  string
+	}{
+		{FramingLine, "<13>first\r\n<13>second\n<13>third\n"},
+		{FramingOctetCount, "9 <13>first10 <13>second9 <13>third"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.framing, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+
+			out := &syncBuffer{limit: 5}
+			w, err := newPDUWriter(out, "syslog")
+			require.NoError(t, err)
+
+			done := make(chan error)
+			go func() { done <- serveTCP(l, w, tt.framing) }()
+
+			// idle connection is accepted first and closed when writing fails
+			idle, err := net.Dial("tcp", l.Addr().String())
+			require.NoError(t, err)
+			defer idle.Close()
+
+			client, err := net.Dial("tcp", l.Addr().String())
+			require.NoError(t, err)
+			defer client.Close()
+			_, err = client.Write([]byte(tt.stream))
+			require.NoError(t, err)
+
+			select {
+			case err = <-done:
+				assert.ErrorContains(t, err, io.ErrClosedPipe.Error())
+			case <-time.After(5 * time.Second):
+				t.Fatal("listener doesn't stop")
+			}
+
+			require.NoError(t, idle.SetReadDeadline(time.Now().Add(5*time.Second)))
+			_, err = idle.Read(make([]byte, 1))
+			assert.Equal(t, io.EOF, err)
+
+			msgs := readMessages(t, out.buf.Bytes())
+			require.Len(t, msgs, 2)
+			assert.True(t, bytes.HasSuffix(msgs[0], []byte("\x00\x00\x00\x00<13>first")))
+			assert.True(t, bytes.HasSuffix(msgs[1], []byte("\x00\x00\x00\x00<13>second")))
+		})
+	}
+}
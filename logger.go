@@ -0,0 +1,128 @@
+package extcap
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel is severity of log message
+type LogLevel int
+
+// Log levels
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarning
+	LevelError
+)
+
+var levelNames = [...]string{"DEBUG", "INFO", "WARNING", "ERROR"}
+
+// String implements fmt.Stringer interface
+func (l LogLevel) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("LEVEL(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// Logger writes leveled messages to the debug file and, if asked, to stderr.
+// Each line contains timestamp and mode in which application was invoked, e.g.
+//
+//	2023-08-01 12:00:00.000 [capture] DEBUG: message
+//
+// Logger is safe for concurrent use. Until application is started all messages are discarded.
+type Logger struct {
+	mu      sync.Mutex
+	level   LogLevel
+	mode    string
+	outputs []io.Writer
+	secrets []string
+}
+
+var logger = &Logger{level: LevelInfo}
+
+// Log returns logger of the application. It can be used in any hook
+// (GetInterfaces, GetDLT, StartCapture and others).
+func Log() *Logger {
+	return logger
+}
+
+// configure sets minimal level and outputs of the logger
+func (l *Logger) configure(level LogLevel, mode string, outputs ...io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.level = level
+	l.mode = mode
+	l.outputs = outputs
+}
+
+// Enabled reports if messages of given level are written
+func (l *Logger) Enabled(level LogLevel) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return level >= l.level && len(l.outputs) > 0
+}
+
+// Debugf writes message for debugging
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.logf(LevelDebug, format, args...)
+}
+
+// Infof writes informational message
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.logf(LevelInfo, format, args...)
+}
+
+// Warnf writes warning
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.logf(LevelWarning, format, args...)
+}
+
+// Errorf writes error message
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.logf(LevelError, format, args...)
+}
+
+func (l *Logger) logf(level LogLevel, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if level < l.level || len(l.outputs) == 0 {
+		return
+	}
+
+	msg := l.redactLocked(strings.TrimRight(fmt.Sprintf(format, args...), "\n"))
+	line := fmt.Sprintf("%s [%s] %s: %s\n", time.Now().Format("2006-01-02 15:04:05.000"), l.mode, level, msg)
+	for _, w := range l.outputs {
+		io.WriteString(w, line)
+	}
+}
+
+// addSecret adds value which is hidden in messages
+func (l *Logger) addSecret(secret string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.secrets = append(l.secrets, secret)
+}
+
+// redact replaces secrets in the text
+func (l *Logger) redact(text string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.redactLocked(text)
+}
+
+func (l *Logger) redactLocked(text string) string {
+	for _, secret := range l.secrets {
+		text = strings.ReplaceAll(text, secret, "********")
+	}
+	return text
+}
@@ -0,0 +1,88 @@
+package extcap
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestLogger(t *testing.T) {
+	l := &Logger{}
+	buf := new(bytes.Buffer)
+
+	// messages are discarded until outputs are set
+	l.Errorf("discarded")
+	assert.False(t, l.Enabled(LevelError))
+
+	l.configure(LevelInfo, "capture", buf)
+	l.addSecret("s3cret")
+	assert.False(t, l.Enabled(LevelDebug))
+	assert.True(t, l.Enabled(LevelInfo))
+
+	l.Debugf("hidden")
+	l.Infof("started on %s", "eth0")
+	l.Warnf("password s3cret\n")
+	l.Errorf("failed")
+
+	line := `^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d{3} \[capture\] `
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 3)
+	assert.Regexp(t, line+`INFO: started on eth0$`, lines[0])
+	assert.Regexp(t, line+`WARNING: password \*\*\*\*\*\*\*\*$`, lines[1])
+	assert.Regexp(t, line+`ERROR: failed$`, lines[2])
+
+	assert.Equal(t, "DEBUG", LevelDebug.String())
+	assert.Equal(t, "LEVEL(7)", LogLevel(7).String())
+}
+
+func TestSetupLogger(t *testing.T) {
+	defer logger.configure(LevelInfo, "")
+
+	debugFile := filepath.Join(t.TempDir(), "debug.log")
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.BoolFlag{Name: "capture"},
+			&cli.BoolFlag{Name: "debug"},
+			&cli.StringFlag{Name: "debug-file"},
+			&cli.BoolFlag{Name: "debug-stderr"},
+		},
+		Action: func(ctx *cli.Context) error {
+			closeLog, err := setupLogger(ctx)
+			if err != nil {
+				return err
+			}
+			defer closeLog()
+			Log().Debugf("debug message")
+			return nil
+		},
+	}
+	require.NoError(t, app.Run([]string{"test", "--capture", "--debug", "--debug-file", debugFile, "--debug-stderr"}))
+	w.Close()
+
+	// the same line is written to the debug file and stderr
+	printed, err := io.ReadAll(r)
+	require.NoError(t, err)
+	written, err := os.ReadFile(debugFile)
+	require.NoError(t, err)
+	assert.Regexp(t, `^\S+ \S+ \[capture\] DEBUG: debug message\n$`, string(written))
+	assert.Equal(t, string(written), string(printed))
+
+	// without --debug only info and higher levels are written
+	require.NoError(t, app.Run([]string{"test", "--debug-file", debugFile}))
+	written, err = os.ReadFile(debugFile)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(written), "\n"))
+}
@@ -0,0 +1,184 @@
+package extcap
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/urfave/cli/v2"
+)
+
+// PacketFunc processes single packet on its way to the FIFO. To drop packet it returns nil data.
+// To stop the capture it returns ErrCaptureStopped, data returned with it is the last packet.
+type PacketFunc func(ci *gopacket.CaptureInfo, data []byte) ([]byte, error)
+
+// Middleware is stage of packet processing between StartCapture and the FIFO.
+// Middlewares are set in App.Middlewares, their options are added to config of every interface.
+type Middleware interface {
+	// Options returns config options of the middleware
+	Options() []ConfigOption
+
+	// New returns PacketFunc for the capture with given link type. opts contains values
+	// of the middleware options. nil PacketFunc means middleware is disabled by options.
+	New(linkType layers.LinkType, opts map[string]interface{}) (PacketFunc, error)
+}
+
+// MiddlewareFunc is adapter to use ordinary function as Middleware without options
+type MiddlewareFunc func(linkType layers.LinkType, opts map[string]interface{}) (PacketFunc, error)
+
+// Options implements Middleware interface
+func (f MiddlewareFunc) Options() []ConfigOption {
+	return nil
+}
+
+// New implements Middleware interface
+func (f MiddlewareFunc) New(linkType layers.LinkType, opts map[string]interface{}) (PacketFunc, error) {
+	return f(linkType, opts)
+}
+
+// Options of built-in middlewares. Zero value of the option disables the middleware.
+var (
+	SnapLength = NewConfigIntegerOpt("snaplen", "Snapshot length").
+			Range(0, math.MaxInt32).Default(0).Group("Processing").Tooltip("Packets are truncated to this number of bytes, 0 is unlimited")
+	DedupWindow = NewConfigIntegerOpt("dedup-window", "Remove duplicates among packets").
+			Range(0, 65535).Default(0).Group("Processing").Tooltip("Packet is dropped when it is identical to one of this number of previous packets, 0 disables deduplication")
+	TimeShift = NewConfigDoubleOpt("time-shift", "Time shift (s)").
+			Range(-1e9, 1e9).Default(0).Group("Processing").Tooltip("Seconds added to timestamps of packets to correct clock of the source")
+	PayloadLength = NewConfigIntegerOpt("payload-length", "Payload length").
+			Range(0, math.MaxInt32).Default(0).Group("Processing").Tooltip("Payload of packets is truncated to this number of bytes keeping protocol headers, 0 is unlimited")
+)
+
+// Built-in middlewares
+var (
+	// Truncate cuts packets to SnapLength bytes
+	Truncate Middleware = &optionMiddleware{SnapLength, truncate}
+
+	// Deduplicate drops packets identical to one of DedupWindow previous packets
+	Deduplicate Middleware = &optionMiddleware{DedupWindow, deduplicate}
+
+	// ShiftTime adds TimeShift seconds to timestamps of packets
+	ShiftTime Middleware = &optionMiddleware{TimeShift, shiftTime}
+
+	// SlicePayload cuts application payload of packets to PayloadLength bytes
+	SlicePayload Middleware = &optionMiddleware{PayloadLength, slicePayload}
+)
+
+// optionMiddleware is middleware controlled by single option
+type optionMiddleware struct {
+	opt ConfigOption
+	new func(linkType layers.LinkType, value interface{}) PacketFunc
+}
+
+func (m *optionMiddleware) Options() []ConfigOption {
+	return []ConfigOption{m.opt}
+}
+
+func (m *optionMiddleware) New(linkType layers.LinkType, opts map[string]interface{}) (PacketFunc, error) {
+	value := opts[m.opt.call()]
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case int:
+		if v == 0 {
+			return nil, nil
+		}
+	case float64:
+		if v == 0 {
+			return nil, nil
+		}
+	}
+	return m.new(linkType, value), nil
+}
+
+func truncate(linkType layers.LinkType, value interface{}) PacketFunc {
+	snaplen := value.(int)
+	return func(ci *gopacket.CaptureInfo, data []byte) ([]byte, error) {
+		if len(data) > snaplen {
+			data = data[:snaplen]
+			ci.CaptureLength = snaplen
+		}
+		return data, nil
+	}
+}
+
+func deduplicate(linkType layers.LinkType, value interface{}) PacketFunc {
+	window := make([]uint64, 0, value.(int))
+	next := 0
+	return func(ci *gopacket.CaptureInfo, data []byte) ([]byte, error) {
+		h := fnv.New64a()
+		var length [4]byte
+		binary.BigEndian.PutUint32(length[:], uint32(ci.Length))
+		h.Write(length[:])
+		h.Write(data)
+		sum := h.Sum64()
+
+		for _, s := range window {
+			if s == sum {
+				return nil, nil
+			}
+		}
+		if len(window) < cap(window) {
+			window = append(window, sum)
+		} else {
+			window[next] = sum
+			next = (next + 1) % len(window)
+		}
+		return data, nil
+	}
+}
+
+func shiftTime(linkType layers.LinkType, value interface{}) PacketFunc {
+	shift := time.Duration(value.(float64) * float64(time.Second))
+	return func(ci *gopacket.CaptureInfo, data []byte) ([]byte, error) {
+		ci.Timestamp = ci.Timestamp.Add(shift)
+		return data, nil
+	}
+}
+
+// slicePayload keeps headers of all layers, so length fields of the headers
+// refer to original length as for packets truncated by snapshot length
+func slicePayload(linkType layers.LinkType, value interface{}) PacketFunc {
+	length := value.(int)
+	return func(ci *gopacket.CaptureInfo, data []byte) ([]byte, error) {
+		packet := gopacket.NewPacket(data, linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+		app := packet.ApplicationLayer()
+		if app == nil {
+			return data, nil
+		}
+		payload := app.Payload()
+		if len(payload) <= length {
+			return data, nil
+		}
+		// payload shares memory with data, so offset of the payload is difference of capacities
+		end := cap(data) - cap(payload) + length
+		if end <= 0 || end > len(data) {
+			return data, nil
+		}
+		data = data[:end]
+		ci.CaptureLength = end
+		return data, nil
+	}
+}
+
+// middlewareOptions returns options of all middlewares
+func middlewareOptions(middlewares []Middleware) []ConfigOption {
+	var opts []ConfigOption
+	for _, m := range middlewares {
+		opts = append(opts, m.Options()...)
+	}
+	return opts
+}
+
+// middlewareStage creates stage of the middleware with values of its options set in the context
+func middlewareStage(ctx *cli.Context, m Middleware) stageFunc {
+	opts := make(map[string]interface{})
+	for _, opt := range m.Options() {
+		opts[opt.call()] = ctx.Value(opt.call())
+	}
+	return func(info streamInfo) (PacketFunc, error) {
+		return m.New(info.linkType, opts)
+	}
+}
@@ -0,0 +1,95 @@
+package extcap
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewares(t *testing.T) {
+	b, err := NewPacketBuilder(layers.LinkTypeEthernet)
+	require.NoError(t, err)
+	flow := Flow{layers.IPProtocolUDP, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 5000, 514}
+	frame := func(payload string) []byte {
+		data, err := b.Build(flow, []byte(payload))
+		require.NoError(t, err)
+		return data
+	}
+	start := time.Unix(1700000000, 0)
+	a, c := frame("a"), frame("c")
+
+	testCases := []struct {
+		name       string
+		middleware Middleware
+		value      interface{}
+		packets    [][]byte
+		expected   []int // lengths of passed packets
+		check      func(t *testing.T, ci gopacket.CaptureInfo, data []byte)
+	}{
+		{
+			name: "truncate", middleware: Truncate, value: 20,
+			packets: [][]byte{frame("hello"), {1, 2, 3}}, expected: []int{20, 3},
+		},
+		{
+			name: "deduplicate", middleware: Deduplicate, value: 2,
+			packets:  [][]byte{a, a, frame("b"), c, a, c},
+			expected: []int{60, 60, 60, 60},
+		},
+		{
+			name: "shift time", middleware: ShiftTime, value: -1.5,
+			packets: [][]byte{frame("a")}, expected: []int{60},
+			check: func(t *testing.T, ci gopacket.CaptureInfo, data []byte) {
+				assert.Equal(t, start.Add(-1500*time.Millisecond), ci.Timestamp)
+			},
+		},
+		{
+			name: "slice payload", middleware: SlicePayload, value: 4,
+			packets: [][]byte{frame("hello world, this is a long payload")}, expected: []int{14 + 20 + 8 + 4},
+			check: func(t *testing.T, ci gopacket.CaptureInfo, data []byte) {
+				packet := gopacket.NewPacket(data, layers.LinkTypeEthernet, gopacket.Default)
+				udp := packet.Layer(layers.LayerTypeUDP).(*layers.UDP)
+				assert.Equal(t, []byte("hell"), udp.Payload)
+				assert.Equal(t, 14+20+8+35, ci.Length)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := map[string]interface{}{tc.middleware.Options()[0].call(): tc.value}
+			f, err := tc.middleware.New(layers.LinkTypeEthernet, opts)
+			require.NoError(t, err)
+
+			var lengths []int
+			for _, p := range tc.packets {
+				ci := gopacket.CaptureInfo{Timestamp: start, CaptureLength: len(p), Length: len(p)}
+				data, err := f(&ci, p)
+				require.NoError(t, err)
+				if data == nil {
+					continue
+				}
+				assert.Equal(t, len(data), ci.CaptureLength)
+				lengths = append(lengths, len(data))
+				if tc.check != nil {
+					tc.check(t, ci, data)
+				}
+			}
+			assert.Equal(t, tc.expected, lengths)
+
+			// zero value disables middleware
+			if _, ok := tc.value.(float64); ok {
+				opts[tc.middleware.Options()[0].call()] = 0.0
+			} else {
+				opts[tc.middleware.Options()[0].call()] = 0
+			}
+			f, err = tc.middleware.New(layers.LinkTypeEthernet, opts)
+			require.NoError(t, err)
+			assert.Nil(t, f)
+		})
+	}
+}
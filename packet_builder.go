@@ -0,0 +1,200 @@
+package extcap
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"sync"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// ErrAddressFamily is returned by PacketBuilder when flow addresses can't be encoded
+var ErrAddressFamily = errors.New("Source and destination addresses are from different families")
+
+// Flow is 5-tuple of synthetic packet
+type Flow struct {
+	Protocol layers.IPProtocol // layers.IPProtocolTCP or layers.IPProtocolUDP
+	SrcIP    net.IP
+	DstIP    net.IP
+	SrcPort  uint16
+	DstPort  uint16
+}
+
+// Reverse returns flow of the opposite direction
+func (f Flow) Reverse() Flow {
+	return Flow{
+		Protocol: f.Protocol,
+		SrcIP:    f.DstIP,
+		DstIP:    f.SrcIP,
+		SrcPort:  f.DstPort,
+		DstPort:  f.SrcPort,
+	}
+}
+
+func (f Flow) key() string {
+	return fmt.Sprintf("%d/%s:%d/%s:%d", f.Protocol, f.SrcIP, f.SrcPort, f.DstIP, f.DstPort)
+}
+
+// PacketBuilder wraps payload into synthetic Ethernet/IPv4/IPv6/UDP/TCP headers.
+// It is used by sources which get only payload (e.g. from device exports), so
+// regular Wireshark dissectors can be applied to it.
+// For TCP, sequence and acknowledgment numbers are tracked per flow, so Wireshark
+// is able to reassemble stream. PacketBuilder is safe for concurrent use.
+type PacketBuilder struct {
+	linkType layers.LinkType
+	srcMAC   net.HardwareAddr
+	dstMAC   net.HardwareAddr
+
+	mu   sync.Mutex
+	seq  map[string]uint32
+	ipID uint16
+}
+
+// NewPacketBuilder creates builder which produces frames of given link type.
+// Supported link types are Ethernet, Raw, IPv4 and IPv6.
+func NewPacketBuilder(linkType layers.LinkType) (*PacketBuilder, error) {
+	switch linkType {
+	case layers.LinkTypeEthernet, layers.LinkTypeRaw, layers.LinkTypeIPv4, layers.LinkTypeIPv6:
+	default:
+		return nil, fmt.Errorf("Packet builder doesn't support link type %s", linkType)
+	}
+
+	return &PacketBuilder{
+		linkType: linkType,
+		srcMAC:   net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01},
+		dstMAC:   net.HardwareAddr{0x02, 0, 0, 0, 0, 0x02},
+		seq:      make(map[string]uint32),
+	}, nil
+}
+
+// MACs sets source and destination MAC addresses of Ethernet header.
+// By default locally administered addresses 02:00:00:00:00:01 and 02:00:00:00:00:02 are used.
+func (b *PacketBuilder) MACs(src, dst net.HardwareAddr) *PacketBuilder {
+	b.srcMAC = src
+	b.dstMAC = dst
+	return b
+}
+
+// LinkType returns link type of produced frames
+func (b *PacketBuilder) LinkType() layers.LinkType {
+	return b.linkType
+}
+
+// DLT returns DLT of produced frames
+func (b *PacketBuilder) DLT() DLT {
+	return DLTFromLinkType(b.linkType)
+}
+
+// Build returns frame with given payload. Checksums and lengths of all headers are calculated.
+func (b *PacketBuilder) Build(flow Flow, payload []byte) ([]byte, error) {
+	src4, dst4 := flow.SrcIP.To4(), flow.DstIP.To4()
+	if (src4 == nil) != (dst4 == nil) {
+		return nil, ErrAddressFamily
+	}
+	isIPv4 := src4 != nil
+
+	if (b.linkType == layers.LinkTypeIPv4 && !isIPv4) || (b.linkType == layers.LinkTypeIPv6 && isIPv4) {
+		return nil, fmt.Errorf("Flow %s can't be encoded with link type %s", flow.key(), b.linkType)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var (
+		all      []gopacket.SerializableLayer
+		netLayer gopacket.NetworkLayer
+	)
+
+	if isIPv4 {
+		b.ipID++
+		ip := &layers.IPv4{
+			Version:  4,
+			TTL:      64,
+			Id:       b.ipID,
+			Flags:    layers.IPv4DontFragment,
+			Protocol: flow.Protocol,
+			SrcIP:    src4,
+			DstIP:    dst4,
+		}
+		netLayer = ip
+		all = append(all, ip)
+	} else {
+		ip := &layers.IPv6{
+			Version:    6,
+			HopLimit:   64,
+			NextHeader: flow.Protocol,
+			SrcIP:      flow.SrcIP.To16(),
+			DstIP:      flow.DstIP.To16(),
+		}
+		netLayer = ip
+		all = append(all, ip)
+	}
+
+	if b.linkType == layers.LinkTypeEthernet {
+		eth := &layers.Ethernet{
+			SrcMAC:       b.srcMAC,
+			DstMAC:       b.dstMAC,
+			EthernetType: layers.EthernetTypeIPv4,
+		}
+		if !isIPv4 {
+			eth.EthernetType = layers.EthernetTypeIPv6
+		}
+		all = append([]gopacket.SerializableLayer{eth}, all...)
+	}
+
+	switch flow.Protocol {
+	case layers.IPProtocolUDP:
+		udp := &layers.UDP{
+			SrcPort: layers.UDPPort(flow.SrcPort),
+			DstPort: layers.UDPPort(flow.DstPort),
+		}
+		udp.SetNetworkLayerForChecksum(netLayer)
+		all = append(all, udp)
+	case layers.IPProtocolTCP:
+		tcp := &layers.TCP{
+			SrcPort: layers.TCPPort(flow.SrcPort),
+			DstPort: layers.TCPPort(flow.DstPort),
+			Seq:     b.nextSeq(flow, len(payload)),
+			Ack:     b.currentSeq(flow.Reverse()),
+			ACK:     true,
+			PSH:     len(payload) > 0,
+			Window:  65535,
+		}
+		tcp.SetNetworkLayerForChecksum(netLayer)
+		all = append(all, tcp)
+	default:
+		return nil, fmt.Errorf("Unsupported protocol %s", flow.Protocol)
+	}
+
+	all = append(all, gopacket.Payload(payload))
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, all...); err != nil {
+		return nil, fmt.Errorf("Unable to build packet: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// currentSeq returns next sequence number of the flow. Initial sequence number
+// is derived from the flow, so it is the same in all runs.
+func (b *PacketBuilder) currentSeq(flow Flow) uint32 {
+	key := flow.key()
+	seq, ok := b.seq[key]
+	if !ok {
+		seq = crc32.ChecksumIEEE([]byte(key))
+		b.seq[key] = seq
+	}
+	return seq
+}
+
+// nextSeq returns sequence number for segment of given length and advances it
+func (b *PacketBuilder) nextSeq(flow Flow, length int) uint32 {
+	seq := b.currentSeq(flow)
+	b.seq[flow.key()] = seq + uint32(length)
+	return seq
+}
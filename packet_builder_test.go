@@ -0,0 +1,111 @@
+package extcap
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reserialize decodes frame and serializes it again with calculated checksums,
+// so result is equal to frame only if checksums of frame are correct
+func reserialize(t *testing.T, linkType layers.LinkType, frame []byte) []byte {
+	packet := gopacket.NewPacket(frame, linkType, gopacket.Default)
+	require.Nil(t, packet.ErrorLayer())
+
+	var all []gopacket.SerializableLayer
+	for _, l := range packet.Layers() {
+		if sl, ok := l.(gopacket.SerializableLayer); ok {
+			all = append(all, sl)
+		}
+		if tl, ok := l.(interface {
+			SetNetworkLayerForChecksum(gopacket.NetworkLayer) error
+		}); ok {
+			tl.SetNetworkLayerForChecksum(packet.NetworkLayer())
+		}
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{ComputeChecksums: true}, all...)
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+func TestPacketBuilder(t *testing.T) {
+	testCases := []struct {
+		name     string
+		linkType layers.LinkType
+		flow     Flow
+	}{
+		{"Ethernet IPv4 UDP", layers.LinkTypeEthernet,
+			Flow{layers.IPProtocolUDP, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 514, 514}},
+		{"Ethernet IPv6 TCP", layers.LinkTypeEthernet,
+			Flow{layers.IPProtocolTCP, net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"), 40000, 80}},
+		{"Raw IPv4 TCP", layers.LinkTypeRaw,
+			Flow{layers.IPProtocolTCP, net.ParseIP("192.168.1.1"), net.ParseIP("192.168.1.2"), 40000, 80}},
+		{"IPv6 UDP", layers.LinkTypeIPv6,
+			Flow{layers.IPProtocolUDP, net.ParseIP("::1"), net.ParseIP("::2"), 5000, 5001}},
+	}
+
+	payload := []byte("synthetic payload")
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := NewPacketBuilder(tc.linkType)
+			require.NoError(t, err)
+			frame, err := b.Build(tc.flow, payload)
+			require.NoError(t, err)
+
+			decodeAs := tc.linkType
+			if decodeAs == layers.LinkTypeIPv6 {
+				decodeAs = layers.LinkTypeRaw
+			}
+			assert.Equal(t, reserialize(t, decodeAs, frame), frame)
+
+			packet := gopacket.NewPacket(frame, decodeAs, gopacket.Default)
+			require.NotNil(t, packet.ApplicationLayer())
+			assert.Equal(t, payload, packet.ApplicationLayer().Payload())
+		})
+	}
+}
+
+func TestPacketBuilderTCPSequence(t *testing.T) {
+	b, err := NewPacketBuilder(layers.LinkTypeEthernet)
+	require.NoError(t, err)
+	flow := Flow{layers.IPProtocolTCP, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 40000, 80}
+
+	tcpOf := func(frame []byte) *layers.TCP {
+		packet := gopacket.NewPacket(frame, layers.LinkTypeEthernet, gopacket.Default)
+		return packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	}
+
+	first, err := b.Build(flow, []byte("hello "))
+	require.NoError(t, err)
+	second, err := b.Build(flow, []byte("world"))
+	require.NoError(t, err)
+	reply, err := b.Build(flow.Reverse(), []byte("ok"))
+	require.NoError(t, err)
+
+	assert.Equal(t, tcpOf(first).Seq+6, tcpOf(second).Seq)
+	assert.Equal(t, tcpOf(second).Seq+5, tcpOf(reply).Ack)
+	assert.Equal(t, tcpOf(reply).Seq, tcpOf(second).Ack)
+}
+
+func TestPacketBuilderAddressFamily(t *testing.T) {
+	b, err := NewPacketBuilder(layers.LinkTypeEthernet)
+	require.NoError(t, err)
+	_, err = b.Build(Flow{layers.IPProtocolUDP, net.ParseIP("10.0.0.1"), net.ParseIP("::1"), 1, 2}, nil)
+	assert.ErrorIs(t, err, ErrAddressFamily)
+
+	b, err = NewPacketBuilder(layers.LinkTypeIPv4)
+	require.NoError(t, err)
+	_, err = b.Build(Flow{layers.IPProtocolUDP, net.ParseIP("::1"), net.ParseIP("::2"), 1, 2}, nil)
+	assert.Error(t, err)
+}
+
+func TestPacketBuilderLinkType(t *testing.T) {
+	_, err := NewPacketBuilder(layers.LinkTypeLinuxSLL)
+	assert.ErrorContains(t, err, "doesn't support link type")
+}
@@ -0,0 +1,234 @@
+package extcap
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultPreset is used when file has several presets and none is chosen with --extcap-preset
+const defaultPreset = "default"
+
+// profile is file with named presets of option values. It is YAML or JSON mapping
+// preset names to values of options, e.g.
+//
+//	lab:
+//	  remote-host: 10.0.0.1
+//	  remote-port: 22
+//	  verbose: true
+//	production:
+//	  remote-host: 192.168.1.1
+type profile map[string]map[string]interface{}
+
+// readProfile reads profile from YAML or JSON file
+func readProfile(name string) (profile, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read profile: %w", err)
+	}
+
+	var p profile
+	if err = yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("Invalid profile '%s': %w", name, err)
+	}
+	return p, nil
+}
+
+// preset returns name and values of preset with given name. If name is empty,
+// the only preset of the profile or preset "default" is returned.
+func (p profile) preset(name string) (string, map[string]interface{}, error) {
+	if name == "" && len(p) == 1 {
+		for n, values := range p {
+			return n, values, nil
+		}
+	}
+	if name == "" {
+		name = defaultPreset
+	}
+
+	values, ok := p[name]
+	if !ok {
+		names := make([]string, 0, len(p))
+		for n := range p {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return "", nil, fmt.Errorf("Unknown preset '%s', profile has: %s", name, strings.Join(names, ", "))
+	}
+	return name, values, nil
+}
+
+// profileOptions returns all options which may be set in preset
+func (extapp *App) profileOptions() []ConfigOption {
+	var opts []ConfigOption
+	if extapp.GetAllConfigOptions != nil {
+		opts = extapp.GetAllConfigOptions()
+	}
+	return append(opts, extapp.libraryOptions()...)
+}
+
+// loadProfile sets options from preset of the profile. Every value is checked against
+// type and range of the option. Flags which are already set take precedence.
+func (extapp *App) loadProfile(ctx *cli.Context, name, preset string) error {
+	p, err := readProfile(name)
+	if err != nil {
+		return err
+	}
+	_, values, err := p.preset(preset)
+	if err != nil {
+		return err
+	}
+
+	opts := make(map[string]ConfigOption)
+	for _, opt := range extapp.profileOptions() {
+		opts[opt.call()] = opt
+	}
+
+	// check all values before any of them is used
+	flags := make(map[string]string, len(values))
+	for call, value := range values {
+		opt, ok := opts[call]
+		if !ok {
+			return fmt.Errorf("Unknown option '%s' in profile '%s'", call, name)
+		}
+		if flags[call], err = presetValue(opt, value); err != nil {
+			return fmt.Errorf("Invalid profile '%s': %w", name, err)
+		}
+	}
+
+	for call, value := range flags {
+		if ctx.IsSet(call) {
+			continue
+		}
+		if err = ctx.Set(call, value); err != nil {
+			return fmt.Errorf("Invalid value of option '%s' in profile '%s': %w", call, name, err)
+		}
+	}
+	return nil
+}
+
+// presetValue checks value of preset against the option and returns it as flag value
+func presetValue(opt ConfigOption, value interface{}) (string, error) {
+	typeErr := func(typeName string) error {
+		return fmt.Errorf("Option '%s' should be %s, got %v", opt.call(), typeName, value)
+	}
+
+	var flag string
+	switch opt := opt.(type) {
+	case *ConfigIntegerOpt:
+		v, ok := value.(int)
+		if !ok {
+			return "", typeErr("integer")
+		}
+		value, flag = v, strconv.Itoa(v)
+	case *ConfigDoubleOpt:
+		switch v := value.(type) {
+		case int:
+			value = float64(v)
+		case float64:
+		default:
+			return "", typeErr("number")
+		}
+		flag = strconv.FormatFloat(value.(float64), 'g', -1, 64)
+	case *ConfigBoolOpt:
+		v, ok := value.(bool)
+		if !ok {
+			return "", typeErr("boolean")
+		}
+		flag = strconv.FormatBool(v)
+	case *ConfigSelectorOpt:
+		v, ok := value.(string)
+		if !ok {
+			return "", typeErr("string")
+		}
+		if err := checkSelected(opt, v); err != nil {
+			return "", err
+		}
+		flag = v
+	default:
+		v, ok := value.(string)
+		if !ok {
+			return "", typeErr("string")
+		}
+		flag = v
+	}
+
+	if err := checkValue(opt, value); err != nil {
+		return "", err
+	}
+	return flag, nil
+}
+
+// checkSelected checks that selected value (comma separated for multicheck) is among
+// values of the option. Values of reloadable options are not known in advance.
+func checkSelected(opt *ConfigSelectorOpt, value string) error {
+	if opt.reload || len(opt.values) == 0 || value == "" {
+		return nil
+	}
+
+	selected := []string{value}
+	if opt.optType == "multicheck" {
+		selected = strings.Split(value, ",")
+	}
+	for _, s := range selected {
+		found := false
+		for _, v := range opt.values {
+			found = found || v.Value == s
+		}
+		if !found {
+			return fmt.Errorf("Value '%s' is not among values of option '%s'", s, opt.call())
+		}
+	}
+	return nil
+}
+
+// printProfile prints effective values of all options as preset. Passwords are not printed.
+func (extapp *App) printProfile(ctx *cli.Context) error {
+	values := &yaml.Node{Kind: yaml.MappingNode}
+	for _, opt := range extapp.profileOptions() {
+		if _, ok := opt.(*ConfigPasswordOpt); ok {
+			continue
+		}
+		value := ctx.Value(opt.call())
+		if value == nil {
+			continue
+		}
+
+		node := new(yaml.Node)
+		if err := node.Encode(value); err != nil {
+			return err
+		}
+		values.Content = append(values.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: opt.call()}, node)
+	}
+
+	// name of the preset loaded from profile
+	name := ctx.String("extcap-preset")
+	if file := ctx.String("extcap-profile"); file != "" {
+		p, err := readProfile(file)
+		if err != nil {
+			return err
+		}
+		if name, _, err = p.preset(name); err != nil {
+			return err
+		}
+	}
+	if name == "" {
+		name = defaultPreset
+	}
+	preset := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: name},
+		values,
+	}}
+
+	enc := yaml.NewEncoder(ctx.App.Writer)
+	enc.SetIndent(2)
+	if err := enc.Encode(preset); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,92 @@
+package extcap
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestProfile(t *testing.T) {
+	extapp := &App{
+		GetAllConfigOptions: func() []ConfigOption {
+			return []ConfigOption{
+				NewConfigStringOpt("remote-host", "Host"),
+				NewConfigIntegerOpt("remote-port", "Port").Range(1, 65535).Default(22),
+				NewConfigDoubleOpt("speed", "Speed").Range(0.1, 10).Default(1),
+				NewConfigBoolOpt("verbose", "Verbose"),
+				NewConfigMultiCheckOpt("channels", "Channels").Values(SelectorValue{Value: "a"}, SelectorValue{Value: "b"}),
+				NewConfigPasswordOpt("remote-password", "Password"),
+			}
+		},
+		StopConditions: true,
+	}
+
+	testCases := []struct {
+		name     string
+		profile  string
+		args     []string
+		expected string
+		err      string
+	}{
+		{
+			name:    "single preset",
+			profile: "lab:\n  remote-host: 10.0.0.1\n  speed: 2\n  verbose: true\n  channels: a,b\n  max-packets: 100\n",
+			expected: "lab:\n  remote-host: 10.0.0.1\n  remote-port: 22\n  speed: 2\n  verbose: true\n  channels: a,b\n" +
+				"  max-packets: 100\n  max-bytes: 0\n  max-duration: 0\n",
+		},
+		{
+			name:     "json with flags override",
+			profile:  `{"lab": {"remote-host": "10.0.0.1"}, "prod": {"remote-host": "192.168.1.1", "remote-port": 2222}}`,
+			args:     []string{"--extcap-preset", "prod", "--remote-port", "22222"},
+			expected: "prod:\n  remote-host: 192.168.1.1\n  remote-port: 22222\n",
+		},
+		{name: "unknown preset", profile: "lab: {}\nprod: {}\n", err: "Unknown preset 'default', profile has: lab, prod"},
+		{name: "unknown option", profile: "lab:\n  host: 10.0.0.1\n", err: "Unknown option 'host'"},
+		{name: "wrong type", profile: "lab:\n  remote-port: \"22\"\n", err: "Option 'remote-port' should be integer"},
+		{name: "out of range", profile: "lab:\n  speed: 20\n", err: "out of range"},
+		{name: "unknown value", profile: "lab:\n  channels: a,c\n", err: "Value 'c' is not among values"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "profile.yaml")
+			require.NoError(t, os.WriteFile(name, []byte(tc.profile), 0644))
+
+			flags := []cli.Flag{
+				&cli.StringFlag{Name: "extcap-profile"},
+				&cli.StringFlag{Name: "extcap-preset"},
+			}
+			for _, opt := range extapp.profileOptions() {
+				flag, _ := optionFlag(opt)
+				flags = append(flags, flag)
+			}
+
+			out := new(bytes.Buffer)
+			app := &cli.App{
+				Flags:  flags,
+				Writer: out,
+				Before: func(ctx *cli.Context) error {
+					return extapp.loadProfile(ctx, ctx.String("extcap-profile"), ctx.String("extcap-preset"))
+				},
+				Commands: []*cli.Command{{Name: "print-profile", Action: extapp.printProfile}},
+			}
+
+			args := append([]string{"test", "--extcap-profile", name}, tc.args...)
+			err := app.Run(append(args, "print-profile"))
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+
+			// output contains also defaults of other options
+			assert.Contains(t, out.String(), tc.expected)
+			assert.NotContains(t, out.String(), "remote-password")
+		})
+	}
+}
@@ -0,0 +1,263 @@
+/*
+Package replay implements capture source which plays saved pcap or pcapng file
+to Wireshark as if it were live capture.
+
+Every configured file is shown as separate interface, so its real DLT can be reported.
+Another file can be selected in the interface options. Packets are written with
+original inter-packet gaps divided by speed multiplier.
+
+Usage:
+
+	app := extcap.App{Usage: "replay"}
+	app.Register(replay.New("demo.pcapng"))
+	app.Run(os.Args)
+*/
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	"github.com/kor44/extcap"
+)
+
+// Values of Timestamps option
+const (
+	TimestampsOriginal = "original"
+	TimestampsNow      = "now"
+)
+
+// Define all options
+var (
+	File = extcap.NewConfigFileSelectOpt("replay-file", "Capture file").
+		MustExist(true).FileExt("Capture files (*.pcap *.pcapng *.cap)").Tooltip("File to replay")
+	Speed = extcap.NewConfigDoubleOpt("speed", "Speed").
+		Range(0, 1000).Default(1).Tooltip("Replay speed multiplier, 0 replays without delays")
+	Loop = extcap.NewConfigBoolOpt("loop", "Loop forever").
+		Tooltip("Start from the beginning when end of file is reached")
+	Timestamps = extcap.NewConfigRadioOpt("timestamps", "Timestamps").Values(
+		extcap.SelectorValue{Value: TimestampsOriginal, Display: "Keep original"},
+		extcap.SelectorValue{Value: TimestampsNow, Display: "Rewrite to current time"},
+	).Default(TimestampsOriginal)
+)
+
+var pcapngMagic = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+
+const (
+	defaultPrefix = "replay-"
+	snapLength    = 262144
+)
+
+// Source replays capture files
+type Source struct {
+	// Prefix is added to base name of the file to get interface name. Default is "replay-"
+	Prefix string
+
+	// Files are capture files shown as interfaces
+	Files []string
+}
+
+// New creates source for given capture files
+func New(files ...string) *Source {
+	return &Source{
+		Prefix: defaultPrefix,
+		Files:  files,
+	}
+}
+
+// Interfaces implements extcap.Source interface
+func (s *Source) Interfaces() ([]extcap.CaptureInterface, error) {
+	result := make([]extcap.CaptureInterface, 0, len(s.Files))
+	for _, file := range s.Files {
+		result = append(result, extcap.CaptureInterface{
+			Value:   s.Prefix + filepath.Base(file),
+			Display: "Replay: " + filepath.Base(file),
+		})
+	}
+	return result, nil
+}
+
+// DLT implements extcap.Source interface. Link type is read from the file header.
+func (s *Source) DLT(iface string) (extcap.DLT, error) {
+	path, err := s.file(iface)
+	if err != nil {
+		return extcap.DLT{}, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return extcap.DLT{}, err
+	}
+	defer f.Close()
+
+	r, err := newReader(f)
+	if err != nil {
+		return extcap.DLT{}, fmt.Errorf("Unable to read '%s': %w", path, err)
+	}
+	return extcap.DLTFromLinkType(r.LinkType()), nil
+}
+
+// ConfigOptions implements extcap.ConfigSource interface. File of the interface is default for File option.
+func (s *Source) ConfigOptions(iface string) ([]extcap.ConfigOption, error) {
+	path, err := s.file(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	file := *File
+	return []extcap.ConfigOption{file.Default(path), Speed, Loop, Timestamps}, nil
+}
+
+// AllConfigOptions implements extcap.ConfigSource interface
+func (s *Source) AllConfigOptions() []extcap.ConfigOption {
+	return []extcap.ConfigOption{File, Speed, Loop, Timestamps}
+}
+
+// StartCapture implements extcap.Source interface
+func (s *Source) StartCapture(iface string, fifo io.WriteCloser, filter string, opts map[string]interface{}) error {
+	defer fifo.Close()
+
+	path, err := s.file(iface)
+	if err != nil {
+		return err
+	}
+
+	cfg := config{speed: 1}
+	if v, ok := opts[File.Call()].(string); ok && v != "" {
+		path = v
+	}
+	if v, ok := opts[Speed.Call()].(float64); ok {
+		cfg.speed = v
+	}
+	if v, ok := opts[Loop.Call()].(bool); ok {
+		cfg.loop = v
+	}
+	if v, ok := opts[Timestamps.Call()].(string); ok {
+		cfg.now = v == TimestampsNow
+	}
+
+	extcap.Log().Debugf("Replay '%s' with speed %g", path, cfg.speed)
+	return replay(path, fifo, cfg)
+}
+
+func (s *Source) file(iface string) (string, error) {
+	for _, file := range s.Files {
+		if iface == s.Prefix+filepath.Base(file) {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("%w '%s'", extcap.ErrUnknownInterface, iface)
+}
+
+type config struct {
+	speed float64 // 0 means no delays
+	loop  bool
+	now   bool // rewrite timestamps to current time
+}
+
+type packetReader interface {
+	ReadPacketData() ([]byte, gopacket.CaptureInfo, error)
+	LinkType() layers.LinkType
+}
+
+// newReader returns pcap or pcapng reader depending on file magic
+func newReader(r io.Reader) (packetReader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(magic, pcapngMagic) {
+		return pcapgo.NewNgReader(br, pcapgo.DefaultNgReaderOptions)
+	}
+	return pcapgo.NewReader(br)
+}
+
+// replay writes packets of the file to w keeping gaps between them
+func replay(path string, w io.Writer, cfg config) error {
+	var writer *pcapgo.Writer
+	for {
+		count, err := replayOnce(path, w, &writer, cfg)
+		if err != nil {
+			return err
+		}
+		if !cfg.loop || count == 0 {
+			return nil
+		}
+		extcap.Log().Debugf("End of '%s' is reached, %d packets replayed, start again", path, count)
+	}
+}
+
+// replayOnce plays the file from the beginning. Writer is created on first call
+// with link type of the file.
+func replayOnce(path string, w io.Writer, writer **pcapgo.Writer, cfg config) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r, err := newReader(f)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to read '%s': %w", path, err)
+	}
+
+	if *writer == nil {
+		*writer = pcapgo.NewWriterNanos(w)
+		if err = (*writer).WriteFileHeader(snapLength, r.LinkType()); err != nil {
+			return 0, err
+		}
+	}
+
+	ng, _ := r.(*pcapgo.NgReader)
+
+	var first time.Time
+	start := time.Now()
+	count := 0
+	for {
+		data, ci, err := r.ReadPacketData()
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return count, nil
+		}
+		if err != nil {
+			return count, fmt.Errorf("Unable to read packet from '%s': %w", path, err)
+		}
+
+		// pcap output holds single link type
+		if ng != nil {
+			if iface, err := ng.Interface(ci.InterfaceIndex); err == nil && iface.LinkType != r.LinkType() {
+				continue
+			}
+		}
+
+		if count == 0 {
+			first = ci.Timestamp
+		}
+		if cfg.speed > 0 {
+			offset := time.Duration(float64(ci.Timestamp.Sub(first)) / cfg.speed)
+			if delay := time.Until(start.Add(offset)); delay > 0 {
+				time.Sleep(delay)
+			}
+		}
+
+		if cfg.now {
+			ci.Timestamp = time.Now()
+		}
+		ci.InterfaceIndex = 0
+		if err = (*writer).WritePacket(ci, data); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
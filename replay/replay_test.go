@@ -0,0 +1,107 @@
+package replay
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kor44/extcap"
+)
+
+var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func writeTestFile(t *testing.T, name string, ng bool) string {
+	path := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var w interface {
+		WritePacket(gopacket.CaptureInfo, []byte) error
+	}
+	if ng {
+		ngw, err := pcapgo.NewNgWriter(f, layers.LinkTypeRaw)
+		require.NoError(t, err)
+		defer ngw.Flush()
+		w = ngw
+	} else {
+		pw := pcapgo.NewWriter(f)
+		require.NoError(t, pw.WriteFileHeader(65535, layers.LinkTypeRaw))
+		w = pw
+	}
+
+	for i := 0; i < 3; i++ {
+		data := []byte{0x45, byte(i)}
+		ci := gopacket.CaptureInfo{
+			Timestamp:     epoch.Add(time.Duration(i) * time.Second),
+			CaptureLength: len(data),
+			Length:        len(data),
+		}
+		require.NoError(t, w.WritePacket(ci, data))
+	}
+	return path
+}
+
+func readPackets(t *testing.T, data []byte) ([]gopacket.CaptureInfo, layers.LinkType) {
+	r, err := pcapgo.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	var cis []gopacket.CaptureInfo
+	for {
+		_, ci, err := r.ReadPacketData()
+		if err != nil {
+			break
+		}
+		cis = append(cis, ci)
+	}
+	return cis, r.LinkType()
+}
+
+func TestDLT(t *testing.T) {
+	s := New(writeTestFile(t, "test.pcap", false), writeTestFile(t, "test.pcapng", true))
+
+	ifaces, err := s.Interfaces()
+	require.NoError(t, err)
+	require.Len(t, ifaces, 2)
+	assert.Equal(t, "replay-test.pcap", ifaces[0].Value)
+
+	for _, iface := range ifaces {
+		dlt, err := s.DLT(iface.Value)
+		require.NoError(t, err)
+		assert.Equal(t, int(layers.LinkTypeRaw), dlt.Number)
+	}
+
+	_, err = s.DLT("replay-missing.pcap")
+	assert.ErrorIs(t, err, extcap.ErrUnknownInterface)
+}
+
+func TestReplay(t *testing.T) {
+	for _, ng := range []bool{false, true} {
+		path := writeTestFile(t, "test", ng)
+
+		// original timestamps without delays
+		out := new(bytes.Buffer)
+		require.NoError(t, replay(path, out, config{}))
+		cis, linkType := readPackets(t, out.Bytes())
+		assert.Equal(t, layers.LinkTypeRaw, linkType)
+		require.Len(t, cis, 3)
+		assert.True(t, cis[2].Timestamp.Equal(epoch.Add(2*time.Second)))
+
+		// gaps are divided by speed, timestamps are rewritten
+		out.Reset()
+		start := time.Now()
+		require.NoError(t, replay(path, out, config{speed: 20, now: true}))
+		assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+		cis, _ = readPackets(t, out.Bytes())
+		require.Len(t, cis, 3)
+		assert.True(t, cis[0].Timestamp.After(start))
+	}
+}
@@ -0,0 +1,232 @@
+package extcap
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcapgo"
+
+	"github.com/kor44/extcap/filter"
+)
+
+// Ring buffer options. They are added to config of every interface when App.RingBuffer is set.
+var (
+	RingFile = NewConfigFileSelectOpt("ring-file", "Save to file").Group("Ring buffer").
+			Tooltip("Copy of the capture is saved to files with this name and number suffix. pcapng is used for .pcapng extension, pcap otherwise")
+	RingSize = NewConfigIntegerOpt("ring-size", "Switch file after kB").
+			Range(0, math.MaxInt32).Default(0).Group("Ring buffer").Tooltip("Next file is started when size of the file reaches this number of kilobytes, 0 is unlimited")
+	RingInterval = NewConfigIntegerOpt("ring-interval", "Switch file after seconds").
+			Range(0, math.MaxInt32).Default(0).Group("Ring buffer").Tooltip("Next file is started after this number of seconds, 0 is unlimited")
+	RingFiles = NewConfigIntegerOpt("ring-files", "Number of files").
+			Range(0, math.MaxInt32).Default(0).Group("Ring buffer").Tooltip("Only this number of the most recent files is kept, 0 keeps all files")
+)
+
+func ringOptions() []ConfigOption {
+	return []ConfigOption{RingFile, RingSize, RingInterval, RingFiles}
+}
+
+// ringBuffer writes copy of the stream to rotating files
+type ringBuffer struct {
+	base     string
+	maxSize  int64
+	interval time.Duration
+	maxFiles int
+
+	info    streamInfo
+	file    *os.File
+	counter *countingWriter
+	writer  interface {
+		WritePacket(ci gopacket.CaptureInfo, data []byte) error
+	}
+	flush   func() error
+	ng      *pcapgo.NgWriter // writer of pcapng file
+	added   int              // number of interfaces added to pcapng file
+	opened  time.Time
+	number  int
+	written []string // names of files in order of creation
+}
+
+func newRingBuffer(base string, maxSize int64, interval time.Duration, maxFiles int) *ringBuffer {
+	return &ringBuffer{
+		base:     base,
+		maxSize:  maxSize,
+		interval: interval,
+		maxFiles: maxFiles,
+	}
+}
+
+// stage returns stageFunc which writes every packet to the files and passes it further unchanged.
+// Files are switched by timestamps of packets.
+func (r *ringBuffer) stage() stageFunc {
+	return func(info streamInfo) (PacketFunc, error) {
+		r.info = info
+
+		return func(ci *gopacket.CaptureInfo, data []byte) ([]byte, error) {
+			if r.file == nil || r.full(ci.Timestamp) {
+				if err := r.rotate(ci.Timestamp); err != nil {
+					return nil, err
+				}
+			}
+			if err := r.addInterfaces(ci.InterfaceIndex); err != nil {
+				return nil, err
+			}
+			if err := r.writer.WritePacket(*ci, data); err != nil {
+				return nil, fmt.Errorf("Unable to write to '%s': %w", r.file.Name(), err)
+			}
+			if err := r.flush(); err != nil {
+				return nil, err
+			}
+			return data, nil
+		}, nil
+	}
+}
+
+// full reports whether next file should be started
+func (r *ringBuffer) full(t time.Time) bool {
+	if r.maxSize > 0 && r.counter.n >= r.maxSize {
+		return true
+	}
+	return r.interval > 0 && t.Sub(r.opened) >= r.interval
+}
+
+// name returns name of file with given number, e.g. capture_00001_20230801120000.pcapng
+func (r *ringBuffer) name(number int, t time.Time) string {
+	ext := filepath.Ext(r.base)
+	return fmt.Sprintf("%s_%05d_%s%s", strings.TrimSuffix(r.base, ext), number, t.Format("20060102150405"), ext)
+}
+
+// rotate closes current file, starts the next one and removes the oldest files
+func (r *ringBuffer) rotate(t time.Time) error {
+	if err := r.Close(); err != nil {
+		return err
+	}
+
+	r.number++
+	r.opened = t
+	name := r.name(r.number, r.opened)
+	file, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("Unable to create ring buffer file: %w", err)
+	}
+
+	cw := &countingWriter{w: file}
+	if strings.EqualFold(filepath.Ext(name), ".pcapng") {
+		intf, err := r.info.iface(0)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		w, err := pcapgo.NewNgWriterInterface(cw, intf, pcapgo.DefaultNgWriterOptions)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		r.writer, r.flush, r.ng, r.added = w, w.Flush, w, 1
+	} else {
+		snaplen := r.info.snaplen
+		if snaplen == 0 {
+			snaplen = filter.DefaultSnapLength
+		}
+		w := pcapgo.NewWriterNanos(cw)
+		if err = w.WriteFileHeader(snaplen, r.info.linkType); err != nil {
+			file.Close()
+			return err
+		}
+		r.writer, r.flush, r.ng = w, func() error { return nil }, nil
+	}
+	r.file = file
+	r.counter = cw
+	logger.Debugf("Ring buffer file '%s' is started", name)
+
+	r.written = append(r.written, name)
+	for r.maxFiles > 0 && len(r.written) > r.maxFiles {
+		if err = os.Remove(r.written[0]); err != nil && !os.IsNotExist(err) {
+			logger.Warnf("Unable to remove ring buffer file: %s", err)
+		}
+		r.written = r.written[1:]
+	}
+	return nil
+}
+
+// addInterfaces adds interfaces of the stream up to given index to pcapng file.
+// Packets of all interfaces are written to pcap file with link type of the first one.
+func (r *ringBuffer) addInterfaces(index int) error {
+	for r.ng != nil && r.added <= index {
+		intf, err := r.info.iface(r.added)
+		if err != nil {
+			return err
+		}
+		if _, err = r.ng.AddInterface(intf); err != nil {
+			return fmt.Errorf("Unable to write to '%s': %w", r.file.Name(), err)
+		}
+		r.added++
+	}
+	return nil
+}
+
+// Close flushes and closes current file
+func (r *ringBuffer) Close() error {
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.flush()
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	r.file = nil
+	return err
+}
+
+// countingWriter counts bytes written to the file
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// detachedPipe discards data after the first failed write, so capture goes on
+// when Wireshark closes the FIFO (e.g. to keep writing ring buffer files).
+type detachedPipe struct {
+	io.WriteCloser
+
+	mu       sync.Mutex
+	detached bool
+}
+
+func (p *detachedPipe) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.detached {
+		return len(b), nil
+	}
+	if _, err := p.WriteCloser.Write(b); err != nil {
+		logger.Warnf("FIFO is closed, capture continues: %s", err)
+		p.detached = true
+	}
+	return len(b), nil
+}
+
+func (p *detachedPipe) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	err := p.WriteCloser.Close()
+	if p.detached {
+		return nil
+	}
+	return err
+}
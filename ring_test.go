@@ -0,0 +1,164 @@
+package extcap
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// brokenPipe fails all writes like FIFO closed by Wireshark
+type brokenPipe struct{}
+
+func (brokenPipe) Write([]byte) (int, error) { return 0, errors.New("broken pipe") }
+func (brokenPipe) Close() error              { return nil }
+
+func TestRingBuffer(t *testing.T) {
+	b, err := NewPacketBuilder(layers.LinkTypeEthernet)
+	require.NoError(t, err)
+	flow := Flow{layers.IPProtocolUDP, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 5000, 514}
+
+	tests := []struct {
+		name     string
+		file     string
+		maxSize  int64
+		interval time.Duration
+		maxFiles int
+		expected [][][]byte // payloads of kept files
+	}{
+		{"size", "cap.pcap", 150, 0, 0, [][][]byte{{{0}, {1}}, {{2}, {3}}, {{4}}}},
+		{"files", "cap.pcapng", 0, 2 * time.Second, 2, [][][]byte{{{2}, {3}}, {{4}}}},
+		{"interval", "cap.pcap", 0, 3 * time.Second, 0, [][][]byte{{{0}, {1}, {2}}, {{3}, {4}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			now := time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC)
+			ring := newRingBuffer(filepath.Join(dir, tt.file), tt.maxSize, tt.interval, tt.maxFiles)
+
+			// live output fails, but capture goes on
+			stream := newPacketStream(&detachedPipe{WriteCloser: brokenPipe{}}, []stageFunc{ring.stage()})
+			w := pcapgo.NewWriter(stream)
+			require.NoError(t, w.WriteFileHeader(65535, layers.LinkTypeEthernet))
+			for i := 0; i < 5; i++ {
+				frame, err := b.Build(flow, []byte{byte(i)})
+				require.NoError(t, err)
+				ci := gopacket.CaptureInfo{Timestamp: now, CaptureLength: len(frame), Length: len(frame)}
+				require.NoError(t, w.WritePacket(ci, frame))
+				now = now.Add(time.Second)
+			}
+			require.NoError(t, stream.Close())
+			require.NoError(t, ring.Close())
+
+			files, err := filepath.Glob(filepath.Join(dir, "cap_*"))
+			require.NoError(t, err)
+			require.Len(t, files, len(tt.expected))
+			for i, name := range files {
+				data, err := os.ReadFile(name)
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected[i], readAll(t, data), name)
+			}
+		})
+	}
+}
+
+func TestRingBufferInterfaces(t *testing.T) {
+	b, err := NewPacketBuilder(layers.LinkTypeEthernet)
+	require.NoError(t, err)
+	flow := Flow{layers.IPProtocolUDP, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 5000, 514}
+	frame, err := b.Build(flow, []byte{1})
+	require.NoError(t, err)
+
+	t.Run("pcapng", func(t *testing.T) {
+		dir := t.TempDir()
+		ring := newRingBuffer(filepath.Join(dir, "cap.pcapng"), 0, 0, 0)
+		stream := newPacketStream(nopWriteCloser{new(bytes.Buffer)}, []stageFunc{ring.stage()})
+
+		// packets of the second interface are written to the ring file too
+		w, err := pcapgo.NewNgWriter(stream, layers.LinkTypeEthernet)
+		require.NoError(t, err)
+		second, err := w.AddInterface(pcapgo.NgInterface{Name: "eth1", LinkType: layers.LinkTypeEthernet, SnapLength: 1500})
+		require.NoError(t, err)
+		for _, index := range []int{0, second} {
+			ci := gopacket.CaptureInfo{Timestamp: time.Now(), CaptureLength: len(frame), Length: len(frame), InterfaceIndex: index}
+			require.NoError(t, w.WritePacket(ci, frame))
+		}
+		require.NoError(t, w.Flush())
+		require.NoError(t, stream.Close())
+		require.NoError(t, ring.Close())
+
+		files, err := filepath.Glob(filepath.Join(dir, "cap_*"))
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		f, err := os.Open(files[0])
+		require.NoError(t, err)
+		defer f.Close()
+		r, err := pcapgo.NewNgReader(f, pcapgo.DefaultNgReaderOptions)
+		require.NoError(t, err)
+		for _, index := range []int{0, second} {
+			_, ci, err := r.ReadPacketData()
+			require.NoError(t, err)
+			assert.Equal(t, index, ci.InterfaceIndex)
+		}
+		intf, err := r.Interface(second)
+		require.NoError(t, err)
+		assert.Equal(t, "eth1", intf.Name)
+		assert.Equal(t, uint32(1500), intf.SnapLength)
+	})
+
+	t.Run("pcap", func(t *testing.T) {
+		dir := t.TempDir()
+		ring := newRingBuffer(filepath.Join(dir, "cap.pcap"), 0, 0, 0)
+		stream := newPacketStream(nopWriteCloser{new(bytes.Buffer)}, []stageFunc{ring.stage()})
+
+		// snapshot length of the input is kept
+		w := pcapgo.NewWriter(stream)
+		require.NoError(t, w.WriteFileHeader(1500, layers.LinkTypeEthernet))
+		require.NoError(t, w.WritePacket(gopacket.CaptureInfo{Timestamp: time.Now(), CaptureLength: len(frame), Length: len(frame)}, frame))
+		require.NoError(t, stream.Close())
+		require.NoError(t, ring.Close())
+
+		files, err := filepath.Glob(filepath.Join(dir, "cap_*"))
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		f, err := os.Open(files[0])
+		require.NoError(t, err)
+		defer f.Close()
+		r, err := pcapgo.NewReader(f)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(1500), r.Snaplen())
+	})
+}
+
+func TestRingBufferName(t *testing.T) {
+	ring := newRingBuffer("/tmp/capture.pcapng", 0, 0, 0)
+	ts := time.Date(2023, 8, 1, 12, 30, 45, 0, time.UTC)
+	assert.Equal(t, "/tmp/capture_00007_20230801123045.pcapng", ring.name(7, ts))
+}
+
+func TestDetachedPipe(t *testing.T) {
+	out := new(bytes.Buffer)
+	p := &detachedPipe{WriteCloser: nopWriteCloser{out}}
+	n, err := p.Write([]byte("abc"))
+	assert.Equal(t, 3, n)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", out.String())
+
+	p = &detachedPipe{WriteCloser: brokenPipe{}}
+	for i := 0; i < 2; i++ {
+		n, err = p.Write([]byte("abc"))
+		assert.Equal(t, 3, n)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, p.Close())
+}
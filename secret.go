@@ -0,0 +1,129 @@
+package extcap
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// ErrSecretNotFound is returned by SecretProvider when it has no secret for the key.
+// Next source of the password option is tried then.
+var ErrSecretNotFound = errors.New("Secret not found")
+
+// SecretProvider returns secrets by key, e.g. from OS keyring or vault
+type SecretProvider interface {
+	Secret(key string) (string, error)
+}
+
+// SecretFunc is adapter to use ordinary function as SecretProvider
+type SecretFunc func(key string) (string, error)
+
+// Secret implements SecretProvider interface
+func (f SecretFunc) Secret(key string) (string, error) {
+	return f(key)
+}
+
+// secretSource is place where value of password option is looked for
+type secretSource struct {
+	name   string
+	lookup func() (string, error)
+}
+
+func envSecret(name string) secretSource {
+	return secretSource{
+		name: "environment variable " + name,
+		lookup: func() (string, error) {
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				return "", ErrSecretNotFound
+			}
+			return v, nil
+		},
+	}
+}
+
+// fileSecret reads secret from the file, trailing newline is removed.
+// The file should not be accessible by other users.
+func fileSecret(path string) secretSource {
+	return secretSource{
+		name: "file " + path,
+		lookup: func() (string, error) {
+			info, err := os.Stat(path)
+			if os.IsNotExist(err) {
+				return "", ErrSecretNotFound
+			}
+			if err != nil {
+				return "", err
+			}
+			if err = checkSecretFile(info); err != nil {
+				return "", err
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimRight(string(data), "\r\n"), nil
+		},
+	}
+}
+
+func providerSecret(p SecretProvider, key string) secretSource {
+	return secretSource{
+		name: "provider key " + key,
+		lookup: func() (string, error) {
+			return p.Secret(key)
+		},
+	}
+}
+
+// resolve returns secret from the first source which has it
+func (c *ConfigPasswordOpt) resolve() (string, error) {
+	for _, s := range c.sources {
+		v, err := s.lookup()
+		if errors.Is(err, ErrSecretNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("Unable to get value of option '%s' from %s: %w", c.call(), s.name, err)
+		}
+		if v != "" {
+			logger.Debugf("Value of option '%s' is taken from %s", c.call(), s.name)
+			return v, nil
+		}
+	}
+	return "", nil
+}
+
+// resolveSecrets sets password options which are not given from their sources when
+// resolve is set. All passwords are redacted in log messages and errors.
+func (extapp *App) resolveSecrets(ctx *cli.Context, resolve bool) error {
+	for _, opt := range extapp.profileOptions() {
+		opt, ok := opt.(*ConfigPasswordOpt)
+		if !ok {
+			continue
+		}
+
+		v := ctx.String(opt.call())
+		if v == "" && !resolve {
+			continue
+		}
+		if v == "" {
+			var err error
+			if v, err = opt.resolve(); err != nil {
+				return err
+			}
+			if v == "" {
+				continue
+			}
+			if err = ctx.Set(opt.call(), v); err != nil {
+				return err
+			}
+		}
+		logger.addSecret(v)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package extcap
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestPasswordSources(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "secret")
+	require.NoError(t, os.WriteFile(secretFile, []byte("from-file\n"), 0600))
+
+	keyring := SecretFunc(func(key string) (string, error) {
+		switch key {
+		case "known":
+			return "from-provider", nil
+		case "broken":
+			return "", errors.New("keyring is locked")
+		}
+		return "", ErrSecretNotFound
+	})
+
+	t.Setenv("TEST_PASSWORD", "from-env")
+
+	testCases := []struct {
+		name     string
+		opt      *ConfigPasswordOpt
+		expected string
+		err      string
+	}{
+		{"env", NewConfigPasswordOpt("p", "P").FromEnv("TEST_PASSWORD").FromFile(secretFile), "from-env", ""},
+		{"file", NewConfigPasswordOpt("p", "P").FromEnv("MISSING_PASSWORD").FromFile(secretFile), "from-file", ""},
+		{"provider", NewConfigPasswordOpt("p", "P").FromFile(filepath.Join(dir, "missing")).FromProvider(keyring, "known"), "from-provider", ""},
+		{"not found", NewConfigPasswordOpt("p", "P").FromProvider(keyring, "unknown"), "", ""},
+		{"provider error", NewConfigPasswordOpt("p", "P").FromProvider(keyring, "broken"), "", "keyring is locked"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := tc.opt.resolve()
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, v)
+		})
+	}
+
+	if runtime.GOOS != "windows" {
+		require.NoError(t, os.Chmod(secretFile, 0644))
+		_, err := NewConfigPasswordOpt("p", "P").FromFile(secretFile).resolve()
+		assert.ErrorContains(t, err, "too open")
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	t.Setenv("TEST_PASSWORD", "s3cret")
+	password := NewConfigPasswordOpt("remote-password", "Password").FromEnv("TEST_PASSWORD")
+	extapp := &App{
+		GetAllConfigOptions: func() []ConfigOption { return []ConfigOption{password} },
+	}
+
+	out := new(bytes.Buffer)
+	defer logger.configure(LevelInfo, "")
+	defer func() { logger.secrets = nil }()
+	logger.configure(LevelDebug, "capture", out)
+
+	flag, _ := optionFlag(password)
+	var (
+		opts map[string]interface{}
+		err  error
+	)
+	app := &cli.App{
+		Flags: []cli.Flag{flag},
+		Action: func(ctx *cli.Context) error {
+			if err := extapp.resolveSecrets(ctx, true); err != nil {
+				return err
+			}
+			opts, err = extapp.captureOptions(ctx, "")
+			return err
+		},
+	}
+	require.NoError(t, app.Run([]string{"test"}))
+	assert.Equal(t, "s3cret", opts["remote-password"])
+
+	logger.Errorf("Login failed with password s3cret")
+	assert.Contains(t, out.String(), "Login failed with password ********")
+	assert.NotContains(t, out.String(), "s3cret")
+	assert.Equal(t, "Invalid password '********'", logger.redact("Invalid password 's3cret'"))
+}
+
+func TestRedactArguments(t *testing.T) {
+	t.Setenv("TEST_PASSWORD", "fr0m-env")
+	password := NewConfigPasswordOpt("remote-password", "Password").FromEnv("TEST_PASSWORD")
+	extapp := testApp()
+	extapp.GetConfigOptions = func(iface string) ([]ConfigOption, error) { return []ConfigOption{password}, nil }
+	extapp.GetAllConfigOptions = func() []ConfigOption { return []ConfigOption{password} }
+	defer logger.configure(LevelInfo, "")
+	defer func() { logger.secrets = nil }()
+
+	// password given in command line is hidden in every mode, it is resolved only for capture
+	name := filepath.Join(t.TempDir(), "debug.log")
+	_, err := runApp(t, extapp, "--extcap-interface", "eth0", "--extcap-config", "--remote-password", "s3cret", "--debug", "--debug-file", name)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "--remote-password=********")
+	assert.NotContains(t, string(data), "s3cret")
+	assert.NotContains(t, string(data), "fr0m-env")
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package extcap
+
+import (
+	"fmt"
+	"os"
+)
+
+// checkSecretFile checks that file with secret is not accessible by group and others
+func checkSecretFile(info os.FileInfo) error {
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("Permissions %#o of secret file are too open, it should be accessible only by owner", perm)
+	}
+	return nil
+}
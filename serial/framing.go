@@ -0,0 +1,143 @@
+package serial
+
+import "fmt"
+
+// maxFrameSize limits size of decoded frame. Longer frames are dropped.
+const maxFrameSize = 65535
+
+// decoder extracts frames from byte stream
+type decoder interface {
+	// feed adds received byte. It returns decoded frame when the byte completes one.
+	feed(b byte) []byte
+}
+
+func newDecoder(framing string) (decoder, error) {
+	switch framing {
+	case FramingSLIP:
+		return &slipDecoder{}, nil
+	case FramingHDLC:
+		return &hdlcDecoder{}, nil
+	case FramingCOBS:
+		return &cobsDecoder{}, nil
+	}
+	return nil, fmt.Errorf("Unknown framing '%s'", framing)
+}
+
+// frameBuffer collects bytes of current frame
+type frameBuffer struct {
+	buf      []byte
+	overflow bool
+}
+
+func (f *frameBuffer) add(b byte) {
+	if len(f.buf) >= maxFrameSize {
+		f.overflow = true
+		return
+	}
+	f.buf = append(f.buf, b)
+}
+
+// finish returns collected frame and starts new one. Empty and too long frames are dropped.
+func (f *frameBuffer) finish() []byte {
+	frame, overflow := f.buf, f.overflow
+	f.buf, f.overflow = nil, false
+	if overflow || len(frame) == 0 {
+		return nil
+	}
+	return frame
+}
+
+// SLIP special bytes (RFC 1055)
+const (
+	slipEnd    = 0xc0
+	slipEsc    = 0xdb
+	slipEscEnd = 0xdc
+	slipEscEsc = 0xdd
+)
+
+type slipDecoder struct {
+	frameBuffer
+	escaped bool
+}
+
+func (d *slipDecoder) feed(b byte) []byte {
+	switch {
+	case b == slipEnd:
+		d.escaped = false
+		return d.finish()
+	case b == slipEsc:
+		d.escaped = true
+		return nil
+	case d.escaped && b == slipEscEnd:
+		b = slipEnd
+	case d.escaped && b == slipEscEsc:
+		b = slipEsc
+	}
+	d.escaped = false
+	d.add(b)
+	return nil
+}
+
+// Asynchronous HDLC-like framing special bytes (RFC 1662)
+const (
+	hdlcFlag   = 0x7e
+	hdlcEscape = 0x7d
+	hdlcXor    = 0x20
+)
+
+// hdlcDecoder removes flags and byte stuffing. Frame is returned with FCS.
+type hdlcDecoder struct {
+	frameBuffer
+	escaped bool
+}
+
+func (d *hdlcDecoder) feed(b byte) []byte {
+	switch {
+	case b == hdlcFlag:
+		d.escaped = false
+		return d.finish()
+	case b == hdlcEscape:
+		d.escaped = true
+		return nil
+	case d.escaped:
+		b ^= hdlcXor
+	}
+	d.escaped = false
+	d.add(b)
+	return nil
+}
+
+// cobsDecoder decodes Consistent Overhead Byte Stuffing frames delimited by zero byte
+type cobsDecoder struct {
+	frameBuffer
+}
+
+func (d *cobsDecoder) feed(b byte) []byte {
+	if b != 0 {
+		d.add(b)
+		return nil
+	}
+
+	encoded := d.finish()
+	if encoded == nil {
+		return nil
+	}
+	return cobsDecode(encoded)
+}
+
+// cobsDecode returns decoded frame or nil if encoding is invalid
+func cobsDecode(encoded []byte) []byte {
+	frame := make([]byte, 0, len(encoded))
+	for i := 0; i < len(encoded); {
+		code := int(encoded[i])
+		if code == 0 || i+code > len(encoded) {
+			return nil
+		}
+		frame = append(frame, encoded[i+1:i+code]...)
+		i += code
+		if code < 0xff && i < len(encoded) {
+			frame = append(frame, 0)
+		}
+	}
+	return frame
+}
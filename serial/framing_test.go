@@ -0,0 +1,58 @@
+package serial
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecoders(t *testing.T) {
+	tests := []struct {
+		framing  string
+		stream   []byte
+		expected [][]byte
+	}{
+		{FramingSLIP,
+			[]byte{0xc0, 0x01, 0xdb, 0xdc, 0x02, 0xdb, 0xdd, 0xc0, 0xc0, 0x03, 0xc0},
+			[][]byte{{0x01, 0xc0, 0x02, 0xdb}, {0x03}},
+		},
+		{FramingHDLC,
+			[]byte{0x7e, 0xff, 0x03, 0x7d, 0x5e, 0x7d, 0x5d, 0x7e, 0x7e, 0x01, 0x7e},
+			[][]byte{{0xff, 0x03, 0x7e, 0x7d}, {0x01}},
+		},
+		{FramingCOBS,
+			[]byte{0x03, 0x11, 0x22, 0x02, 0x33, 0x00, 0x01, 0x01, 0x00, 0x05, 0x11, 0x00},
+			[][]byte{{0x11, 0x22, 0x00, 0x33}, {0x00}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.framing, func(t *testing.T) {
+			dec, err := newDecoder(tt.framing)
+			require.NoError(t, err)
+
+			var frames [][]byte
+			for _, b := range tt.stream {
+				if frame := dec.feed(b); frame != nil {
+					frames = append(frames, frame)
+				}
+			}
+			assert.Equal(t, tt.expected, frames)
+		})
+	}
+
+	_, err := newDecoder("unknown")
+	assert.Error(t, err)
+}
+
+func TestFrameOverflow(t *testing.T) {
+	dec, _ := newDecoder(FramingSLIP)
+	for i := 0; i < maxFrameSize+10; i++ {
+		dec.feed(0x01)
+	}
+	assert.Nil(t, dec.feed(0xc0))
+
+	dec.feed(0x02)
+	assert.Equal(t, []byte{0x02}, dec.feed(0xc0))
+}
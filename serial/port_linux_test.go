@@ -0,0 +1,89 @@
+//go:build linux
+// +build linux
+
+package serial
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	"github.com/kor44/extcap"
+)
+
+// openPty returns master side and path of slave side of new pseudo-terminal
+func openPty(t *testing.T) (*os.File, string) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("pseudo-terminals are not available: %s", err)
+	}
+	t.Cleanup(func() { master.Close() })
+
+	fd := int(master.Fd())
+	require.NoError(t, unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0))
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	require.NoError(t, err)
+	return master, fmt.Sprintf("/dev/pts/%d", n)
+}
+
+// limitedWriter fails after limit of writes is reached
+type limitedWriter struct {
+	bytes.Buffer
+	limit int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.limit == 0 {
+		return 0, io.ErrClosedPipe
+	}
+	w.limit--
+	return w.Buffer.Write(p)
+}
+
+func (w *limitedWriter) Close() error { return nil }
+
+func TestCapturePty(t *testing.T) {
+	master, slave := openPty(t)
+
+	// file header and two packets
+	out := &limitedWriter{limit: 5}
+	opts := map[string]interface{}{
+		Baud.Call():      "9600",
+		Framing.Call():   FramingSLIP,
+		Output.Call():    OutputExportedPDU,
+		Dissector.Call(): "data",
+	}
+
+	s := New(slave)
+	done := make(chan error)
+	go func() { done <- s.StartCapture("serial-"+slave[len("/dev/pts/"):], out, "", opts) }()
+
+	_, err := master.Write([]byte{0xc0, 'a', 'b', 0xc0, 0xc0, 'c', 0xc0, 0xc0, 'd', 0xc0})
+	require.NoError(t, err)
+
+	select {
+	case err = <-done:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("capture doesn't stop")
+	}
+
+	r, err := pcapgo.NewReader(bytes.NewReader(out.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, extcap.LinkTypeUpperPDU, r.LinkType())
+
+	data, _, err := r.ReadPacketData()
+	require.NoError(t, err)
+	assert.Equal(t, extcap.ExportPDU("data", nil, []byte("ab")), data)
+	data, _, err = r.ReadPacketData()
+	require.NoError(t, err)
+	assert.Equal(t, extcap.ExportPDU("data", nil, []byte("c")), data)
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package serial
+
+import "os"
+
+func openPort(path string, baud int) (*os.File, error) {
+	return nil, ErrNotSupported
+}
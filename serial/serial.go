@@ -0,0 +1,240 @@
+/*
+Package serial implements capture source for framed traffic read from serial line
+(e.g. UART console of embedded device).
+
+Frames are extracted with SLIP, HDLC-like or COBS framing and written either with one of
+user link types (DLT_USER0 ... DLT_USER15, dissector is assigned in Wireshark preferences)
+or as exported PDUs passed to the given dissector.
+
+Usage:
+
+	app := extcap.App{Usage: "serial"}
+	app.Register(serial.New("/dev/ttyUSB0", "/dev/ttyACM0"))
+	app.Run(os.Args)
+*/
+package serial
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	"github.com/kor44/extcap"
+)
+
+// ErrNotSupported is returned on platforms where serial port can't be configured
+var ErrNotSupported = errors.New("Serial port configuration is not supported on this platform")
+
+// Values of Framing option
+const (
+	FramingSLIP = "slip"
+	FramingHDLC = "hdlc"
+	FramingCOBS = "cobs"
+)
+
+// OutputExportedPDU is value of Output option for exported PDUs, other values are user DLTs "user0" ... "user15"
+const OutputExportedPDU = "exported-pdu"
+
+// Define all options
+var (
+	Baud = extcap.NewConfigSelectorOpt("baud", "Baud rate").Values(
+		baudValues(9600, 19200, 38400, 57600, 115200, 230400, 460800, 921600)...,
+	).Default("115200")
+	Framing = extcap.NewConfigSelectorOpt("framing", "Framing").Values(
+		extcap.SelectorValue{Value: FramingSLIP, Display: "SLIP (RFC 1055)"},
+		extcap.SelectorValue{Value: FramingHDLC, Display: "HDLC-like (RFC 1662)"},
+		extcap.SelectorValue{Value: FramingCOBS, Display: "COBS"},
+	).Default(FramingSLIP)
+	Output = extcap.NewConfigSelectorOpt("output", "Output DLT").Values(outputValues()...).
+		Default("user0").Tooltip("User DLT or exported PDU passed to the dissector")
+	Dissector = extcap.NewConfigStringOpt("dissector", "Dissector").
+			Tooltip("Wireshark dissector for exported PDU output")
+)
+
+func baudValues(rates ...int) []extcap.SelectorValue {
+	values := make([]extcap.SelectorValue, len(rates))
+	for i, rate := range rates {
+		values[i] = extcap.SelectorValue{Value: strconv.Itoa(rate), Display: strconv.Itoa(rate)}
+	}
+	return values
+}
+
+func outputValues() []extcap.SelectorValue {
+	values := make([]extcap.SelectorValue, 0, 17)
+	for i := 0; i < 16; i++ {
+		values = append(values, extcap.SelectorValue{
+			Value:   fmt.Sprintf("user%d", i),
+			Display: fmt.Sprintf("DLT_USER%d (%d)", i, int(extcap.LinkTypeUser0)+i),
+		})
+	}
+	return append(values, extcap.SelectorValue{Value: OutputExportedPDU, Display: "Exported PDU"})
+}
+
+const defaultPrefix = "serial-"
+
+// Source captures frames from serial devices
+type Source struct {
+	// Prefix is added to base name of the device to get interface name. Default is "serial-"
+	Prefix string
+
+	// Devices are paths of serial devices shown as interfaces
+	Devices []string
+}
+
+// New creates source for given devices
+func New(devices ...string) *Source {
+	return &Source{
+		Prefix:  defaultPrefix,
+		Devices: devices,
+	}
+}
+
+// Interfaces implements extcap.Source interface
+func (s *Source) Interfaces() ([]extcap.CaptureInterface, error) {
+	result := make([]extcap.CaptureInterface, 0, len(s.Devices))
+	for _, dev := range s.Devices {
+		result = append(result, extcap.CaptureInterface{
+			Value:   s.Prefix + filepath.Base(dev),
+			Display: "Serial: " + dev,
+		})
+	}
+	return result, nil
+}
+
+// DLT implements extcap.Source interface. Output DLT is chosen in options, so USER0 is reported.
+func (s *Source) DLT(iface string) (extcap.DLT, error) {
+	if _, err := s.device(iface); err != nil {
+		return extcap.DLT{}, err
+	}
+	return extcap.DLTFromLinkType(extcap.LinkTypeUser0), nil
+}
+
+// ConfigOptions implements extcap.ConfigSource interface
+func (s *Source) ConfigOptions(iface string) ([]extcap.ConfigOption, error) {
+	return s.AllConfigOptions(), nil
+}
+
+// AllConfigOptions implements extcap.ConfigSource interface
+func (s *Source) AllConfigOptions() []extcap.ConfigOption {
+	return []extcap.ConfigOption{Baud, Framing, Output, Dissector}
+}
+
+// StartCapture implements extcap.Source interface
+func (s *Source) StartCapture(iface string, fifo io.WriteCloser, filter string, opts map[string]interface{}) error {
+	defer fifo.Close()
+
+	dev, err := s.device(iface)
+	if err != nil {
+		return err
+	}
+
+	cfg := config{baud: 115200, framing: FramingSLIP, linkType: extcap.LinkTypeUser0}
+	if v, ok := opts[Baud.Call()].(string); ok && v != "" {
+		if cfg.baud, err = strconv.Atoi(v); err != nil {
+			return fmt.Errorf("Invalid baud rate '%s'", v)
+		}
+	}
+	if v, ok := opts[Framing.Call()].(string); ok && v != "" {
+		cfg.framing = v
+	}
+	if v, ok := opts[Output.Call()].(string); ok && v != "" {
+		if cfg.linkType, err = outputLinkType(v); err != nil {
+			return err
+		}
+	}
+	if v, ok := opts[Dissector.Call()].(string); ok {
+		cfg.dissector = v
+	}
+	if cfg.linkType == extcap.LinkTypeUpperPDU && cfg.dissector == "" {
+		return errors.New("Dissector should be specified for exported PDU output")
+	}
+
+	port, err := openPort(dev, cfg.baud)
+	if err != nil {
+		return err
+	}
+	defer port.Close()
+
+	extcap.Log().Infof("Capture on %s, %d baud, %s framing", dev, cfg.baud, cfg.framing)
+	return capture(port, fifo, cfg)
+}
+
+func (s *Source) device(iface string) (string, error) {
+	for _, dev := range s.Devices {
+		if iface == s.Prefix+filepath.Base(dev) {
+			return dev, nil
+		}
+	}
+	return "", fmt.Errorf("%w '%s'", extcap.ErrUnknownInterface, iface)
+}
+
+// outputLinkType returns link type for value of Output option
+func outputLinkType(output string) (layers.LinkType, error) {
+	if output == OutputExportedPDU {
+		return extcap.LinkTypeUpperPDU, nil
+	}
+
+	n, err := strconv.Atoi(strings.TrimPrefix(output, "user"))
+	if !strings.HasPrefix(output, "user") || err != nil || n < 0 || n > 15 {
+		return 0, fmt.Errorf("Invalid output '%s'", output)
+	}
+	return extcap.LinkTypeUser0 + layers.LinkType(n), nil
+}
+
+type config struct {
+	baud      int
+	framing   string
+	linkType  layers.LinkType
+	dissector string
+}
+
+// capture reads serial stream and writes decoded frames until reading or writing fails
+func capture(r io.Reader, w io.Writer, cfg config) error {
+	dec, err := newDecoder(cfg.framing)
+	if err != nil {
+		return err
+	}
+
+	pw := pcapgo.NewWriterNanos(w)
+	if err = pw.WriteFileHeader(maxFrameSize+1024, cfg.linkType); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		for _, b := range buf[:n] {
+			frame := dec.feed(b)
+			if frame == nil {
+				continue
+			}
+
+			if cfg.linkType == extcap.LinkTypeUpperPDU {
+				frame = extcap.ExportPDU(cfg.dissector, nil, frame)
+			}
+			ci := gopacket.CaptureInfo{
+				Timestamp:     time.Now(),
+				CaptureLength: len(frame),
+				Length:        len(frame),
+			}
+			if err = pw.WritePacket(ci, frame); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package extcap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Source is capture backend which provides one or several interfaces.
+// It replaces GetInterfaces, GetDLT and StartCapture hooks of the App.
+type Source interface {
+	// Interfaces returns list of interfaces provided by the source
+	Interfaces() ([]CaptureInterface, error)
+
+	// DLT returns DLT for given interface
+	DLT(iface string) (DLT, error)
+
+	// StartCapture starts capture on given interface, see App.StartCapture
+	StartCapture(iface string, fifo io.WriteCloser, filter string, opts map[string]interface{}) error
+}
+
+// ConfigSource is implemented by sources which have configuration options
+type ConfigSource interface {
+	// ConfigOptions returns configuration options for given interface
+	ConfigOptions(iface string) ([]ConfigOption, error)
+
+	// AllConfigOptions returns all options of all interfaces of the source
+	AllConfigOptions() []ConfigOption
+}
+
+// ReloadSource is implemented by sources which are able to reload values of selector options
+type ReloadSource interface {
+	// ReloadOption returns new values of option with given call name
+	ReloadOption(iface, call string) ([]SelectorValue, error)
+}
+
+// ControlSource is implemented by sources which have interface toolbar controls
+type ControlSource interface {
+	// Controls returns toolbar controls. They are shared by all interfaces of the application
+	Controls() []*Control
+}
+
+// FilterValidator is implemented by sources which validate capture filter themselves
+type FilterValidator interface {
+	ValidateFilter(iface, filter string) error
+}
+
+// ErrUnknownInterface is returned when no registered source provides interface
+var ErrUnknownInterface = errors.New("Unknown interface")
+
+// Registry combines several independent sources in one application.
+// Each source contributes its own interfaces, interface names must be unique.
+// Registry implements Source and all optional interfaces, calls are dispatched
+// to the source which provides the interface.
+type Registry struct {
+	mu      sync.Mutex
+	sources []Source
+	owners  map[string]Source
+}
+
+// Register adds sources to registry
+func (r *Registry) Register(sources ...Source) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sources = append(r.sources, sources...)
+}
+
+// Sources returns registered sources
+func (r *Registry) Sources() []Source {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Source(nil), r.sources...)
+}
+
+// Interfaces returns interfaces of all sources
+func (r *Registry) Interfaces() ([]CaptureInterface, error) {
+	var all []CaptureInterface
+	owners := make(map[string]Source)
+	for _, src := range r.Sources() {
+		ifaces, err := src.Interfaces()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, iface := range ifaces {
+			if _, ok := owners[iface.Value]; ok {
+				return nil, fmt.Errorf("Interface '%s' is provided by several sources", iface.Value)
+			}
+			owners[iface.Value] = src
+		}
+		all = append(all, ifaces...)
+	}
+
+	r.mu.Lock()
+	r.owners = owners
+	r.mu.Unlock()
+
+	return all, nil
+}
+
+// Lookup returns source which provides interface. Sources are queried in order of registration
+// until the interface is found, so only sources before the owner are asked for interfaces.
+func (r *Registry) Lookup(iface string) (Source, error) {
+	r.mu.Lock()
+	src, ok := r.owners[iface]
+	r.mu.Unlock()
+	if ok {
+		return src, nil
+	}
+
+	for _, src := range r.Sources() {
+		ifaces, err := src.Interfaces()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, i := range ifaces {
+			if i.Value == iface {
+				r.mu.Lock()
+				if r.owners == nil {
+					r.owners = make(map[string]Source)
+				}
+				r.owners[iface] = src
+				r.mu.Unlock()
+				return src, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%w '%s'", ErrUnknownInterface, iface)
+}
+
+// DLT returns DLT of the interface
+func (r *Registry) DLT(iface string) (DLT, error) {
+	src, err := r.Lookup(iface)
+	if err != nil {
+		return DLT{}, err
+	}
+	return src.DLT(iface)
+}
+
+// StartCapture starts capture with source of the interface
+func (r *Registry) StartCapture(iface string, fifo io.WriteCloser, filter string, opts map[string]interface{}) error {
+	src, err := r.Lookup(iface)
+	if err != nil {
+		return err
+	}
+	return src.StartCapture(iface, fifo, filter, opts)
+}
+
+// ConfigOptions returns options of the interface. Interface of source without options has not any.
+func (r *Registry) ConfigOptions(iface string) ([]ConfigOption, error) {
+	src, err := r.Lookup(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfgSrc, ok := src.(ConfigSource); ok {
+		return cfgSrc.ConfigOptions(iface)
+	}
+	return nil, nil
+}
+
+// AllConfigOptions returns options of all sources. Options with the same call name are returned once,
+// so sources may share option definitions or define options with the same call and type. StartCapture
+// receives default value of the option defined by the source of the interface.
+func (r *Registry) AllConfigOptions() []ConfigOption {
+	var all []ConfigOption
+	seen := make(map[string]bool)
+	for _, src := range r.Sources() {
+		cfgSrc, ok := src.(ConfigSource)
+		if !ok {
+			continue
+		}
+
+		for _, opt := range cfgSrc.AllConfigOptions() {
+			if seen[opt.call()] {
+				continue
+			}
+			seen[opt.call()] = true
+			all = append(all, opt)
+		}
+	}
+	return all
+}
+
+// validateOptions checks options of every source and reports options of different sources
+// which share call name but can't be given with the same command line flag
+func (r *Registry) validateOptions(reserved map[string]bool) []error {
+	var problems []error
+	seen := make(map[string]string)
+	for _, src := range r.Sources() {
+		cfgSrc, ok := src.(ConfigSource)
+		if !ok {
+			continue
+		}
+
+		opts := cfgSrc.AllConfigOptions()
+		problems = append(problems, validateOptions(opts, reserved)...)
+		for _, opt := range opts {
+			flag, err := optionFlag(opt)
+			if err != nil {
+				continue
+			}
+			flagType := fmt.Sprintf("%T", flag)
+			if other, ok := seen[opt.call()]; ok && other != flagType {
+				problems = append(problems, fmt.Errorf("option '%s' is defined by several sources with different types", opt.call()))
+			}
+			seen[opt.call()] = flagType
+		}
+	}
+	return problems
+}
+
+// ReloadOption reloads values of the option of the interface
+func (r *Registry) ReloadOption(iface, call string) ([]SelectorValue, error) {
+	src, err := r.Lookup(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	if reloadSrc, ok := src.(ReloadSource); ok {
+		return reloadSrc.ReloadOption(iface, call)
+	}
+	return nil, fmt.Errorf("Option '%s' of interface '%s' can't be reloaded", call, iface)
+}
+
+// Controls returns toolbar controls of all sources in order of registration
+func (r *Registry) Controls() []*Control {
+	var all []*Control
+	for _, src := range r.Sources() {
+		if ctrlSrc, ok := src.(ControlSource); ok {
+			all = append(all, ctrlSrc.Controls()...)
+		}
+	}
+	return all
+}
+
+// ValidateFilter validates filter with source of the interface. If source doesn't
+// implement FilterValidator, the filter is compiled to BPF for DLT of the interface.
+func (r *Registry) ValidateFilter(iface, expr string) error {
+	src, err := r.Lookup(iface)
+	if err != nil {
+		return err
+	}
+
+	if validator, ok := src.(FilterValidator); ok {
+		return validator.ValidateFilter(iface, expr)
+	}
+
+	dlt, err := src.DLT(iface)
+	if err != nil {
+		return err
+	}
+	return compileFilter(dlt, expr)
+}
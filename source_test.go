@@ -0,0 +1,107 @@
+package extcap
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSource struct {
+	ifaces []CaptureInterface
+	dlt    DLT
+	opts   []ConfigOption
+}
+
+func (s *testSource) Interfaces() ([]CaptureInterface, error) { return s.ifaces, nil }
+func (s *testSource) DLT(iface string) (DLT, error)           { return s.dlt, nil }
+func (s *testSource) StartCapture(iface string, fifo io.WriteCloser, filter string, opts map[string]interface{}) error {
+	return nil
+}
+
+type testConfigSource struct {
+	testSource
+}
+
+func (s *testConfigSource) ConfigOptions(iface string) ([]ConfigOption, error) { return s.opts, nil }
+func (s *testConfigSource) AllConfigOptions() []ConfigOption                   { return s.opts }
+
+func TestRegistry(t *testing.T) {
+	shared := NewConfigStringOpt("host", "Host")
+	first := &testSource{
+		ifaces: []CaptureInterface{{"one", "First"}},
+		dlt:    DLT{1, "EN10MB", "Ethernet"},
+	}
+	second := &testConfigSource{testSource{
+		ifaces: []CaptureInterface{{"two", "Second"}, {"three", "Third"}},
+		dlt:    DLT{147, "USER0", "User 0"},
+		opts:   []ConfigOption{shared, NewConfigIntegerOpt("port", "Port")},
+	}}
+	third := &testConfigSource{testSource{
+		ifaces: []CaptureInterface{{"four", "Fourth"}},
+		opts:   []ConfigOption{shared},
+	}}
+
+	r := &Registry{}
+	r.Register(first, second, third)
+
+	ifaces, err := r.Interfaces()
+	require.NoError(t, err)
+	assert.Len(t, ifaces, 4)
+
+	dlt, err := r.DLT("three")
+	require.NoError(t, err)
+	assert.Equal(t, "USER0", dlt.Name)
+
+	opts, err := r.ConfigOptions("one")
+	require.NoError(t, err)
+	assert.Empty(t, opts)
+	assert.Len(t, r.AllConfigOptions(), 2)
+
+	_, err = r.DLT("five")
+	assert.ErrorIs(t, err, ErrUnknownInterface)
+
+	assert.Error(t, r.ValidateFilter("one", "tcp and"))
+	assert.NoError(t, r.ValidateFilter("one", "tcp port 80"))
+
+	r.Register(&testSource{ifaces: []CaptureInterface{{"two", "Duplicate"}}})
+	_, err = r.Interfaces()
+	assert.Error(t, err)
+}
+
+func TestControlMessage(t *testing.T) {
+	buf := new(bytes.Buffer)
+	pipes := &controlPipes{out: nopWriteCloser{buf}}
+
+	require.NoError(t, pipes.send(3, ctrlCmdSet, "value"))
+	require.NoError(t, pipes.send(0, ctrlCmdStatusbar, ""))
+
+	number, cmd, payload, err := readControlMessage(buf)
+	require.NoError(t, err)
+	assert.Equal(t, 3, number)
+	assert.Equal(t, ctrlCmdSet, cmd)
+	assert.Equal(t, "value", string(payload))
+
+	_, cmd, payload, err = readControlMessage(buf)
+	require.NoError(t, err)
+	assert.Equal(t, ctrlCmdStatusbar, cmd)
+	assert.Empty(t, payload)
+
+	_, _, _, err = readControlMessage(buf)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestControlString(t *testing.T) {
+	ctrl := NewControlSelector("Time delay").Tooltip("Time delay between packages").Values(
+		SelectorValue{"1", "1 sec", false},
+		SelectorValue{"2", "2 sec", true},
+	)
+	ctrl.number = 1
+
+	expected := "control {number=1}{type=selector}{display=Time delay}{tooltip=Time delay between packages}\n" +
+		"value {control=1}{value=1}{display=1 sec}\n" +
+		"value {control=1}{value=2}{display=2 sec}{default=true}"
+	assert.Equal(t, expected, ctrl.String())
+}
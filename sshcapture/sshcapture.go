@@ -0,0 +1,324 @@
+/*
+Package sshcapture implements remote capture source (like sshdump) built on in-process SSH client.
+
+It connects to the host, checks its key against known_hosts file, runs capture command
+(tcpdump by default) and streams its pcap or pcapng output to the FIFO. Connection is
+checked with keepalive requests, remote command is stopped when capture is stopped.
+
+Usage:
+
+	app := extcap.App{Usage: "remote capture"}
+	app.Register(sshcapture.New())
+	app.Run(os.Args)
+*/
+package sshcapture
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/kor44/extcap"
+	"github.com/kor44/extcap/command"
+)
+
+// ErrNoAuthMethod is returned when neither password nor key file is given
+var ErrNoAuthMethod = errors.New("Password or private key file should be specified")
+
+// DefaultCommand is remote capture command. {interface} and {filter} are replaced
+// with remote interface and capture filter quoted for remote shell.
+const DefaultCommand = "tcpdump -U -i {interface} -w - {filter}"
+
+// Define all options
+var (
+	Host = extcap.NewConfigStringOpt("remote-host", "Remote SSH server address").
+		Required(true).Group("Server")
+	Port = extcap.NewConfigIntegerOpt("remote-port", "Remote SSH server port").
+		Range(1, 65535).Default(22).Group("Server")
+	Username = extcap.NewConfigStringOpt("remote-username", "Remote SSH server username").
+			Group("Authentication")
+	Password = extcap.NewConfigPasswordOpt("remote-password", "Remote SSH server password").
+			Tooltip("Password or passphrase of the private key").Group("Authentication")
+	KeyFile = extcap.NewConfigFileSelectOpt("sshkey", "Path to SSH private key").
+		MustExist(true).Group("Authentication")
+	KnownHosts = extcap.NewConfigFileSelectOpt("known-hosts", "Path to known_hosts file").
+			MustExist(true).Tooltip("Default is ~/.ssh/known_hosts").Group("Authentication")
+	RemoteInterface = extcap.NewConfigStringOpt("remote-interface", "Remote interface").
+			Default("eth0").Group("Capture")
+	RemoteCommand = extcap.NewConfigStringOpt("remote-capture-command", "Remote capture command").
+			Placeholder(DefaultCommand).Tooltip("Command which writes pcap to stdout").Group("Capture")
+)
+
+const (
+	defaultInterface = "sshcapture"
+	dialTimeout      = 10 * time.Second
+)
+
+// Source captures packets on remote host
+type Source struct {
+	// Interface is name of the interface. Default is "sshcapture"
+	Interface string
+
+	// LinkType is reported to Wireshark before capture. Actual link type is taken
+	// from the output of remote command. Default is Ethernet
+	LinkType layers.LinkType
+
+	// KeepAlive is interval of keepalive requests. Capture is stopped when server
+	// doesn't reply. Zero disables keepalives. Default is 15 seconds
+	KeepAlive time.Duration
+}
+
+// New creates source with default settings
+func New() *Source {
+	return &Source{
+		Interface: defaultInterface,
+		LinkType:  layers.LinkTypeEthernet,
+		KeepAlive: 15 * time.Second,
+	}
+}
+
+// Interfaces implements extcap.Source interface
+func (s *Source) Interfaces() ([]extcap.CaptureInterface, error) {
+	return []extcap.CaptureInterface{{Value: s.Interface, Display: "SSH remote capture"}}, nil
+}
+
+// DLT implements extcap.Source interface
+func (s *Source) DLT(iface string) (extcap.DLT, error) {
+	if iface != s.Interface {
+		return extcap.DLT{}, fmt.Errorf("%w '%s'", extcap.ErrUnknownInterface, iface)
+	}
+	return extcap.DLTFromLinkType(s.LinkType), nil
+}
+
+// ConfigOptions implements extcap.ConfigSource interface
+func (s *Source) ConfigOptions(iface string) ([]extcap.ConfigOption, error) {
+	return s.AllConfigOptions(), nil
+}
+
+// AllConfigOptions implements extcap.ConfigSource interface
+func (s *Source) AllConfigOptions() []extcap.ConfigOption {
+	return []extcap.ConfigOption{Host, Port, Username, Password, KeyFile, KnownHosts, RemoteInterface, RemoteCommand}
+}
+
+// StartCapture implements extcap.Source interface
+func (s *Source) StartCapture(iface string, fifo io.WriteCloser, filter string, opts map[string]interface{}) error {
+	defer fifo.Close()
+
+	if iface != s.Interface {
+		return fmt.Errorf("%w '%s'", extcap.ErrUnknownInterface, iface)
+	}
+
+	str := func(opt interface{ Call() string }) string {
+		v, _ := opts[opt.Call()].(string)
+		return v
+	}
+
+	port := 22
+	if v, ok := opts[Port.Call()].(int); ok && v > 0 {
+		port = v
+	}
+	addr := net.JoinHostPort(str(Host), strconv.Itoa(port))
+
+	config, err := clientConfig(str(Username), str(Password), str(KeyFile), str(KnownHosts))
+	if err != nil {
+		return err
+	}
+
+	remoteIface := str(RemoteInterface)
+	if remoteIface == "" {
+		remoteIface = "eth0"
+	}
+	cmd := remoteCommand(str(RemoteCommand), remoteIface, filter)
+
+	extcap.Log().Infof("Connect to %s@%s", config.User, addr)
+	client, err := dial(addr, config)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return s.run(client, cmd, fifo)
+}
+
+// clientConfig returns SSH client configuration. Host key is checked against known_hosts file.
+func clientConfig(user, password, keyFile, knownHostsFile string) (*ssh.ClientConfig, error) {
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read known hosts: %w", err)
+	}
+
+	var auth []ssh.AuthMethod
+	if keyFile != "" {
+		signer, err := loadKey(keyFile, password)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	} else if password != "" {
+		auth = append(auth, ssh.Password(password))
+	}
+	if len(auth) == 0 {
+		return nil, ErrNoAuthMethod
+	}
+
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         dialTimeout,
+	}, nil
+}
+
+// loadKey reads private key, password is used as passphrase of encrypted key
+func loadKey(path, passphrase string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read private key: %w", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) && passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse private key: %w", err)
+	}
+	return signer, nil
+}
+
+// remoteCommand returns command line with replaced placeholders. Values are quoted for remote
+// shell, empty filter is passed as empty quoted string, so flag before it doesn't take the next argument.
+func remoteCommand(cmd, iface, filter string) string {
+	if cmd == "" {
+		cmd = DefaultCommand
+	}
+	return strings.NewReplacer("{interface}", shellQuote(iface), "{filter}", shellQuote(filter)).Replace(cmd)
+}
+
+// shellQuote quotes value as single argument of POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func dial(addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	client, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect to %s: %w", addr, err)
+	}
+	return client, nil
+}
+
+// run executes capture command and copies its output until command exits, writing to
+// the FIFO fails or server stops answering keepalives
+func (s *Source) run(client *ssh.Client, cmd string, w io.Writer) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("Unable to open SSH session: %w", err)
+	}
+	defer session.Close()
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := session.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	extcap.Log().Infof("Run remote command: %s", cmd)
+	if err = session.Start(cmd); err != nil {
+		return fmt.Errorf("Unable to run remote command: %w", err)
+	}
+
+	stopKeepAlive := make(chan struct{})
+	defer close(stopKeepAlive)
+	if s.KeepAlive > 0 {
+		go keepAlive(client, s.KeepAlive, stopKeepAlive)
+	}
+
+	stderrDone := make(chan string)
+	go func() {
+		stderrDone <- command.ForwardStderr(stderr)
+	}()
+
+	err = command.CopyCapture(w, stdout)
+	if err != nil {
+		// stop remote command, closing of the session is not always enough for it
+		session.Signal(ssh.SIGTERM)
+		session.Close()
+		client.Close()
+	}
+
+	lastLine := <-stderrDone
+	waitErr := session.Wait()
+	if err != nil {
+		if errors.Is(err, command.ErrInvalidHeader) && lastLine != "" {
+			err = fmt.Errorf("%w: %s", err, lastLine)
+		}
+		return err
+	}
+	if waitErr != nil {
+		if lastLine != "" {
+			return fmt.Errorf("Remote command failed: %w: %s", waitErr, lastLine)
+		}
+		return fmt.Errorf("Remote command failed: %w", waitErr)
+	}
+	return nil
+}
+
+// keepAlive sends keepalive requests and closes connection when server doesn't reply
+func keepAlive(client *ssh.Client, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		reply := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			reply <- err
+		}()
+
+		select {
+		case <-stop:
+			return
+		case err := <-reply:
+			if err == nil {
+				continue
+			}
+			extcap.Log().Warnf("Keepalive failed: %s", err)
+		case <-time.After(interval):
+			extcap.Log().Warnf("Server doesn't reply to keepalive")
+		}
+		client.Close()
+		return
+	}
+}
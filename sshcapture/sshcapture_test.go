@@ -0,0 +1,170 @@
+package sshcapture
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type nopWriteCloser struct {
+	*bytes.Buffer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// testServer is SSH server which answers every exec request with given output
+type testServer struct {
+	listener net.Listener
+	hostKey  ssh.Signer
+	output   []byte
+	commands chan string
+}
+
+func newTestServer(t *testing.T, output []byte) *testServer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	s := &testServer{listener: l, hostKey: signer, output: output, commands: make(chan string, 10)}
+	go s.serve()
+	return s
+}
+
+func (s *testServer) serve() {
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "user" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	config.AddHostKey(s.hostKey)
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn, config)
+	}
+}
+
+func (s *testServer) handle(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChan := range chans {
+		ch, reqs, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer ch.Close()
+			for req := range reqs {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				req.Reply(true, nil)
+				s.commands <- string(req.Payload[4:])
+
+				ch.Write(s.output)
+				ch.Stderr().Write([]byte("listening on eth0\n"))
+				status := make([]byte, 4)
+				binary.BigEndian.PutUint32(status, 0)
+				ch.SendRequest("exit-status", false, status)
+				return
+			}
+		}()
+	}
+}
+
+func (s *testServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *testServer) knownHosts(t *testing.T, key ssh.PublicKey) string {
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(s.listener.Addr().String())}, key)
+	require.NoError(t, os.WriteFile(path, []byte(line+"\n"), 0600))
+	return path
+}
+
+func TestStartCapture(t *testing.T) {
+	output := []byte("\xd4\xc3\xb2\xa1packets")
+	server := newTestServer(t, output)
+
+	opts := map[string]interface{}{
+		Host.Call():            "127.0.0.1",
+		Port.Call():            server.port(),
+		Username.Call():        "user",
+		Password.Call():        "secret",
+		KnownHosts.Call():      server.knownHosts(t, server.hostKey.PublicKey()),
+		RemoteInterface.Call(): "eth1",
+	}
+
+	out := nopWriteCloser{new(bytes.Buffer)}
+	require.NoError(t, New().StartCapture(defaultInterface, out, "port 53", opts))
+	assert.Equal(t, output, out.Bytes())
+	assert.Equal(t, "tcpdump -U -i 'eth1' -w - 'port 53'", <-server.commands)
+
+	// wrong password
+	opts[Password.Call()] = "wrong"
+	err := New().StartCapture(defaultInterface, nopWriteCloser{new(bytes.Buffer)}, "", opts)
+	assert.ErrorContains(t, err, "unable to authenticate")
+
+	// unknown host key
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := ssh.NewSignerFromKey(other)
+	require.NoError(t, err)
+	opts[Password.Call()] = "secret"
+	opts[KnownHosts.Call()] = server.knownHosts(t, otherKey.PublicKey())
+	err = New().StartCapture(defaultInterface, nopWriteCloser{new(bytes.Buffer)}, "", opts)
+	assert.ErrorContains(t, err, "key mismatch")
+
+	// no authentication
+	delete(opts, Password.Call())
+	err = New().StartCapture(defaultInterface, nopWriteCloser{new(bytes.Buffer)}, "", opts)
+	assert.ErrorIs(t, err, ErrNoAuthMethod)
+}
+
+func TestInvalidOutput(t *testing.T) {
+	server := newTestServer(t, []byte("tcpdump: command not found"))
+
+	opts := map[string]interface{}{
+		Host.Call():       "127.0.0.1",
+		Port.Call():       server.port(),
+		Username.Call():   "user",
+		Password.Call():   "secret",
+		KnownHosts.Call(): server.knownHosts(t, server.hostKey.PublicKey()),
+	}
+
+	err := New().StartCapture(defaultInterface, nopWriteCloser{new(bytes.Buffer)}, "", opts)
+	assert.ErrorContains(t, err, "not pcap")
+}
+
+func TestRemoteCommand(t *testing.T) {
+	assert.Equal(t, "tcpdump -U -i 'eth0' -w - ''", remoteCommand("", "eth0", ""))
+	assert.Equal(t, `dumpcap -i 'eth0;rm -rf ~' -f '' -w -`, remoteCommand("dumpcap -i {interface} -f {filter} -w -", "eth0;rm -rf ~", ""))
+	assert.Equal(t, `dumpcap -i 'any' -f 'host '\''x'\''' -w -`, remoteCommand("dumpcap -i {interface} -f {filter} -w -", "any", "host 'x'"))
+}
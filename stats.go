@@ -0,0 +1,294 @@
+package extcap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// InterfaceStats are counters of the capture interface reported by StartCapture
+type InterfaceStats struct {
+	// Received is number of packets received by the interface
+	Received uint64
+	// Dropped is number of packets dropped by the interface or OS due to lack of resources
+	Dropped uint64
+	// Filtered is number of packets discarded by capture filter of the source
+	Filtered uint64
+}
+
+// statsInterval is how often statistics blocks are written during capture
+const statsInterval = 5 * time.Second
+
+// reportedStats are the last counters reported by StartCapture
+var reportedStats struct {
+	mu    sync.Mutex
+	stats InterfaceStats
+	set   bool
+}
+
+// ReportStats sets counters of the capture interface. It may be called by StartCapture
+// periodically and before return. With App.InterfaceStats counters are written to
+// the fifo as pcapng interface statistics, in any case they are logged when capture ends.
+// Statistics blocks of pcapng written by StartCapture are not passed to the fifo, counters
+// of interface 0 from them are reported instead.
+func ReportStats(stats InterfaceStats) {
+	reportedStats.mu.Lock()
+	defer reportedStats.mu.Unlock()
+
+	reportedStats.stats = stats
+	reportedStats.set = true
+}
+
+func lastReportedStats() (InterfaceStats, bool) {
+	reportedStats.mu.Lock()
+	defer reportedStats.mu.Unlock()
+
+	return reportedStats.stats, reportedStats.set
+}
+
+// streamStats counts packets passing the packet stream
+type streamStats struct {
+	start time.Time
+
+	mu        sync.Mutex
+	read      uint64 // packets written by StartCapture
+	filtered  uint64 // packets dropped by capture filter
+	discarded uint64 // packets dropped by middlewares and other stages
+	written   uint64 // packets passed to the writer, some of them may be dropped by output buffer
+
+	// dropped returns number of packets dropped by output buffer
+	dropped func() uint64
+}
+
+// setDropped sets counter of packets dropped by output buffer
+func (s *streamStats) setDropped(dropped func() uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dropped = dropped
+}
+
+func newStreamStats() *streamStats {
+	return &streamStats{start: time.Now()}
+}
+
+func (s *streamStats) add(read, filtered, discarded, written uint64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.read += read
+	s.filtered += filtered
+	s.discarded += discarded
+	s.written += written
+}
+
+// counters combines counters of the stream with reported by StartCapture
+func (s *streamStats) counters() (received, dropped, accepted, written uint64) {
+	reported, ok := lastReportedStats()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	received = s.read
+	if ok {
+		received = reported.Received
+	}
+	written = s.written
+	dropped = reported.Dropped
+	if s.dropped != nil {
+		bufferDropped := s.dropped()
+		dropped += bufferDropped
+		written -= bufferDropped
+	}
+	if filtered := reported.Filtered + s.filtered; received > filtered {
+		accepted = received - filtered
+	}
+	return received, dropped, accepted, written
+}
+
+// isb returns pcapng interface statistics block for interface 0
+func (s *streamStats) isb(now time.Time) []byte {
+	received, dropped, accepted, written := s.counters()
+	return encodeISB(0, s.start, now, []isbCounter{
+		{isbIfRecv, received},
+		{isbIfDrop, dropped},
+		{isbFilterAccept, accepted},
+		{isbUsrDeliv, written},
+	})
+}
+
+// summary returns message about finished capture. Without packet stream only counters
+// reported by StartCapture are known.
+func (s *streamStats) summary(now time.Time, streamed bool) string {
+	duration := now.Sub(s.start).Round(time.Millisecond)
+	if !streamed {
+		reported, ok := lastReportedStats()
+		if !ok {
+			return fmt.Sprintf("Capture finished in %s", duration)
+		}
+		return fmt.Sprintf("Capture finished in %s: received %d, dropped %d, filtered %d packets",
+			duration, reported.Received, reported.Dropped, reported.Filtered)
+	}
+
+	received, dropped, accepted, written := s.counters()
+	s.mu.Lock()
+	discarded := s.discarded
+	s.mu.Unlock()
+	return fmt.Sprintf("Capture finished in %s: received %d, dropped %d, accepted by filter %d, discarded %d, written %d packets",
+		duration, received, dropped, accepted, discarded, written)
+}
+
+// statsWriter writes statistics blocks periodically, even when no packet is captured,
+// and at the end of the capture. Blocks are written between packets under the lock.
+type statsWriter struct {
+	*ngStreamWriter
+	stats *streamStats
+
+	mu  sync.Mutex
+	err error // error of periodic write, it is returned by the next packet
+
+	stop     chan struct{}
+	finished chan struct{}
+}
+
+func newStatsWriter(w *ngStreamWriter, stats *streamStats, interval time.Duration) *statsWriter {
+	sw := &statsWriter{
+		ngStreamWriter: w,
+		stats:          stats,
+		stop:           make(chan struct{}),
+		finished:       make(chan struct{}),
+	}
+	go sw.run(interval)
+	return sw
+}
+
+func (w *statsWriter) run(interval time.Duration) {
+	defer close(w.finished)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			w.mu.Lock()
+			if w.err == nil {
+				w.err = w.writeStats(now)
+			}
+			w.mu.Unlock()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+func (w *statsWriter) WritePacket(ci gopacket.CaptureInfo, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	return w.ngStreamWriter.WritePacket(ci, data)
+}
+
+func (w *statsWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.ngStreamWriter.Flush()
+}
+
+// Close stops periodic writes and writes final statistics block
+func (w *statsWriter) Close() error {
+	close(w.stop)
+	<-w.finished
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	return w.writeStats(time.Now())
+}
+
+func (w *statsWriter) writeStats(now time.Time) error {
+	if err := w.ngStreamWriter.Flush(); err != nil {
+		return err
+	}
+	_, err := w.dst.Write(w.stats.isb(now))
+	return err
+}
+
+// Option codes of interface statistics block
+const (
+	isbStartTime    = 2
+	isbEndTime      = 3
+	isbIfRecv       = 4
+	isbIfDrop       = 5
+	isbFilterAccept = 6
+	isbUsrDeliv     = 8
+)
+
+type isbCounter struct {
+	code  uint16
+	value uint64
+}
+
+// encodeISB returns little endian interface statistics block. Timestamps are
+// in nanoseconds, resolution of interfaces written by pcapgo.NgWriter.
+func encodeISB(ifaceID uint32, start, end time.Time, counters []isbCounter) []byte {
+	const blockTypeISB = 5
+
+	// header, interface id, timestamp, two timestamp options, counters, end of options, trailing length
+	length := 12 + 8 + 2*12 + len(counters)*12 + 4 + 4
+	b := make([]byte, length)
+	le := binary.LittleEndian
+
+	putTime := func(p []byte, t time.Time) {
+		ts := uint64(t.UnixNano())
+		le.PutUint32(p[0:4], uint32(ts>>32))
+		le.PutUint32(p[4:8], uint32(ts))
+	}
+
+	le.PutUint32(b[0:4], blockTypeISB)
+	le.PutUint32(b[4:8], uint32(length))
+	le.PutUint32(b[8:12], ifaceID)
+	putTime(b[12:20], end)
+
+	off := 20
+	option := func(code uint16) []byte {
+		le.PutUint16(b[off:off+2], code)
+		le.PutUint16(b[off+2:off+4], 8)
+		off += 12
+		return b[off-8 : off]
+	}
+	putTime(option(isbStartTime), start)
+	putTime(option(isbEndTime), end)
+	for _, c := range counters {
+		le.PutUint64(option(c.code), c.value)
+	}
+
+	// end of options is zero
+	le.PutUint32(b[length-4:], uint32(length))
+	return b
+}
+
+// readStats passes statistics block of pcapng written by StartCapture to ReportStats
+func readStats(id int, stats pcapgo.NgInterfaceStatistics) {
+	if id != 0 || stats.PacketsReceived == pcapgo.NgNoValue64 {
+		return
+	}
+	dropped := stats.PacketsDropped
+	if dropped == pcapgo.NgNoValue64 {
+		dropped = 0
+	}
+	ReportStats(InterfaceStats{Received: stats.PacketsReceived, Dropped: dropped})
+}
@@ -0,0 +1,167 @@
+package extcap
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readStatsBlocks returns packets and statistics of interface 0 read from pcapng stream
+func readStatsBlocks(t *testing.T, data []byte) (int, []pcapgo.NgInterfaceStatistics) {
+	var stats []pcapgo.NgInterfaceStatistics
+	r, err := pcapgo.NewNgReader(bytes.NewReader(data), pcapgo.NgReaderOptions{
+		StatisticsCallback: func(id int, s pcapgo.NgInterfaceStatistics) {
+			assert.Equal(t, 0, id)
+			stats = append(stats, s)
+		},
+	})
+	require.NoError(t, err)
+
+	packets := 0
+	for {
+		_, _, err := r.ReadPacketData()
+		if err == io.EOF {
+			return packets, stats
+		}
+		require.NoError(t, err)
+		packets++
+	}
+}
+
+func resetReportedStats() {
+	reportedStats.mu.Lock()
+	defer reportedStats.mu.Unlock()
+
+	reportedStats.stats = InterfaceStats{}
+	reportedStats.set = false
+}
+
+func TestEncodeISB(t *testing.T) {
+	out := new(bytes.Buffer)
+	w, err := pcapgo.NewNgWriter(out, layers.LinkTypeEthernet)
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+
+	start := time.Unix(1700000000, 123456789)
+	end := start.Add(time.Minute)
+	out.Write(encodeISB(0, start, end, []isbCounter{{isbIfRecv, 10}, {isbIfDrop, 2}, {isbFilterAccept, 7}, {isbUsrDeliv, 5}}))
+
+	packets, stats := readStatsBlocks(t, out.Bytes())
+	assert.Equal(t, 0, packets)
+	require.Len(t, stats, 1)
+	assert.Equal(t, uint64(10), stats[0].PacketsReceived)
+	assert.Equal(t, uint64(2), stats[0].PacketsDropped)
+	assert.True(t, stats[0].StartTime.Equal(start))
+	assert.True(t, stats[0].LastUpdate.Equal(end))
+}
+
+func TestPacketStreamStats(t *testing.T) {
+	resetReportedStats()
+	defer resetReportedStats()
+
+	b, err := NewPacketBuilder(layers.LinkTypeEthernet)
+	require.NoError(t, err)
+	flows := []Flow{
+		{layers.IPProtocolUDP, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 5000, 514},
+		{layers.IPProtocolTCP, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 40000, 8080},
+	}
+
+	out := new(bytes.Buffer)
+	stats := newStreamStats()
+	// middleware drops the second packet which passes the filter
+	packets := 0
+	dropSecond := middlewareStage(nil, MiddlewareFunc(func(linkType layers.LinkType, opts map[string]interface{}) (PacketFunc, error) {
+		return func(ci *gopacket.CaptureInfo, data []byte) ([]byte, error) {
+			if packets++; packets == 2 {
+				return nil, nil
+			}
+			return data, nil
+		}, nil
+	}))
+	stream := newPacketStreamConfig(nopWriteCloser{out}, []stageFunc{filterStage("udp port 514"), dropSecond},
+		streamConfig{stats: stats, isb: true, filters: 1})
+
+	// pcap input is converted to pcapng
+	w := pcapgo.NewWriter(stream)
+	require.NoError(t, w.WriteFileHeader(65535, layers.LinkTypeEthernet))
+	for i := 0; i < 6; i++ {
+		frame, err := b.Build(flows[i%2], []byte{byte(i)})
+		require.NoError(t, err)
+		ci := gopacket.CaptureInfo{Timestamp: time.Now(), CaptureLength: len(frame), Length: len(frame)}
+		require.NoError(t, w.WritePacket(ci, frame))
+	}
+	require.NoError(t, stream.Close())
+
+	written, blocks := readStatsBlocks(t, out.Bytes())
+	assert.Equal(t, 2, written)
+	require.NotEmpty(t, blocks)
+	final := blocks[len(blocks)-1]
+	assert.Equal(t, uint64(6), final.PacketsReceived)
+	assert.Equal(t, uint64(0), final.PacketsDropped)
+
+	received, dropped, accepted, delivered := stats.counters()
+	assert.Equal(t, []uint64{6, 0, 3, 2}, []uint64{received, dropped, accepted, delivered})
+
+	// counters reported by StartCapture replace counted by the stream
+	ReportStats(InterfaceStats{Received: 10, Dropped: 1, Filtered: 2})
+	assert.Contains(t, stats.summary(time.Now(), true), "received 10, dropped 1, accepted by filter 5, discarded 1, written 2 packets")
+	assert.Contains(t, stats.summary(time.Now(), false), "received 10, dropped 1, filtered 2 packets")
+}
+
+// lockedBuffer is output of the stream read while statistics are written
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Close() error { return nil }
+
+func (b *lockedBuffer) bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+func TestPacketStreamPeriodicStats(t *testing.T) {
+	resetReportedStats()
+	defer resetReportedStats()
+
+	b, err := NewPacketBuilder(layers.LinkTypeEthernet)
+	require.NoError(t, err)
+	frame, err := b.Build(Flow{layers.IPProtocolUDP, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 5000, 514}, nil)
+	require.NoError(t, err)
+
+	out := new(lockedBuffer)
+	stream := newPacketStreamConfig(out, nil, streamConfig{stats: newStreamStats(), isb: true, isbInterval: 10 * time.Millisecond})
+	w := pcapgo.NewWriter(stream)
+	require.NoError(t, w.WriteFileHeader(65535, layers.LinkTypeEthernet))
+	ci := gopacket.CaptureInfo{Timestamp: time.Now(), CaptureLength: len(frame), Length: len(frame)}
+	require.NoError(t, w.WritePacket(ci, frame))
+
+	// counters reported by StartCapture are written without further packets
+	ReportStats(InterfaceStats{Received: 7, Dropped: 1})
+	require.Eventually(t, func() bool {
+		_, blocks := readStatsBlocks(t, out.bytes())
+		return len(blocks) > 0 && blocks[len(blocks)-1].PacketsReceived == 7
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, stream.Close())
+	written, blocks := readStatsBlocks(t, out.bytes())
+	assert.Equal(t, 1, written)
+	assert.Equal(t, uint64(1), blocks[len(blocks)-1].PacketsDropped)
+}
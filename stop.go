@@ -0,0 +1,47 @@
+package extcap
+
+import (
+	"math"
+	"time"
+
+	"github.com/google/gopacket"
+)
+
+// Stop condition options. They are added to config of every interface when App.StopConditions is set.
+// Zero value of the option disables the condition.
+var (
+	MaxPackets = NewConfigIntegerOpt("max-packets", "Stop after packets").
+			Range(0, math.MaxInt32).Default(0).Group("Stop").Tooltip("Stop capture after this number of packets, 0 is unlimited")
+	MaxBytes = NewConfigIntegerOpt("max-bytes", "Stop after bytes").
+			Range(0, math.MaxInt32).Default(0).Group("Stop").Tooltip("Stop capture after this number of bytes, 0 is unlimited")
+	MaxDuration = NewConfigIntegerOpt("max-duration", "Stop after seconds").
+			Range(0, math.MaxInt32).Default(0).Group("Stop").Tooltip("Stop capture after this number of seconds, 0 is unlimited")
+)
+
+// stopGrace is time given to StartCapture to return after stop condition is met
+const stopGrace = 2 * time.Second
+
+func stopOptions() []ConfigOption {
+	return []ConfigOption{MaxPackets, MaxBytes, MaxDuration}
+}
+
+// stopStage passes packets until maxPackets packets or maxBytes bytes are written.
+// The packet which reaches the limit is the last one.
+func stopStage(maxPackets, maxBytes int) stageFunc {
+	return func(info streamInfo) (PacketFunc, error) {
+		var packets, bytes int
+		return func(ci *gopacket.CaptureInfo, data []byte) ([]byte, error) {
+			packets++
+			bytes += len(data)
+			switch {
+			case maxPackets > 0 && packets >= maxPackets:
+				logger.Infof("Capture stopped after %d packets", packets)
+				return data, ErrCaptureStopped
+			case maxBytes > 0 && bytes >= maxBytes:
+				logger.Infof("Capture stopped after %d bytes", bytes)
+				return data, ErrCaptureStopped
+			}
+			return data, nil
+		}, nil
+	}
+}
@@ -0,0 +1,473 @@
+package extcap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// stageFunc creates PacketFunc for the stream described by info.
+// It is called when file header is received from StartCapture. nil PacketFunc is skipped.
+type stageFunc func(info streamInfo) (PacketFunc, error)
+
+// streamInfo describes stream written by StartCapture
+type streamInfo struct {
+	linkType layers.LinkType
+	snaplen  uint32
+
+	// iface returns description of the interface with given index. It can be called
+	// by PacketFunc for InterfaceIndex of the packet. pcap stream has single interface.
+	iface func(index int) (pcapgo.NgInterface, error)
+}
+
+// describe returns description of the stream read by reader
+func describe(reader packetReader) (streamInfo, error) {
+	if r, ok := reader.(*ngStreamReader); ok {
+		return streamInfo{linkType: r.first.LinkType, snaplen: r.first.SnapLength, iface: r.Interface}, nil
+	}
+
+	r := reader.(*pcapgo.Reader)
+	intf := pcapgo.DefaultNgInterface
+	intf.LinkType = r.LinkType()
+	intf.SnapLength = r.Snaplen()
+	return streamInfo{
+		linkType: intf.LinkType,
+		snaplen:  intf.SnapLength,
+		iface: func(index int) (pcapgo.NgInterface, error) {
+			if index != 0 {
+				return pcapgo.NgInterface{}, fmt.Errorf("Unknown interface %d of pcap stream", index)
+			}
+			return intf, nil
+		},
+	}, nil
+}
+
+type packetReader interface {
+	ReadPacketData() ([]byte, gopacket.CaptureInfo, error)
+	LinkType() layers.LinkType
+}
+
+type packetWriter interface {
+	WritePacket(ci gopacket.CaptureInfo, data []byte) error
+	Flush() error
+}
+
+// packetStream is placed between StartCapture and the FIFO. It decodes pcap or pcapng
+// stream written by StartCapture, passes every packet through the stages and writes
+// result to the FIFO in the same format. Only packets and interface descriptions are
+// written: statistics, name resolution and other blocks of pcapng input are dropped
+// along with comments.
+type packetStream struct {
+	pr     *io.PipeReader
+	pw     *io.PipeWriter
+	dst    io.WriteCloser
+	stages []stageFunc
+	config streamConfig
+	done   chan struct{}
+	err    error
+
+	// stopped is set when stream is finished by stop condition
+	stopped bool
+}
+
+// streamConfig sets optional features of packet stream
+type streamConfig struct {
+	// buffer enables asynchronous writing to the FIFO when its size is set
+	buffer bufferConfig
+
+	// stats counts packets of the stream
+	stats *streamStats
+
+	// isb enables pcapng output with interface statistics blocks, stats should be set
+	isb bool
+
+	// isbInterval is period of interface statistics blocks, statsInterval if 0
+	isbInterval time.Duration
+
+	// filters is number of the first stages which are capture filters. Packets dropped
+	// by them are counted as filtered, packets dropped by other stages as discarded.
+	filters int
+}
+
+func newPacketStream(dst io.WriteCloser, stages []stageFunc) *packetStream {
+	return newPacketStreamConfig(dst, stages, streamConfig{})
+}
+
+func newPacketStreamConfig(dst io.WriteCloser, stages []stageFunc, config streamConfig) *packetStream {
+	pr, pw := io.Pipe()
+	s := &packetStream{
+		pr:     pr,
+		pw:     pw,
+		dst:    dst,
+		stages: stages,
+		config: config,
+		done:   make(chan struct{}),
+	}
+
+	go s.run()
+	return s
+}
+
+// stopAfter stops the stream when duration d elapses
+func (s *packetStream) stopAfter(d time.Duration) {
+	t := time.AfterFunc(d, func() {
+		logger.Infof("Capture stopped after %s", d)
+		s.pr.CloseWithError(ErrCaptureStopped)
+	})
+	go func() {
+		<-s.done
+		t.Stop()
+	}()
+}
+
+// Write implements io.Writer
+func (s *packetStream) Write(p []byte) (int, error) {
+	return s.pw.Write(p)
+}
+
+// Close finishes stream and waits until all packets are written to the FIFO.
+// It is safe to call Close several times.
+func (s *packetStream) Close() error {
+	s.pw.Close()
+	<-s.done
+	return s.err
+}
+
+// Done returns channel which is closed when the stream is finished, e.g. by stop condition.
+// Sources which run child processes use it to stop them when StartCapture is abandoned.
+func (s *packetStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// isStopped reports whether the stream is finished by stop condition
+func (s *packetStream) isStopped() bool {
+	select {
+	case <-s.done:
+		return s.stopped
+	default:
+		return false
+	}
+}
+
+func (s *packetStream) run() {
+	defer close(s.done)
+
+	err := s.copy(s.pr)
+	if closeErr := s.dst.Close(); err == nil {
+		err = closeErr
+	}
+
+	// reader is closed during copying only by stopAfter. Writes of StartCapture
+	// fail with ErrCaptureStopped, but the stream is finished successfully.
+	if errors.Is(err, ErrCaptureStopped) || errors.Is(err, io.ErrClosedPipe) {
+		s.stopped = true
+		s.pr.CloseWithError(ErrCaptureStopped)
+		return
+	}
+	if err != nil {
+		s.err = err
+		s.pr.CloseWithError(err)
+		return
+	}
+	s.pr.Close()
+}
+
+func (s *packetStream) copy(r io.Reader) error {
+	br := bufio.NewReaderSize(r, maxHeaderSize)
+	magic, err := br.Peek(4)
+	if err == io.EOF {
+		// nothing was written by StartCapture
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	reader, writer, err := s.open(br, magic)
+	if err != nil {
+		return err
+	}
+
+	info, err := describe(reader)
+	if err != nil {
+		return err
+	}
+	funcs := make([]PacketFunc, 0, len(s.stages))
+	filters := 0
+	for i, stage := range s.stages {
+		f, err := stage(info)
+		if err != nil {
+			return err
+		}
+		if f != nil {
+			funcs = append(funcs, f)
+			if i < s.config.filters {
+				filters++
+			}
+		}
+	}
+
+	var sw *statsWriter
+	if s.config.isb {
+		interval := s.config.isbInterval
+		if interval == 0 {
+			interval = statsInterval
+		}
+		sw = newStatsWriter(writer.(*ngStreamWriter), s.config.stats, interval)
+		writer = sw
+	}
+
+	var bw *bufferedWriter
+	if s.config.buffer.size > 0 {
+		bw = newBufferedWriter(writer, s.config.buffer)
+		if s.config.stats != nil {
+			s.config.stats.setDropped(bw.droppedPackets)
+		}
+		writer = bw
+	}
+
+	err = s.copyPackets(reader, writer, funcs, filters)
+	if bw != nil {
+		if closeErr := bw.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if sw != nil {
+		if statsErr := sw.Close(); err == nil {
+			err = statsErr
+		}
+	}
+	return err
+}
+
+// copyPackets passes packets through funcs, the first filters of them are capture filters
+func (s *packetStream) copyPackets(reader packetReader, writer packetWriter, funcs []PacketFunc, filters int) error {
+	for {
+		data, ci, err := reader.ReadPacketData()
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Unable to read packet from capture: %w", err)
+		}
+		s.config.stats.add(1, 0, 0, 0)
+
+		var stopErr error
+		dropped := 0
+		for i, f := range funcs {
+			if data, err = f(&ci, data); err != nil || data == nil {
+				dropped = i
+				break
+			}
+		}
+		if errors.Is(err, ErrCaptureStopped) {
+			stopErr, err = err, nil
+		}
+		if err != nil {
+			return err
+		}
+		if data == nil && dropped < filters {
+			s.config.stats.add(0, 1, 0, 0)
+		} else if data == nil {
+			s.config.stats.add(0, 0, 1, 0)
+		} else {
+			if c, ok := reader.(interfaceCollector); ok {
+				if err = c.collect(ci); err != nil {
+					return err
+				}
+			}
+			if err = writer.WritePacket(ci, data); err != nil {
+				return err
+			}
+			s.config.stats.add(0, 0, 0, 1)
+			if err = writer.Flush(); err != nil {
+				return err
+			}
+		}
+		if stopErr != nil {
+			return stopErr
+		}
+	}
+}
+
+// open creates reader and writer for the format of the stream
+func (s *packetStream) open(r *bufio.Reader, magic []byte) (packetReader, packetWriter, error) {
+	if magic[0] == 0x0a && magic[1] == 0x0d && magic[2] == 0x0d && magic[3] == 0x0a {
+		intf, err := peekNgInterface(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid pcapng stream: %w", err)
+		}
+
+		// packets of interfaces with other link types are not skipped
+		options := pcapgo.NgReaderOptions{StatisticsCallback: readStats, WantMixedLinkType: true}
+		ngReader, err := pcapgo.NewNgReader(r, options)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid pcapng stream: %w", err)
+		}
+
+		ngWriter, err := pcapgo.NewNgWriterInterface(s.dst, intf, pcapgo.DefaultNgWriterOptions)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		w := &ngStreamWriter{NgWriter: ngWriter, dst: s.dst, known: []pcapgo.NgInterface{intf}, interfaces: 1}
+		return &ngStreamReader{NgReader: ngReader, writer: w, first: intf}, w, nil
+	}
+
+	pcapReader, err := pcapgo.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Invalid pcap stream: %w", err)
+	}
+
+	// statistics are written only to pcapng
+	if s.config.isb {
+		intf := pcapgo.DefaultNgInterface
+		intf.LinkType = pcapReader.LinkType()
+		intf.SnapLength = pcapReader.Snaplen()
+		ngWriter, err := pcapgo.NewNgWriterInterface(s.dst, intf, pcapgo.DefaultNgWriterOptions)
+		if err != nil {
+			return nil, nil, err
+		}
+		return pcapReader, &ngStreamWriter{NgWriter: ngWriter, dst: s.dst, known: []pcapgo.NgInterface{intf}, interfaces: 1}, nil
+	}
+
+	w := pcapgo.NewWriter(s.dst)
+	if pcapReader.Resolution().Exponent == -9 {
+		w = pcapgo.NewWriterNanos(s.dst)
+	}
+	if err = w.WriteFileHeader(pcapReader.Snaplen(), pcapReader.LinkType()); err != nil {
+		return nil, nil, err
+	}
+
+	return pcapReader, pcapStreamWriter{w}, nil
+}
+
+// pcapStreamWriter writes directly to the FIFO, so it need not be flushed
+type pcapStreamWriter struct {
+	*pcapgo.Writer
+}
+
+func (pcapStreamWriter) Flush() error {
+	return nil
+}
+
+// interfaceCollector is reader which should see every packet before it is passed to the writer
+type interfaceCollector interface {
+	collect(ci gopacket.CaptureInfo) error
+}
+
+// ngStreamReader passes descriptions of interfaces to the writer as they appear in the input.
+// It is done by reading goroutine, because writer may be run by another one.
+type ngStreamReader struct {
+	*pcapgo.NgReader
+	writer *ngStreamWriter
+	first  pcapgo.NgInterface // the first interface of the stream
+}
+
+// LinkType returns link type of the first interface. Reader of mixed link types
+// knows interfaces only after their packets are read.
+func (r *ngStreamReader) LinkType() layers.LinkType {
+	return r.first.LinkType
+}
+
+// Interface returns description of the interface with given index
+func (r *ngStreamReader) Interface(index int) (pcapgo.NgInterface, error) {
+	if index == 0 {
+		return r.first, nil
+	}
+	return r.NgReader.Interface(index)
+}
+
+// maxHeaderSize limits size of pcapng blocks preceding the first interface description
+const maxHeaderSize = 64 << 10
+
+// peekNgInterface returns the first interface description of pcapng stream without consuming it.
+// Reader of mixed link types reads interfaces only together with packets.
+func peekNgInterface(r *bufio.Reader) (pcapgo.NgInterface, error) {
+	header, err := r.Peek(12)
+	if err != nil {
+		return pcapgo.NgInterface{}, err
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if binary.BigEndian.Uint32(header[8:]) == 0x1a2b3c4d {
+		order = binary.BigEndian
+	}
+
+	// blocks are skipped until interface description block
+	off := 0
+	for {
+		header, err = r.Peek(off + 8)
+		if err != nil {
+			return pcapgo.NgInterface{}, err
+		}
+		typ, length := order.Uint32(header[off:]), int(order.Uint32(header[off+4:]))
+		if length < 12 {
+			return pcapgo.NgInterface{}, fmt.Errorf("invalid length of block %d", length)
+		}
+		off += length
+		if typ == 1 {
+			break
+		}
+	}
+
+	data, err := r.Peek(off)
+	if err != nil {
+		return pcapgo.NgInterface{}, err
+	}
+	ngReader, err := pcapgo.NewNgReader(bytes.NewReader(data), pcapgo.DefaultNgReaderOptions)
+	if err != nil {
+		return pcapgo.NgInterface{}, err
+	}
+	return ngReader.Interface(0)
+}
+
+func (r *ngStreamReader) collect(ci gopacket.CaptureInfo) error {
+	w := r.writer
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for ci.InterfaceIndex >= len(w.known) {
+		intf, err := r.Interface(len(w.known))
+		if err != nil {
+			return err
+		}
+		w.known = append(w.known, intf)
+	}
+	return nil
+}
+
+// ngStreamWriter adds interfaces to the output as they appear in the input
+type ngStreamWriter struct {
+	*pcapgo.NgWriter
+	dst io.Writer
+
+	mu         sync.Mutex
+	known      []pcapgo.NgInterface // interfaces collected from the input
+	interfaces int                  // number of interfaces added to the output
+}
+
+func (w *ngStreamWriter) WritePacket(ci gopacket.CaptureInfo, data []byte) error {
+	w.mu.Lock()
+	added := w.known[w.interfaces:]
+	w.mu.Unlock()
+
+	for _, intf := range added {
+		if ci.InterfaceIndex < w.interfaces {
+			break
+		}
+		if _, err := w.AddInterface(intf); err != nil {
+			return err
+		}
+		w.interfaces++
+	}
+	return w.NgWriter.WritePacket(ci, data)
+}
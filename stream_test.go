@@ -0,0 +1,202 @@
+package extcap
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// readAll returns payloads of all packets of pcap or pcapng stream
+func readAll(t *testing.T, data []byte) [][]byte {
+	var r interface {
+		ReadPacketData() ([]byte, gopacket.CaptureInfo, error)
+		LinkType() layers.LinkType
+	}
+	var err error
+	if bytes.HasPrefix(data, []byte{0x0a, 0x0d, 0x0d, 0x0a}) {
+		r, err = pcapgo.NewNgReader(bytes.NewReader(data), pcapgo.DefaultNgReaderOptions)
+	} else {
+		r, err = pcapgo.NewReader(bytes.NewReader(data))
+	}
+	require.NoError(t, err)
+
+	var payloads [][]byte
+	for {
+		frame, _, err := r.ReadPacketData()
+		if err == io.EOF {
+			return payloads
+		}
+		require.NoError(t, err)
+		packet := gopacket.NewPacket(frame, r.LinkType(), gopacket.Default)
+		payloads = append(payloads, packet.ApplicationLayer().Payload())
+	}
+}
+
+func TestPacketStreamFilter(t *testing.T) {
+	b, err := NewPacketBuilder(layers.LinkTypeEthernet)
+	require.NoError(t, err)
+	flows := []Flow{
+		{layers.IPProtocolUDP, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 5000, 514},
+		{layers.IPProtocolTCP, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 40000, 8080},
+	}
+
+	for _, format := range []string{"pcap", "pcapng"} {
+		t.Run(format, func(t *testing.T) {
+			out := new(bytes.Buffer)
+			stream := newPacketStream(nopWriteCloser{out}, []stageFunc{filterStage("udp port 514")})
+
+			var w interface {
+				WritePacket(gopacket.CaptureInfo, []byte) error
+			}
+			if format == "pcap" {
+				pw := pcapgo.NewWriter(stream)
+				require.NoError(t, pw.WriteFileHeader(65535, layers.LinkTypeEthernet))
+				w = pw
+			} else {
+				nw, err := pcapgo.NewNgWriter(stream, layers.LinkTypeEthernet)
+				require.NoError(t, err)
+				w = nw
+			}
+
+			for i := 0; i < 4; i++ {
+				frame, err := b.Build(flows[i%2], []byte{byte(i)})
+				require.NoError(t, err)
+				ci := gopacket.CaptureInfo{Timestamp: time.Now(), CaptureLength: len(frame), Length: len(frame)}
+				require.NoError(t, w.WritePacket(ci, frame))
+			}
+			if nw, ok := w.(*pcapgo.NgWriter); ok {
+				require.NoError(t, nw.Flush())
+			}
+
+			require.NoError(t, stream.Close())
+			assert.Equal(t, [][]byte{{0}, {2}}, readAll(t, out.Bytes()))
+		})
+	}
+}
+
+func TestPacketStreamFilterInterfaces(t *testing.T) {
+	flow := Flow{layers.IPProtocolUDP, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 5000, 514}
+	other := Flow{layers.IPProtocolUDP, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 5000, 53}
+
+	out := new(bytes.Buffer)
+	stream := newPacketStream(nopWriteCloser{out}, []stageFunc{filterStage("udp port 514")})
+	w, err := pcapgo.NewNgWriter(stream, layers.LinkTypeEthernet)
+	require.NoError(t, err)
+	raw, err := w.AddInterface(pcapgo.NgInterface{Name: "tun0", LinkType: layers.LinkTypeRaw})
+	require.NoError(t, err)
+
+	// filter is matched with offsets of link type of every interface
+	for i, linkType := range []layers.LinkType{layers.LinkTypeEthernet, layers.LinkTypeRaw} {
+		b, err := NewPacketBuilder(linkType)
+		require.NoError(t, err)
+		for j, f := range []Flow{flow, other} {
+			frame, err := b.Build(f, []byte{byte(2*i + j)})
+			require.NoError(t, err)
+			ci := gopacket.CaptureInfo{Timestamp: time.Now(), CaptureLength: len(frame), Length: len(frame), InterfaceIndex: i * raw}
+			require.NoError(t, w.WritePacket(ci, frame))
+		}
+	}
+	require.NoError(t, w.Flush())
+	require.NoError(t, stream.Close())
+
+	r, err := pcapgo.NewNgReader(bytes.NewReader(out.Bytes()), pcapgo.NgReaderOptions{WantMixedLinkType: true})
+	require.NoError(t, err)
+	var payloads []byte
+	for {
+		data, ci, err := r.ReadPacketData()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		intf, err := r.Interface(ci.InterfaceIndex)
+		require.NoError(t, err)
+		payloads = append(payloads, data[len(data)-1])
+		packet := gopacket.NewPacket(data, intf.LinkType, gopacket.Default)
+		require.NotNil(t, packet.Layer(layers.LayerTypeUDP))
+	}
+	assert.Equal(t, []byte{0, 2}, payloads)
+}
+
+func TestPacketStreamInvalidFilter(t *testing.T) {
+	stream := newPacketStream(nopWriteCloser{io.Discard}, []stageFunc{filterStage("port")})
+
+	w := pcapgo.NewWriter(stream)
+	w.WriteFileHeader(65535, layers.LinkTypeEthernet)
+	_, err := stream.Write(make([]byte, 64))
+	assert.Error(t, err)
+	assert.Error(t, stream.Close())
+}
+
+func TestPacketStreamStop(t *testing.T) {
+	b, err := NewPacketBuilder(layers.LinkTypeEthernet)
+	require.NoError(t, err)
+	flow := Flow{layers.IPProtocolUDP, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 5000, 514}
+
+	tests := []struct {
+		name       string
+		maxPackets int
+		maxBytes   int
+		expected   [][]byte
+	}{
+		{"packets", 2, 0, [][]byte{{0}, {1}}},
+		{"bytes", 0, 120, [][]byte{{0}, {1}}},
+		{"both", 3, 1, [][]byte{{0}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := new(bytes.Buffer)
+			stream := newPacketStream(nopWriteCloser{out}, []stageFunc{stopStage(tt.maxPackets, tt.maxBytes)})
+
+			w := pcapgo.NewWriter(stream)
+			require.NoError(t, w.WriteFileHeader(65535, layers.LinkTypeEthernet))
+
+			var err error
+			for i := 0; i < 10 && err == nil; i++ {
+				frame, buildErr := b.Build(flow, []byte{byte(i)})
+				require.NoError(t, buildErr)
+				ci := gopacket.CaptureInfo{Timestamp: time.Now(), CaptureLength: len(frame), Length: len(frame)}
+				err = w.WritePacket(ci, frame)
+			}
+			assert.ErrorContains(t, err, ErrCaptureStopped.Error())
+
+			require.NoError(t, stream.Close())
+			assert.True(t, stream.isStopped())
+			assert.Equal(t, tt.expected, readAll(t, out.Bytes()))
+		})
+	}
+}
+
+func TestPacketStreamStopAfter(t *testing.T) {
+	out := new(bytes.Buffer)
+	stream := newPacketStream(nopWriteCloser{out}, nil)
+	stream.stopAfter(20 * time.Millisecond)
+
+	w := pcapgo.NewWriter(stream)
+	require.NoError(t, w.WriteFileHeader(65535, layers.LinkTypeEthernet))
+
+	var err error
+	start := time.Now()
+	for err == nil && time.Since(start) < time.Second {
+		err = w.WritePacket(gopacket.CaptureInfo{Timestamp: time.Now(), CaptureLength: 1, Length: 1}, []byte{0})
+		time.Sleep(time.Millisecond)
+	}
+	assert.ErrorContains(t, err, ErrCaptureStopped.Error())
+	assert.Less(t, time.Since(start), time.Second)
+	assert.NoError(t, stream.Close())
+	assert.True(t, stream.isStopped())
+}
@@ -38,15 +38,40 @@ func TestStringerInterface(t *testing.T) {
 			"arg {number=0}{call=--message}{display=Message}{type=string}{tooltip=Package message content}{placeholder=Please enter a message here ...}",
 		},
 
+		{"Config String option required",
+			NewConfigStringOpt("host", "Host").Required(true).Group("Server"),
+			"arg {number=0}{call=--host}{display=Host}{type=string}{required=true}{group=Server}",
+		},
+
 		{"Config Bool option",
 			NewConfigBoolOpt("verify", "Verify").Tooltip("Verify package content"),
 			"arg {number=0}{call=--verify}{display=Verify}{type=boolflag}{tooltip=Verify package content}",
 		},
 
-		// arg {number=3}{call=--remote}{display=Remote Channel}{tooltip=Remote Channel Selector}{type=selector}
-		//
-		// value {arg=3}{value=if1}{display=Remote1}{default=true}
-		// value {arg=3}{value=if2}{display=Remote2}{default=false}
+		{"Config Password option",
+			NewConfigPasswordOpt("password", "Password").Required(true),
+			"arg {number=0}{call=--password}{display=Password}{type=password}{required=true}",
+		},
+
+		{"Config Double option",
+			NewConfigDoubleOpt("speed", "Speed").Range(0.1, 10).Default(1),
+			"arg {number=0}{call=--speed}{display=Speed}{type=double}{range=0.1,10}{default=1}",
+		},
+
+		{"Config FileSelect option",
+			NewConfigFileSelectOpt("file", "Capture file").MustExist(true).FileExt("Capture files (*.pcap *.pcapng)"),
+			"arg {number=0}{call=--file}{display=Capture file}{type=fileselect}{mustexist=true}{fileext=Capture files (*.pcap *.pcapng)}",
+		},
+
+		{"Config Selector option",
+			NewConfigSelectorOpt("remote", "Remote Channel").Tooltip("Remote Channel Selector").Values(
+				SelectorValue{"if1", "Remote1", true},
+				SelectorValue{"if2", "Remote2", false},
+			),
+			"arg {number=0}{call=--remote}{display=Remote Channel}{type=selector}{tooltip=Remote Channel Selector}\n" +
+				"value {arg=0}{value=if1}{display=Remote1}{default=true}\n" +
+				"value {arg=0}{value=if2}{display=Remote2}{default=false}",
+		},
 	}
 
 	for _, tc := range testCases {
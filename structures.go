@@ -4,16 +4,23 @@ import (
 	"fmt"
 )
 
-//
+// VersionInfo describes extcap application
 type VersionInfo struct {
 	Info string
 	Help string
+
+	// Display is name of the application shown by Wireshark 3.0 and newer. Optional
+	Display string
 }
 
 // Format to string in format
-// extcap {version=0.1.0}{help=<some help or URL}
+// extcap {version=0.1.0}{help=<some help or URL}{display=Example extcap}
 func (ver VersionInfo) String() string {
-	return fmt.Sprintf("extcap {version=%s}{help=%s}", ver.Info, ver.Help)
+	str := fmt.Sprintf("extcap {version=%s}{help=%s}", ver.Info, ver.Help)
+	if ver.Display != "" && Supports(FeatureExtcapDisplay) {
+		str += fmt.Sprintf("{display=%s}", ver.Display)
+	}
+	return str
 }
 
 // CaptureInterface represents single network interface for capture
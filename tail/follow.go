@@ -0,0 +1,140 @@
+package tail
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// follower reads lines appended to the file like "tail -F". When the file is rotated
+// (replaced with new file) rest of the old file is read and then new file is opened.
+// When the file is truncated, it is read from the beginning.
+type follower struct {
+	path string
+	poll time.Duration
+
+	file    *os.File
+	reader  *bufio.Reader
+	offset  int64
+	partial string
+	rotated bool // the file is replaced, new one is opened when the old one is read
+}
+
+// newFollower opens the file. If fromStart is false, only lines appended later are read.
+func newFollower(path string, fromStart bool, poll time.Duration) (*follower, error) {
+	f := &follower{path: path, poll: poll}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	if !fromStart {
+		offset, err := f.file.Seek(0, io.SeekEnd)
+		if err != nil {
+			f.close()
+			return nil, err
+		}
+		f.offset = offset
+	}
+	return f, nil
+}
+
+func (f *follower) open() error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+
+	f.close()
+	f.file = file
+	f.reader = bufio.NewReader(file)
+	f.offset = 0
+	f.partial = ""
+	f.rotated = false
+	return nil
+}
+
+func (f *follower) close() {
+	if f.file != nil {
+		f.file.Close()
+	}
+}
+
+// run passes lines without line terminator to handle. When there is no new data, idle is
+// called before waiting. It returns first error of the callbacks.
+func (f *follower) run(handle func(line string) error, idle func() error) error {
+	defer f.close()
+
+	for {
+		line, err := f.reader.ReadString('\n')
+		f.offset += int64(len(line))
+		if err == nil {
+			line = f.partial + line
+			f.partial = ""
+			if err = handle(trimEOL(line)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != io.EOF {
+			return err
+		}
+
+		// keep incomplete line until it is finished
+		f.partial += line
+
+		if f.rotated {
+			if f.partial != "" {
+				if err = handle(trimEOL(f.partial)); err != nil {
+					return err
+				}
+			}
+			if err = f.open(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err = idle(); err != nil {
+			return err
+		}
+		time.Sleep(f.poll)
+
+		if err = f.checkRotation(); err != nil {
+			return err
+		}
+	}
+}
+
+// checkRotation reopens the file when it is replaced or truncated
+func (f *follower) checkRotation() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		// file is being rotated, old file is still read
+		return nil
+	}
+
+	current, err := f.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !os.SameFile(info, current):
+		f.rotated = true
+	case current.Size() < f.offset:
+		if _, err = f.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		f.reader.Reset(f.file)
+		f.offset = 0
+		f.partial = ""
+	}
+	return nil
+}
+
+func trimEOL(line string) string {
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r")
+}
@@ -0,0 +1,294 @@
+/*
+Package tail implements capture source which follows log file and writes its records
+as exported PDUs, so application logs can be watched in Wireshark next to network traffic.
+
+File is followed like "tail -F": rotated and truncated files are handled. Records are single
+lines or, when record start regular expression is set, groups of lines beginning with a line
+matching it (e.g. stack traces). Timestamp of the packet is parsed from the record.
+
+Usage:
+
+	app := extcap.App{Usage: "application log"}
+	app.Register(tail.New("/var/log/app.log"))
+	app.Run(os.Args)
+*/
+package tail
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcapgo"
+
+	"github.com/kor44/extcap"
+)
+
+// Define all options
+var (
+	File = extcap.NewConfigFileSelectOpt("log-file", "Log file").
+		MustExist(true).Tooltip("File to follow")
+	FromStart = extcap.NewConfigBoolOpt("from-start", "Read from start").
+			Tooltip("Read existing records, otherwise only appended records are captured")
+	RecordStart = extcap.NewConfigStringOpt("record-start", "Record start").
+			Placeholder(`^\d{4}-\d{2}-\d{2}`).Tooltip("Regular expression matching first line of multi-line record, each line is a record if empty")
+	TimeLayout = extcap.NewConfigStringOpt("time-layout", "Timestamp layout").
+			Placeholder("2006-01-02 15:04:05").Tooltip("Layout of record timestamp in Go format, capture time is used if empty")
+	TimeRegex = extcap.NewConfigStringOpt("time-regex", "Timestamp regexp").
+			Tooltip("Regular expression extracting timestamp (first group or whole match), by default record starts with timestamp")
+	Dissector = extcap.NewConfigStringOpt("dissector", "Dissector").
+			Default("syslog").Tooltip("Wireshark dissector for records, e.g. syslog or json")
+)
+
+const (
+	defaultPrefix = "tail-"
+	pollInterval  = 250 * time.Millisecond
+	snapLength    = 262144
+)
+
+// Source follows log files
+type Source struct {
+	// Prefix is added to base name of the file to get interface name. Default is "tail-"
+	Prefix string
+
+	// Files are log files shown as interfaces
+	Files []string
+}
+
+// New creates source for given log files
+func New(files ...string) *Source {
+	return &Source{
+		Prefix: defaultPrefix,
+		Files:  files,
+	}
+}
+
+// Interfaces implements extcap.Source interface
+func (s *Source) Interfaces() ([]extcap.CaptureInterface, error) {
+	result := make([]extcap.CaptureInterface, 0, len(s.Files))
+	for _, file := range s.Files {
+		result = append(result, extcap.CaptureInterface{
+			Value:   s.Prefix + filepath.Base(file),
+			Display: "Log: " + file,
+		})
+	}
+	return result, nil
+}
+
+// DLT implements extcap.Source interface
+func (s *Source) DLT(iface string) (extcap.DLT, error) {
+	if _, err := s.file(iface); err != nil {
+		return extcap.DLT{}, err
+	}
+	return extcap.DLTFromLinkType(extcap.LinkTypeUpperPDU), nil
+}
+
+// ConfigOptions implements extcap.ConfigSource interface. File of the interface is default for File option.
+func (s *Source) ConfigOptions(iface string) ([]extcap.ConfigOption, error) {
+	path, err := s.file(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	file := *File
+	return []extcap.ConfigOption{file.Default(path), FromStart, RecordStart, TimeLayout, TimeRegex, Dissector}, nil
+}
+
+// AllConfigOptions implements extcap.ConfigSource interface
+func (s *Source) AllConfigOptions() []extcap.ConfigOption {
+	return []extcap.ConfigOption{File, FromStart, RecordStart, TimeLayout, TimeRegex, Dissector}
+}
+
+// StartCapture implements extcap.Source interface
+func (s *Source) StartCapture(iface string, fifo io.WriteCloser, filter string, opts map[string]interface{}) error {
+	defer fifo.Close()
+
+	path, err := s.file(iface)
+	if err != nil {
+		return err
+	}
+
+	str := func(opt interface{ Call() string }) string {
+		v, _ := opts[opt.Call()].(string)
+		return v
+	}
+
+	if v := str(File); v != "" {
+		path = v
+	}
+	fromStart, _ := opts[FromStart.Call()].(bool)
+
+	p, err := newParser(str(RecordStart), str(TimeLayout), str(TimeRegex))
+	if err != nil {
+		return err
+	}
+	p.dissector = str(Dissector)
+	if p.dissector == "" {
+		p.dissector = "syslog"
+	}
+
+	f, err := newFollower(path, fromStart, pollInterval)
+	if err != nil {
+		return err
+	}
+
+	extcap.Log().Infof("Follow '%s', records are passed to '%s'", path, p.dissector)
+	return p.run(f, fifo)
+}
+
+func (s *Source) file(iface string) (string, error) {
+	for _, file := range s.Files {
+		if iface == s.Prefix+filepath.Base(file) {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("%w '%s'", extcap.ErrUnknownInterface, iface)
+}
+
+// parser splits lines into records and parses their timestamps
+type parser struct {
+	start      *regexp.Regexp
+	timeLayout string
+	timeRegex  *regexp.Regexp
+	dissector  string
+
+	pending []string
+}
+
+func newParser(start, timeLayout, timeRegex string) (*parser, error) {
+	p := &parser{timeLayout: timeLayout}
+
+	var err error
+	if start != "" {
+		if p.start, err = regexp.Compile(start); err != nil {
+			return nil, fmt.Errorf("Invalid record start: %w", err)
+		}
+	}
+	if timeRegex != "" {
+		if p.timeRegex, err = regexp.Compile(timeRegex); err != nil {
+			return nil, fmt.Errorf("Invalid timestamp regexp: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// line adds line to current record. It returns previous record when the line starts new one.
+// Blank lines are skipped, unless they are inside of multi-line record.
+func (p *parser) line(line string) (string, bool) {
+	if strings.TrimSpace(line) == "" && (p.start == nil || len(p.pending) == 0) {
+		return "", false
+	}
+	if p.start == nil {
+		return line, true
+	}
+
+	var record string
+	var ok bool
+	if p.start.MatchString(line) {
+		record, ok = p.flush()
+	}
+	p.pending = append(p.pending, line)
+	return record, ok
+}
+
+// flush returns collected record
+func (p *parser) flush() (string, bool) {
+	if len(p.pending) == 0 {
+		return "", false
+	}
+	record := strings.Join(p.pending, "\n")
+	p.pending = p.pending[:0]
+	return record, true
+}
+
+// timestamp returns time of the record. Year of layouts without year (e.g. syslog) is the current one.
+func (p *parser) timestamp(record string, now time.Time) time.Time {
+	if p.timeLayout == "" {
+		return now
+	}
+
+	var ts time.Time
+	var err error
+	if p.timeRegex != nil {
+		m := p.timeRegex.FindStringSubmatch(record)
+		switch {
+		case m == nil:
+			return now
+		case len(m) > 1:
+			ts, err = time.ParseInLocation(p.timeLayout, m[1], time.Local)
+		default:
+			ts, err = time.ParseInLocation(p.timeLayout, m[0], time.Local)
+		}
+	} else {
+		ts, err = p.parsePrefix(record)
+	}
+	if err != nil {
+		return now
+	}
+	if ts.Year() == 0 {
+		ts = ts.AddDate(now.Year(), 0, 0)
+	}
+	return ts
+}
+
+// parsePrefix parses timestamp at the start of the record. Width of layouts with padded days,
+// month names, fractional seconds or zone names varies, so the record is cut at successive
+// field boundaries until the prefix is parsed.
+func (p *parser) parsePrefix(record string) (time.Time, error) {
+	fields := len(strings.Fields(p.timeLayout))
+	err := errors.New("record has no timestamp")
+	for i := 0; i < len(record) && fields > 0; i++ {
+		last := i == len(record)-1
+		if !last && (record[i] == ' ' || record[i+1] != ' ') {
+			continue
+		}
+		fields--
+
+		var ts time.Time
+		if ts, err = time.ParseInLocation(p.timeLayout, record[:i+1], time.Local); err == nil {
+			return ts, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// run writes records of followed file until writing fails
+func (p *parser) run(f *follower, w io.Writer) error {
+	pw := pcapgo.NewWriterNanos(w)
+	if err := pw.WriteFileHeader(snapLength, extcap.LinkTypeUpperPDU); err != nil {
+		return err
+	}
+
+	write := func(record string, ok bool) error {
+		if !ok {
+			return nil
+		}
+		data := extcap.ExportPDU(p.dissector, nil, []byte(record))
+		ci := gopacket.CaptureInfo{
+			Timestamp:     p.timestamp(record, time.Now()),
+			CaptureLength: len(data),
+			Length:        len(data),
+		}
+		return pw.WritePacket(ci, data)
+	}
+
+	// multi-line record is finished when nothing is appended during poll interval
+	idle := 0
+	return f.run(
+		func(line string) error {
+			idle = 0
+			return write(p.line(line))
+		},
+		func() error {
+			if idle++; idle < 2 {
+				return nil
+			}
+			return write(p.flush())
+		},
+	)
+}
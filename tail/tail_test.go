@@ -0,0 +1,128 @@
+package tail
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParser(t *testing.T) {
+	p, err := newParser(`^\d{4}-`, "2006-01-02 15:04:05", "")
+	require.NoError(t, err)
+
+	var records []string
+	for _, line := range []string{
+		"2021-03-04 05:06:07 ERROR failed",
+		"  at main.go:10",
+		"  at main.go:20",
+		"2021-03-04 05:06:08 INFO done",
+	} {
+		if record, ok := p.line(line); ok {
+			records = append(records, record)
+		}
+	}
+	if record, ok := p.flush(); ok {
+		records = append(records, record)
+	}
+
+	require.Equal(t, []string{
+		"2021-03-04 05:06:07 ERROR failed\n  at main.go:10\n  at main.go:20",
+		"2021-03-04 05:06:08 INFO done",
+	}, records)
+
+	// blank lines are not records
+	single, err := newParser("", "", "")
+	require.NoError(t, err)
+	_, ok := single.line("")
+	assert.False(t, ok)
+	_, ok = single.line(" \r")
+	assert.False(t, ok)
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.Local)
+	assert.Equal(t, time.Date(2021, 3, 4, 5, 6, 7, 0, time.Local), p.timestamp(records[0], now))
+	assert.Equal(t, now, p.timestamp("garbage", now))
+
+	// syslog timestamp without year
+	p, err = newParser("", "Jan _2 15:04:05", `^<\d+>(\w{3} [ \d]\d \d\d:\d\d:\d\d)`)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2022, 3, 4, 5, 6, 7, 0, time.Local), p.timestamp("<13>Mar  4 05:06:07 host app: msg", now))
+
+	// width of timestamp varies
+	testCases := []struct {
+		layout, record string
+		expected       time.Time
+	}{
+		{"Jan _2 15:04:05", "Mar  4 05:06:07 host app: msg", time.Date(2022, 3, 4, 5, 6, 7, 0, time.Local)},
+		{"Jan _2 15:04:05", "Mar 14 05:06:07 host app: msg", time.Date(2022, 3, 14, 5, 6, 7, 0, time.Local)},
+		{"January 2 2006 15:04:05", "September 4 2021 05:06:07 INFO", time.Date(2021, 9, 4, 5, 6, 7, 0, time.Local)},
+		{"2006-01-02 15:04:05.999", "2021-03-04 05:06:07.25 INFO", time.Date(2021, 3, 4, 5, 6, 7, 250000000, time.Local)},
+		{"2006-01-02 15:04:05.999", "2021-03-04 05:06:07", time.Date(2021, 3, 4, 5, 6, 7, 0, time.Local)},
+	}
+	for _, tc := range testCases {
+		p, err = newParser("", tc.layout, "")
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, p.timestamp(tc.record, now), tc.record)
+	}
+
+	_, err = newParser("(", "", "")
+	assert.Error(t, err)
+}
+
+var errDone = errors.New("done")
+
+func TestFollower(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(path, []byte("old\n"), 0644))
+
+	f, err := newFollower(path, false, 10*time.Millisecond)
+	require.NoError(t, err)
+
+	appendLine := func(name, line string) {
+		file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		require.NoError(t, err)
+		defer file.Close()
+		_, err = file.WriteString(line)
+		require.NoError(t, err)
+	}
+
+	steps := []func(){
+		// incomplete line is kept until it is finished
+		func() { appendLine(path, "first "); appendLine(path, "line\n") },
+		// rotation: rest of old file is read, then new file
+		func() {
+			require.NoError(t, os.Rename(path, path+".1"))
+			appendLine(path+".1", "second\n")
+			appendLine(path, "third\n")
+		},
+		// truncation
+		func() {
+			require.NoError(t, os.WriteFile(path, []byte("4\n"), 0644))
+		},
+	}
+
+	var lines []string
+	step := 0
+	err = f.run(
+		func(line string) error {
+			lines = append(lines, line)
+			if len(lines) == 4 {
+				return errDone
+			}
+			return nil
+		},
+		func() error {
+			if step < len(steps) {
+				steps[step]()
+				step++
+			}
+			return nil
+		},
+	)
+	assert.ErrorIs(t, err, errDone)
+	assert.Equal(t, []string{"first line", "second", "third", "4"}, lines)
+}
@@ -0,0 +1,255 @@
+package extcap
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// ValidationError lists all problems found in App definition
+type ValidationError struct {
+	Problems []error
+}
+
+// Error implements error interface
+func (e *ValidationError) Error() string {
+	w := new(strings.Builder)
+	fmt.Fprint(w, "Invalid application definition:")
+	for _, p := range e.Problems {
+		fmt.Fprintf(w, "\n  - %s", p)
+	}
+	return w.String()
+}
+
+// Validate checks that required hooks are defined and config options are correct:
+// call names are unique, ranges are valid, defaults are in range or among selector values.
+// Options of every interface are checked as well, they should be among GetAllConfigOptions,
+// because command line flags are made of them. All found problems are returned together
+// as *ValidationError. Validate is called by Run.
+func (extapp *App) Validate() error {
+	app := *extapp
+	app.useSources()
+
+	var problems []error
+	if app.GetInterfaces == nil {
+		problems = append(problems, errors.New("GetInterfaces is not defined"))
+	}
+	if app.GetDLT == nil {
+		problems = append(problems, errors.New("GetDLT is not defined"))
+	}
+	if app.StartCapture == nil {
+		problems = append(problems, errors.New("StartCapture is not defined"))
+	}
+
+	// options of registered sources are checked before they are merged
+	switch {
+	case extapp.GetAllConfigOptions == nil && app.registry != nil:
+		problems = append(problems, app.registry.validateOptions(app.reservedFlags())...)
+	case app.GetAllConfigOptions != nil:
+		problems = append(problems, validateOptions(app.GetAllConfigOptions(), app.reservedFlags())...)
+	}
+	problems = append(problems, app.validateInterfaceOptions()...)
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// validateInterfaceOptions checks options returned by GetConfigOptions for every interface.
+// Failing hooks are not problems of the definition, they are reported when called by Wireshark.
+func (app *App) validateInterfaceOptions() []error {
+	if app.GetInterfaces == nil || app.GetConfigOptions == nil {
+		return nil
+	}
+	ifaces, err := app.GetInterfaces()
+	if err != nil {
+		return nil
+	}
+
+	all := make(map[string]ConfigOption)
+	if app.GetAllConfigOptions != nil {
+		for _, opt := range app.GetAllConfigOptions() {
+			if opt != nil {
+				all[opt.call()] = opt
+			}
+		}
+	}
+
+	var problems []error
+	reserved := app.reservedFlags()
+	for _, iface := range ifaces {
+		opts, err := app.GetConfigOptions(iface.Value)
+		if err != nil {
+			continue
+		}
+
+		// options shared with GetAllConfigOptions are already checked
+		var own []ConfigOption
+		for _, opt := range opts {
+			if opt != nil && all[opt.call()] == opt {
+				continue
+			}
+			own = append(own, opt)
+			if opt != nil && all[opt.call()] == nil {
+				problems = append(problems, fmt.Errorf("option '%s' of interface '%s' is not returned by GetAllConfigOptions", opt.call(), iface.Value))
+			}
+		}
+		for _, p := range validateOptions(own, reserved) {
+			problems = append(problems, fmt.Errorf("interface '%s': %w", iface.Value, p))
+		}
+	}
+	return problems
+}
+
+// validateOptions checks options, their names should not be among reserved
+func validateOptions(opts []ConfigOption, reserved map[string]bool) []error {
+	var problems []error
+	seen := make(map[string]ConfigOption)
+	for _, opt := range opts {
+		if opt == nil {
+			problems = append(problems, errors.New("config option is nil"))
+			continue
+		}
+
+		if _, err := optionFlag(opt); err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		problems = append(problems, opt.validate()...)
+
+		call := opt.call()
+		if reserved[call] {
+			problems = append(problems, fmt.Errorf("option '%s' conflicts with extcap flag", call))
+		}
+		if other, ok := seen[call]; ok && other != opt {
+			problems = append(problems, fmt.Errorf("option '%s' is defined several times", call))
+		}
+		seen[call] = opt
+	}
+	return problems
+}
+
+// optionFlag returns command line flag for config option. Default value of the option
+// is used as flag value, except boolflag which Wireshark passes only when it is checked.
+func optionFlag(opt ConfigOption) (cli.Flag, error) {
+	switch opt := opt.(type) {
+	case *ConfigStringOpt:
+		return &cli.StringFlag{
+			Name:  opt.call(),
+			Usage: opt.display(),
+			Value: opt.defaultValue,
+		}, nil
+	case *ConfigSelectorOpt:
+		return &cli.StringFlag{
+			Name:  opt.call(),
+			Usage: opt.display(),
+			Value: opt.defaultString(),
+		}, nil
+	case *ConfigBoolOpt:
+		return &cli.BoolFlag{
+			Name:  opt.call(),
+			Usage: opt.display(),
+		}, nil
+	case *ConfigIntegerOpt:
+		return &cli.IntFlag{
+			Name:  opt.call(),
+			Usage: opt.display(),
+			Value: opt.defaultValue,
+		}, nil
+	case *ConfigDoubleOpt:
+		return &cli.Float64Flag{
+			Name:  opt.call(),
+			Usage: opt.display(),
+			Value: opt.defaultValue,
+		}, nil
+	case *ConfigPasswordOpt:
+		return &cli.StringFlag{
+			Name:  opt.call(),
+			Usage: opt.display(),
+		}, nil
+	case *ConfigFileSelectOpt:
+		return &cli.StringFlag{
+			Name:  opt.call(),
+			Usage: opt.display(),
+			Value: opt.defaultValue,
+		}, nil
+	}
+	return nil, fmt.Errorf("Unknown config option type: %T", opt)
+}
+
+// defaultValue returns value of the option when it is not given by the user
+func defaultValue(opt ConfigOption) interface{} {
+	flag, _ := optionFlag(opt)
+	switch flag := flag.(type) {
+	case *cli.StringFlag:
+		return flag.Value
+	case *cli.IntFlag:
+		return flag.Value
+	case *cli.Float64Flag:
+		return flag.Value
+	case *cli.BoolFlag:
+		return flag.Value
+	}
+	return nil
+}
+
+// checkValue checks value of the option given in command line or config file
+// the same way Wireshark checks it in the dialog
+func checkValue(opt ConfigOption, value interface{}) error {
+	switch opt := opt.(type) {
+	case *ConfigIntegerOpt:
+		v, _ := value.(int)
+		if opt.rangeSet && (v < opt.min || v > opt.max) {
+			return fmt.Errorf("Value %d of option '%s' is out of range %d-%d", v, opt.call(), opt.min, opt.max)
+		}
+	case *ConfigDoubleOpt:
+		v, _ := value.(float64)
+		if opt.rangeSet && (v < opt.min || v > opt.max) {
+			return fmt.Errorf("Value %g of option '%s' is out of range %g-%g", v, opt.call(), opt.min, opt.max)
+		}
+	case *ConfigStringOpt:
+		v, _ := value.(string)
+		if opt.validation != nil && v != "" && !opt.validation.MatchString(v) {
+			return fmt.Errorf("Value '%s' of option '%s' doesn't match validation", v, opt.call())
+		}
+	case *ConfigFileSelectOpt:
+		v, _ := value.(string)
+		if opt.mustExist && v != "" {
+			if _, err := os.Stat(v); err != nil {
+				return fmt.Errorf("File of option '%s' doesn't exist: %w", opt.call(), err)
+			}
+		}
+	}
+
+	if v, ok := value.(string); ok && v == "" && opt.isRequired() {
+		return fmt.Errorf("Option '%s' is required", opt.call())
+	}
+	return nil
+}
+
+// checkOptions checks values of config options of the interface which are set or required
+func (extapp *App) checkOptions(ctx *cli.Context, iface string) error {
+	opts := extapp.libraryOptions()
+	if extapp.GetConfigOptions != nil {
+		ifaceOpts, err := extapp.GetConfigOptions(iface)
+		if err != nil {
+			return err
+		}
+		opts = append(ifaceOpts, opts...)
+	}
+
+	for _, opt := range opts {
+		value := ctx.Value(opt.call())
+		if value == nil || !ctx.IsSet(opt.call()) && !opt.isRequired() {
+			continue
+		}
+		if err := checkValue(opt, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package extcap
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	getInterfaces := func() ([]CaptureInterface, error) { return nil, nil }
+	getDLT := func(string) (DLT, error) { return DLT{}, nil }
+	startCapture := func(string, io.WriteCloser, string, map[string]interface{}) error { return nil }
+	port := NewConfigIntegerOpt("port", "Port").Default(514)
+
+	testCases := []struct {
+		name     string
+		app      App
+		problems int
+	}{
+		{"Valid", App{
+			GetInterfaces: getInterfaces,
+			GetDLT:        getDLT,
+			StartCapture:  startCapture,
+			GetAllConfigOptions: func() []ConfigOption {
+				return []ConfigOption{
+					NewConfigIntegerOpt("delay", "Delay").Range(1, 10).Default(5),
+					NewConfigSelectorOpt("remote", "Remote").Values(SelectorValue{"if1", "Remote1", false}).Default("if1"),
+				}
+			},
+		}, 0},
+
+		{"No hooks", App{}, 3},
+
+		{"Registered source", App{registry: &Registry{sources: []Source{&testSource{}}}}, 0},
+
+		{"Option named as disabled library option", App{
+			GetInterfaces:       getInterfaces,
+			GetDLT:              getDLT,
+			StartCapture:        startCapture,
+			GetAllConfigOptions: func() []ConfigOption { return []ConfigOption{NewConfigIntegerOpt("buffer-size", "Buffer (MiB)")} },
+		}, 0},
+
+		{"Option conflicts with library option", App{
+			GetInterfaces:       getInterfaces,
+			GetDLT:              getDLT,
+			StartCapture:        startCapture,
+			GetAllConfigOptions: func() []ConfigOption { return []ConfigOption{NewConfigIntegerOpt("buffer-size", "Buffer (MiB)")} },
+			OutputBuffer:        true,
+		}, 1},
+
+		{"Sources with shared option", App{registry: &Registry{sources: []Source{
+			&testConfigSource{testSource{opts: []ConfigOption{NewConfigIntegerOpt("port", "Port").Default(9999)}}},
+			&testConfigSource{testSource{opts: []ConfigOption{NewConfigIntegerOpt("port", "Port").Default(514)}}},
+		}}}, 0},
+
+		{"Sources with conflicting options", App{registry: &Registry{sources: []Source{
+			&testConfigSource{testSource{opts: []ConfigOption{NewConfigIntegerOpt("port", "Port")}}},
+			&testConfigSource{testSource{opts: []ConfigOption{
+				NewConfigStringOpt("port", "Port"),
+				NewConfigStringOpt("host", "Host"),
+				NewConfigStringOpt("host", "Duplicate"),
+			}}},
+		}}}, 2},
+
+		{"Invalid options", App{
+			GetInterfaces: getInterfaces,
+			GetDLT:        getDLT,
+			StartCapture:  startCapture,
+			GetAllConfigOptions: func() []ConfigOption {
+				return []ConfigOption{
+					NewConfigIntegerOpt("delay", "Delay").Range(10, 1),
+					NewConfigIntegerOpt("count", "Count").Range(1, 10).Default(11),
+					NewConfigStringOpt("count", "Duplicate"),
+					NewConfigStringOpt("server", "Server").Validation("("),
+					NewConfigSelectorOpt("remote", "Remote").Values(SelectorValue{"if1", "Remote1", false}).Default("if2"),
+					NewConfigRadioOpt("mode", "Mode"),
+					NewConfigBoolOpt("fifo", "Conflict"),
+					NewConfigDoubleOpt("speed", "Speed").Range(0.1, 10).Default(20),
+				}
+			},
+		}, 8},
+
+		{"Interface options", App{
+			GetInterfaces: func() ([]CaptureInterface, error) {
+				return []CaptureInterface{{"eth0", "Ethernet"}, {"eth1", "Ethernet"}}, nil
+			},
+			GetDLT:       getDLT,
+			StartCapture: startCapture,
+			GetConfigOptions: func(iface string) ([]ConfigOption, error) {
+				if iface == "eth0" {
+					return []ConfigOption{port, NewConfigIntegerOpt("port", "Port").Default(1514)}, nil
+				}
+				// option is missing in all options and its default is out of range
+				return []ConfigOption{port, NewConfigIntegerOpt("delay", "Delay").Range(1, 10).Default(11)}, nil
+			},
+			GetAllConfigOptions: func() []ConfigOption { return []ConfigOption{port} },
+		}, 2},
+
+		{"Failing interfaces", App{
+			GetInterfaces:       func() ([]CaptureInterface, error) { return nil, errors.New("unreachable") },
+			GetDLT:              getDLT,
+			StartCapture:        startCapture,
+			GetConfigOptions:    func(string) ([]ConfigOption, error) { return []ConfigOption{port}, nil },
+			GetAllConfigOptions: func() []ConfigOption { return []ConfigOption{port} },
+		}, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.app.Validate()
+			if tc.problems == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			var verr *ValidationError
+			require.True(t, errors.As(err, &verr), "%v", err)
+			assert.Len(t, verr.Problems, tc.problems, "%v", err)
+		})
+	}
+}
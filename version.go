@@ -0,0 +1,150 @@
+package extcap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// WiresharkVersion is version of Wireshark which runs the application
+type WiresharkVersion struct {
+	Major int
+	Minor int
+}
+
+// String implements fmt.Stringer interface
+func (v WiresharkVersion) String() string {
+	if !v.Known() {
+		return "unknown"
+	}
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// Known reports if version was received from Wireshark
+func (v WiresharkVersion) Known() bool {
+	return v != WiresharkVersion{}
+}
+
+// AtLeast reports if version is equal or newer than given one
+func (v WiresharkVersion) AtLeast(major, minor int) bool {
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+// parseVersion parses version passed with --extcap-version, e.g. "3.6" or "4.0.1"
+func parseVersion(str string) (WiresharkVersion, error) {
+	parts := strings.SplitN(str, ".", 3)
+	if len(parts) < 2 {
+		return WiresharkVersion{}, fmt.Errorf("Invalid extcap version '%s'", str)
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return WiresharkVersion{}, fmt.Errorf("Invalid extcap version '%s'", str)
+	}
+
+	// minor part may have suffix, e.g. 4.1rc0
+	minorStr := parts[1]
+	if i := strings.IndexFunc(minorStr, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		minorStr = minorStr[:i]
+	}
+	minor, err := strconv.Atoi(minorStr)
+	if err != nil {
+		return WiresharkVersion{}, fmt.Errorf("Invalid extcap version '%s'", str)
+	}
+
+	return WiresharkVersion{Major: major, Minor: minor}, nil
+}
+
+// Wireshark older than 3.0 doesn't pass --extcap-version with --extcap-interfaces
+var legacyVersion = WiresharkVersion{Major: 2, Minor: 6}
+
+var hostVersion WiresharkVersion
+
+// HostVersion returns version of Wireshark which runs the application.
+// Wireshark passes its version only together with --extcap-interfaces, so it is
+// stored in cache directory and used in other modes. It is unknown until
+// interfaces are queried for the first time.
+func HostVersion() WiresharkVersion {
+	return hostVersion
+}
+
+// versionFile is name of file in cache directory which keeps host version
+const versionFile = "host-version"
+
+// storeHostVersion keeps host version in directory, so it is known in modes in which
+// Wireshark doesn't pass it
+func storeHostVersion(dir string, v WiresharkVersion) {
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, versionFile), []byte(v.String()), 0644)
+	}
+	if err != nil {
+		logger.Warnf("Unable to store Wireshark version: %s", err)
+	}
+}
+
+// storedHostVersion returns host version stored in directory by the last query of interfaces
+func storedHostVersion(dir string) WiresharkVersion {
+	data, err := os.ReadFile(filepath.Join(dir, versionFile))
+	if err != nil {
+		return WiresharkVersion{}
+	}
+	v, err := parseVersion(strings.TrimSpace(string(data)))
+	if err != nil {
+		return WiresharkVersion{}
+	}
+	return v
+}
+
+// Feature is functionality of extcap interface which is not supported by all Wireshark versions
+type Feature int
+
+// Features which depend on Wireshark version
+const (
+	// FeatureExtcapDisplay is {display} on the extcap sentence
+	FeatureExtcapDisplay Feature = iota
+
+	// FeatureToolbarControls is interface toolbar controls
+	FeatureToolbarControls
+
+	// FeatureOptionGroups is {group} of config options
+	FeatureOptionGroups
+)
+
+// First Wireshark version which supports feature
+var featureVersions = map[Feature]WiresharkVersion{
+	FeatureExtcapDisplay:   {3, 0},
+	FeatureToolbarControls: {2, 6},
+	FeatureOptionGroups:    {3, 0},
+}
+
+// Supports reports if host Wireshark supports the feature.
+// If host version is unknown, all features are considered as supported.
+func Supports(feature Feature) bool {
+	if !hostVersion.Known() {
+		return true
+	}
+
+	required, ok := featureVersions[feature]
+	return !ok || hostVersion.AtLeast(required.Major, required.Minor)
+}
+
+// featureOption is implemented by config options which require newer Wireshark.
+// Such options are not shown to older versions.
+type featureOption interface {
+	requiredFeature() Feature
+}
+
+// supportedOptions filters out options which are not supported by host Wireshark
+func supportedOptions(opts []ConfigOption) []ConfigOption {
+	result := opts[:0:0]
+	for _, opt := range opts {
+		if f, ok := opt.(featureOption); ok && !Supports(f.requiredFeature()) {
+			continue
+		}
+		result = append(result, opt)
+	}
+	return result
+}
@@ -0,0 +1,79 @@
+package extcap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVersion(t *testing.T) {
+	testCases := []struct {
+		str      string
+		expected WiresharkVersion
+		valid    bool
+	}{
+		{"3.6", WiresharkVersion{3, 6}, true},
+		{"4.0.1", WiresharkVersion{4, 0}, true},
+		{"4.1rc0", WiresharkVersion{4, 1}, true},
+		{"4", WiresharkVersion{}, false},
+		{"x.y", WiresharkVersion{}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.str, func(t *testing.T) {
+			actual, err := parseVersion(tc.str)
+			assert.Equal(t, tc.valid, err == nil)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestFeatureGating(t *testing.T) {
+	defer func(v WiresharkVersion) { hostVersion = v }(hostVersion)
+
+	ver := VersionInfo{Info: "1.0", Help: "https://example.com", Display: "Example"}
+	opt := NewConfigIntegerOpt("delay", "Time delay").Group("Timing")
+
+	hostVersion = WiresharkVersion{}
+	assert.True(t, Supports(FeatureToolbarControls))
+	assert.Equal(t, "extcap {version=1.0}{help=https://example.com}{display=Example}", ver.String())
+
+	hostVersion = legacyVersion
+	assert.True(t, Supports(FeatureToolbarControls))
+	assert.False(t, Supports(FeatureExtcapDisplay))
+	assert.Equal(t, "extcap {version=1.0}{help=https://example.com}", ver.String())
+	assert.Equal(t, "arg {number=0}{call=--delay}{display=Time delay}{type=integer}", opt.String())
+
+	hostVersion = WiresharkVersion{2, 4}
+	assert.False(t, Supports(FeatureToolbarControls))
+
+	hostVersion = WiresharkVersion{4, 2}
+	assert.True(t, Supports(FeatureExtcapDisplay))
+	assert.Equal(t, "arg {number=0}{call=--delay}{display=Time delay}{type=integer}{group=Timing}", opt.String())
+}
+
+func TestStoredHostVersion(t *testing.T) {
+	defer func(v WiresharkVersion) { hostVersion = v }(hostVersion)
+
+	extapp := testApp()
+	extapp.Cache = &QueryCache{Dir: t.TempDir()}
+	extapp.GetConfigOptions = func(iface string) ([]ConfigOption, error) {
+		return []ConfigOption{NewConfigIntegerOpt("delay", "Time delay").Group("Timing")}, nil
+	}
+
+	// version passed with --extcap-interfaces is used for config of the interface
+	for _, tc := range []struct {
+		version string
+		group   bool
+	}{{"2.6.20", false}, {"4.2.0", true}} {
+		_, err := runApp(t, extapp, "--extcap-interfaces", "--extcap-version", tc.version)
+		require.NoError(t, err)
+		hostVersion = WiresharkVersion{}
+
+		out, err := runApp(t, extapp, "--extcap-config", "--extcap-interface", "eth0")
+		require.NoError(t, err)
+		assert.Equal(t, tc.group, strings.Contains(out, "{group=Timing}"), tc.version)
+	}
+}